@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
@@ -157,19 +160,43 @@ func (app *App) submitOCRJobHandler(c *gin.Context) {
 		return
 	}
 
+	// The pages to read can be selected per request, e.g. {"pages": "1-3,last"}
+	var request struct {
+		Pages string `json:"pages"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request payload: %v", err)})
+			return
+		}
+	}
+	var pages string
+	if strings.TrimSpace(request.Pages) != "" {
+		selection, err := parsePageSelection(request.Pages)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		pages = selection.String()
+	}
+
 	// Create a new job
 	jobID := generateJobID() // Implement a function to generate unique job IDs
 	job := &Job{
 		ID:         jobID,
 		DocumentID: documentID,
 		Status:     "pending",
+		Pages:      pages,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
 
-	// Add job to store and queue
-	jobStore.addJob(job)
-	jobQueue <- job
+	// Add job to the store, the workers pick it up from there
+	if err := jobStore.addJob(job); err != nil {
+		log.Errorf("Error adding OCR job for document %d: %v", documentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding OCR job"})
+		return
+	}
 
 	// Return the job ID to the client
 	c.JSON(http.StatusAccepted, gin.H{"job_id": jobID})
@@ -185,17 +212,26 @@ func (app *App) getJobStatusHandler(c *gin.Context) {
 	}
 
 	response := gin.H{
-		"job_id":     job.ID,
-		"status":     job.Status,
-		"created_at": job.CreatedAt,
-		"updated_at": job.UpdatedAt,
-		"pages_done": job.PagesDone,
+		"job_id":      job.ID,
+		"document_id": job.DocumentID,
+		"status":      job.Status,
+		"created_at":  job.CreatedAt,
+		"updated_at":  job.UpdatedAt,
+		"pages_done":  job.PagesDone,
+		"total_pages": job.TotalPages,
+		"attempts":    job.Attempts,
+	}
+	if selection, err := job.pageSelection(); err == nil {
+		response["page_selection"] = selection.String()
 	}
 
 	if job.Status == "completed" {
 		response["result"] = job.Result
 	} else if job.Status == "failed" {
 		response["error"] = job.Result
+	} else if job.Status == "in_progress" {
+		// Results of the pages that are already done
+		response["pages"] = job.PageTexts
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -207,11 +243,14 @@ func (app *App) getAllJobsHandler(c *gin.Context) {
 	jobList := make([]gin.H, 0, len(jobs))
 	for _, job := range jobs {
 		response := gin.H{
-			"job_id":     job.ID,
-			"status":     job.Status,
-			"created_at": job.CreatedAt,
-			"updated_at": job.UpdatedAt,
-			"pages_done": job.PagesDone,
+			"job_id":      job.ID,
+			"document_id": job.DocumentID,
+			"status":      job.Status,
+			"created_at":  job.CreatedAt,
+			"updated_at":  job.UpdatedAt,
+			"pages_done":  job.PagesDone,
+			"total_pages": job.TotalPages,
+			"attempts":    job.Attempts,
 		}
 
 		if job.Status == "completed" {
@@ -226,6 +265,225 @@ func (app *App) getAllJobsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, jobList)
 }
 
+// cancelJobHandler cancels a pending or running OCR job
+func (app *App) cancelJobHandler(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	job, err := jobStore.cancelJob(jobID)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	if job.Status == "in_progress" {
+		// The worker stops at the next page and marks the job as cancelled
+		c.JSON(http.StatusAccepted, gin.H{"job_id": job.ID, "status": job.Status})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"job_id": job.ID, "status": job.Status})
+}
+
+// retryJobHandler queues a failed or cancelled OCR job again
+func (app *App) retryJobHandler(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	job, err := jobStore.retryJob(jobID)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job_id": job.ID, "status": job.Status})
+}
+
+// deleteJobsHandler removes finished OCR jobs that are older than the older_than parameter (e.g. "12h" or "7d").
+// The status parameter selects the jobs to remove, "completed" by default.
+func (app *App) deleteJobsHandler(c *gin.Context) {
+	olderThan, err := parseJobAge(c.Query("older_than"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	statuses := []string{"completed"}
+	if rawStatuses := c.Query("status"); rawStatuses != "" {
+		statuses = nil
+		for _, status := range strings.Split(rawStatuses, ",") {
+			status = strings.TrimSpace(status)
+			if status != "completed" && status != "failed" && status != "cancelled" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid status '%s', use completed, failed or cancelled", status)})
+				return
+			}
+			statuses = append(statuses, status)
+		}
+	}
+
+	deleted, err := jobStore.deleteJobs(statuses, time.Now().Add(-olderThan))
+	if err != nil {
+		log.Errorf("Error deleting jobs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting jobs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+// purgeOCRCacheHandler removes the cached OCR results, only those older than the older_than parameter if it is given
+func (app *App) purgeOCRCacheHandler(c *gin.Context) {
+	var before time.Time
+	if raw := c.Query("older_than"); raw != "" {
+		olderThan, err := parseJobAge(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		before = time.Now().Add(-olderThan)
+	}
+
+	deleted, err := purgeOCRCache(app.Database, before)
+	if err != nil {
+		log.Errorf("Error purging the OCR cache: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error purging the OCR cache"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+// getDocumentTablesHandler returns the tables OCR found in a document and the line items mapped from them
+func (app *App) getDocumentTablesHandler(c *gin.Context) {
+	documentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	tables, err := getOCRTables(app.Database, documentID)
+	if err != nil {
+		log.Errorf("Error fetching the OCR tables of document %d: %v", documentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching the OCR tables"})
+		return
+	}
+
+	lineItems := extractLineItems(tables)
+	if lineItems == nil {
+		lineItems = []LineItem{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"document_id": documentID,
+		"tables":      tables,
+		"line_items":  lineItems,
+	})
+}
+
+// parseJobAge parses a duration like "90m" or "12h", or a number of days like "7d"
+func parseJobAge(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, fmt.Errorf("missing older_than parameter, e.g. older_than=7d")
+	}
+	if days, found := strings.CutSuffix(raw, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid older_than value '%s'", raw)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(raw)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid older_than value '%s'", raw)
+	}
+	return age, nil
+}
+
+// ocrDocumentsHandler lists the documents with the manual OCR tag, together with their latest OCR job
+func (app *App) ocrDocumentsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	documents, err := app.Client.GetDocumentsByTags(ctx, []string{manualOcrTag}, 25)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching documents: %v", err)})
+		log.Errorf("Error fetching documents: %v", err)
+		return
+	}
+
+	documentIDs := make([]int, len(documents))
+	for i, document := range documents {
+		documentIDs[i] = document.ID
+	}
+	latestJobs := jobStore.latestJobs(documentIDs)
+
+	response := make([]gin.H, 0, len(documents))
+	for _, document := range documents {
+		entry := gin.H{"document": document, "job": nil}
+		if job, ok := latestJobs[document.ID]; ok {
+			entry["job"] = gin.H{
+				"job_id":      job.ID,
+				"status":      job.Status,
+				"updated_at":  job.UpdatedAt,
+				"pages_done":  job.PagesDone,
+				"total_pages": job.TotalPages,
+			}
+		}
+		response = append(response, entry)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// acceptOCRJobHandler writes the result of a completed OCR job into the document and removes the manual OCR tag.
+// The optional content field replaces the OCR result, e.g. after the user corrected it.
+func (app *App) acceptOCRJobHandler(c *gin.Context) {
+	var request struct {
+		Content string `json:"content"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request payload: %v", err)})
+			return
+		}
+	}
+
+	job, err := app.reviewOCRJob(c.Request.Context(), c.Param("job_id"), true, request.Content)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job_id": job.ID, "document_id": job.DocumentID, "accepted": true})
+}
+
+// rejectOCRJobHandler discards the result of an OCR job and removes the manual OCR tag from the document
+func (app *App) rejectOCRJobHandler(c *gin.Context) {
+	job, err := app.reviewOCRJob(c.Request.Context(), c.Param("job_id"), false, "")
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job_id": job.ID, "document_id": job.DocumentID, "accepted": false})
+}
+
+// respondJobError maps the errors of the job store to HTTP responses
+func respondJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	case errors.Is(err, errJobState):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Errorf("Error updating job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating job"})
+	}
+}
+
+// getLLMBackendsHandler returns the health of the text and vision LLM backends
+func (app *App) getLLMBackendsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"text":   llmBackendStatus(app.LLM, llmProvider, llmModel),
+		"vision": llmBackendStatus(app.VisionLLM, visionLlmProvider, visionLlmModel),
+	})
+}
+
 // getDocumentHandler handles the retrieval of a document by its ID
 func (app *App) getDocumentHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -326,14 +584,39 @@ func (app *App) undoModificationHandler(c *gin.Context) {
 		suggestion.SuggestedTags = tags
 	case "content":
 		suggestion.SuggestedContent = modification.PreviousValue
+	case "document_type":
+		suggestion.SuggestedDocumentType = modification.PreviousValue
+	case "storage_path":
+		suggestion.SuggestedStoragePath = modification.PreviousValue
+	case "created_date":
+		suggestion.SuggestedCreatedDate = modification.PreviousValue
 	default:
+		if name, isCustomField := strings.CutPrefix(modification.ModField, customFieldModPrefix); isCustomField {
+			customFieldSuggestion, err := app.customFieldUndoSuggestion(ctx, name, modification.PreviousValue)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore previous custom field value"})
+				log.Errorf("Failed to restore previous custom field value: %v", err)
+				return
+			}
+			suggestion.SuggestedCustomFields = []CustomFieldSuggestion{customFieldSuggestion}
+			break
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid modification field"})
 		log.Errorf("Invalid modification field: %v", modification.ModField)
 		return
 	}
 
 	// Update the document
-	err = app.Client.UpdateDocuments(ctx, []DocumentSuggestion{suggestion}, app.Database, true)
+	if (modification.ModField == "document_type" || modification.ModField == "storage_path") && modification.PreviousValue == "" {
+		// The document had no value before, so there is no name to resolve
+		err = app.Client.ClearDocumentField(ctx, suggestion.ID, modification.ModField)
+	} else if len(suggestion.SuggestedCustomFields) > 0 && modification.PreviousValue == "" {
+		// The document didn't have the custom field before, so it is removed rather than set to null
+		customFields := removeCustomField(suggestion.OriginalDocument.CustomFields, suggestion.SuggestedCustomFields[0].ID)
+		err = app.Client.SetDocumentCustomFields(ctx, suggestion.ID, customFields)
+	} else {
+		err = app.Client.UpdateDocuments(ctx, []DocumentSuggestion{suggestion}, app.Database, true)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update document"})
 		log.Errorf("Failed to update document: %v", err)
@@ -350,3 +633,32 @@ func (app *App) undoModificationHandler(c *gin.Context) {
 	// Else all was ok
 	c.Status(http.StatusOK)
 }
+
+// customFieldUndoSuggestion builds a suggestion that restores a custom field to a value from the modification history
+func (app *App) customFieldUndoSuggestion(ctx context.Context, name string, previousValue string) (CustomFieldSuggestion, error) {
+	customFields, err := app.Client.GetAllCustomFields(ctx)
+	if err != nil {
+		return CustomFieldSuggestion{}, err
+	}
+
+	customField, exists := customFields[name]
+	if !exists {
+		return CustomFieldSuggestion{}, fmt.Errorf("custom field '%s' does not exist anymore", name)
+	}
+
+	suggestion := CustomFieldSuggestion{
+		ID:       customField.ID,
+		Name:     customField.Name,
+		DataType: customField.DataType,
+	}
+
+	// An empty previous value means the document didn't have the field, the value stays nil
+	if previousValue != "" {
+		suggestion.Value, err = parseCustomFieldValue(customField.DataType, previousValue)
+		if err != nil {
+			return CustomFieldSuggestion{}, err
+		}
+	}
+
+	return suggestion, nil
+}
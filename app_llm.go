@@ -9,6 +9,7 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	_ "image/jpeg"
 
@@ -71,6 +72,308 @@ func (app *App) getSuggestedCorrespondent(ctx context.Context, content string, s
 	return response, nil
 }
 
+// getSuggestedDocumentType generates a suggested document type for a document using the LLM.
+// Only document types that already exist in paperless-ngx are returned, otherwise the result is empty.
+func (app *App) getSuggestedDocumentType(
+	ctx context.Context,
+	content string,
+	suggestedTitle string,
+	availableDocumentTypes []string,
+	logger *logrus.Entry) (string, error) {
+	likelyLanguage := getLikelyLanguage()
+
+	templateMutex.RLock()
+	defer templateMutex.RUnlock()
+
+	// Get available tokens for content
+	templateData := map[string]interface{}{
+		"Language":               likelyLanguage,
+		"AvailableDocumentTypes": availableDocumentTypes,
+		"Title":                  suggestedTitle,
+	}
+
+	availableTokens, err := getAvailableTokensForContent(documentTypeTemplate, templateData)
+	if err != nil {
+		logger.Errorf("Error calculating available tokens: %v", err)
+		return "", fmt.Errorf("error calculating available tokens: %v", err)
+	}
+
+	// Truncate content if needed
+	truncatedContent, err := truncateContentByTokens(content, availableTokens)
+	if err != nil {
+		logger.Errorf("Error truncating content: %v", err)
+		return "", fmt.Errorf("error truncating content: %v", err)
+	}
+
+	// Execute template with truncated content
+	var promptBuffer bytes.Buffer
+	templateData["Content"] = truncatedContent
+	err = documentTypeTemplate.Execute(&promptBuffer, templateData)
+	if err != nil {
+		logger.Errorf("Error executing document type template: %v", err)
+		return "", fmt.Errorf("error executing document type template: %v", err)
+	}
+
+	prompt := promptBuffer.String()
+	logger.Debugf("Document type suggestion prompt: %s", prompt)
+
+	completion, err := app.LLM.GenerateContent(ctx, []llms.MessageContent{
+		{
+			Parts: []llms.ContentPart{
+				llms.TextContent{
+					Text: prompt,
+				},
+			},
+			Role: llms.ChatMessageTypeHuman,
+		},
+	})
+	if err != nil {
+		logger.Errorf("Error getting response from LLM: %v", err)
+		return "", fmt.Errorf("error getting response from LLM: %v", err)
+	}
+
+	response := stripReasoning(completion.Choices[0].Content)
+
+	// Only accept document types from the available list
+	documentType := matchAvailableName(response, availableDocumentTypes)
+	if documentType == "" {
+		logger.Debugf("Suggested document type '%s' is not an available document type, ignoring", response)
+	}
+	return documentType, nil
+}
+
+// getSuggestedStoragePath generates a suggested storage path for a document using the LLM.
+// Only storage paths that already exist in paperless-ngx are returned, otherwise the result is empty.
+func (app *App) getSuggestedStoragePath(
+	ctx context.Context,
+	content string,
+	suggestedTitle string,
+	availableStoragePaths []StoragePath,
+	logger *logrus.Entry) (string, error) {
+	likelyLanguage := getLikelyLanguage()
+
+	templateMutex.RLock()
+	defer templateMutex.RUnlock()
+
+	// Get available tokens for content
+	templateData := map[string]interface{}{
+		"Language":              likelyLanguage,
+		"AvailableStoragePaths": availableStoragePaths,
+		"Title":                 suggestedTitle,
+	}
+
+	availableTokens, err := getAvailableTokensForContent(storagePathTemplate, templateData)
+	if err != nil {
+		logger.Errorf("Error calculating available tokens: %v", err)
+		return "", fmt.Errorf("error calculating available tokens: %v", err)
+	}
+
+	// Truncate content if needed
+	truncatedContent, err := truncateContentByTokens(content, availableTokens)
+	if err != nil {
+		logger.Errorf("Error truncating content: %v", err)
+		return "", fmt.Errorf("error truncating content: %v", err)
+	}
+
+	// Execute template with truncated content
+	var promptBuffer bytes.Buffer
+	templateData["Content"] = truncatedContent
+	err = storagePathTemplate.Execute(&promptBuffer, templateData)
+	if err != nil {
+		logger.Errorf("Error executing storage path template: %v", err)
+		return "", fmt.Errorf("error executing storage path template: %v", err)
+	}
+
+	prompt := promptBuffer.String()
+	logger.Debugf("Storage path suggestion prompt: %s", prompt)
+
+	completion, err := app.LLM.GenerateContent(ctx, []llms.MessageContent{
+		{
+			Parts: []llms.ContentPart{
+				llms.TextContent{
+					Text: prompt,
+				},
+			},
+			Role: llms.ChatMessageTypeHuman,
+		},
+	})
+	if err != nil {
+		logger.Errorf("Error getting response from LLM: %v", err)
+		return "", fmt.Errorf("error getting response from LLM: %v", err)
+	}
+
+	response := stripReasoning(completion.Choices[0].Content)
+
+	// Only accept storage paths from the available list
+	storagePathNames := make([]string, 0, len(availableStoragePaths))
+	for _, storagePath := range availableStoragePaths {
+		storagePathNames = append(storagePathNames, storagePath.Name)
+	}
+	storagePath := matchAvailableName(response, storagePathNames)
+	if storagePath == "" {
+		logger.Debugf("Suggested storage path '%s' is not an available storage path, ignoring", response)
+	}
+	return storagePath, nil
+}
+
+// getSuggestedCustomFields extracts values for the given custom fields from a document using the LLM.
+// Values are validated against the data type of each custom field; invalid values are dropped.
+func (app *App) getSuggestedCustomFields(
+	ctx context.Context,
+	content string,
+	suggestedTitle string,
+	customFields []CustomField,
+	logger *logrus.Entry) ([]CustomFieldSuggestion, error) {
+	likelyLanguage := getLikelyLanguage()
+
+	templateMutex.RLock()
+	defer templateMutex.RUnlock()
+
+	// Get available tokens for content
+	templateData := map[string]interface{}{
+		"Language":              likelyLanguage,
+		"AvailableCustomFields": customFields,
+		"Title":                 suggestedTitle,
+	}
+
+	availableTokens, err := getAvailableTokensForContent(customFieldsTemplate, templateData)
+	if err != nil {
+		logger.Errorf("Error calculating available tokens: %v", err)
+		return nil, fmt.Errorf("error calculating available tokens: %v", err)
+	}
+
+	// Truncate content if needed
+	truncatedContent, err := truncateContentByTokens(content, availableTokens)
+	if err != nil {
+		logger.Errorf("Error truncating content: %v", err)
+		return nil, fmt.Errorf("error truncating content: %v", err)
+	}
+
+	// Execute template with truncated content
+	var promptBuffer bytes.Buffer
+	templateData["Content"] = truncatedContent
+	err = customFieldsTemplate.Execute(&promptBuffer, templateData)
+	if err != nil {
+		logger.Errorf("Error executing custom fields template: %v", err)
+		return nil, fmt.Errorf("error executing custom fields template: %v", err)
+	}
+
+	prompt := promptBuffer.String()
+	logger.Debugf("Custom fields extraction prompt: %s", prompt)
+
+	completion, err := app.LLM.GenerateContent(ctx, []llms.MessageContent{
+		{
+			Parts: []llms.ContentPart{
+				llms.TextContent{
+					Text: prompt,
+				},
+			},
+			Role: llms.ChatMessageTypeHuman,
+		},
+	})
+	if err != nil {
+		logger.Errorf("Error getting response from LLM: %v", err)
+		return nil, fmt.Errorf("error getting response from LLM: %v", err)
+	}
+
+	suggestions, err := parseCustomFieldsResponse(stripReasoning(completion.Choices[0].Content), customFields)
+	if err != nil {
+		logger.Errorf("Error parsing custom fields response: %v", err)
+		return nil, fmt.Errorf("error parsing custom fields response: %v", err)
+	}
+
+	return suggestions, nil
+}
+
+// getSuggestedCreatedDate generates a suggested created date for a document using the LLM.
+// The result is a strict ISO date (YYYY-MM-DD), or empty if the LLM did not find a plausible date.
+func (app *App) getSuggestedCreatedDate(ctx context.Context, content string, suggestedTitle string, logger *logrus.Entry) (string, error) {
+	likelyLanguage := getLikelyLanguage()
+
+	templateMutex.RLock()
+	defer templateMutex.RUnlock()
+
+	// Get available tokens for content
+	templateData := map[string]interface{}{
+		"Language": likelyLanguage,
+		"Title":    suggestedTitle,
+		"Today":    time.Now().Format("2006-01-02"),
+	}
+
+	availableTokens, err := getAvailableTokensForContent(createdDateTemplate, templateData)
+	if err != nil {
+		logger.Errorf("Error calculating available tokens: %v", err)
+		return "", fmt.Errorf("error calculating available tokens: %v", err)
+	}
+
+	// Truncate content if needed
+	truncatedContent, err := truncateContentByTokens(content, availableTokens)
+	if err != nil {
+		logger.Errorf("Error truncating content: %v", err)
+		return "", fmt.Errorf("error truncating content: %v", err)
+	}
+
+	// Execute template with truncated content
+	var promptBuffer bytes.Buffer
+	templateData["Content"] = truncatedContent
+	err = createdDateTemplate.Execute(&promptBuffer, templateData)
+	if err != nil {
+		logger.Errorf("Error executing created date template: %v", err)
+		return "", fmt.Errorf("error executing created date template: %v", err)
+	}
+
+	prompt := promptBuffer.String()
+	logger.Debugf("Created date suggestion prompt: %s", prompt)
+
+	completion, err := app.LLM.GenerateContent(ctx, []llms.MessageContent{
+		{
+			Parts: []llms.ContentPart{
+				llms.TextContent{
+					Text: prompt,
+				},
+			},
+			Role: llms.ChatMessageTypeHuman,
+		},
+	})
+	if err != nil {
+		logger.Errorf("Error getting response from LLM: %v", err)
+		return "", fmt.Errorf("error getting response from LLM: %v", err)
+	}
+
+	createdDate, err := parseSuggestedCreatedDate(stripReasoning(completion.Choices[0].Content), time.Now())
+	if err != nil {
+		// An implausible answer is not fatal, the document just keeps its current date
+		logger.Warnf("Ignoring suggested created date: %v", err)
+		return "", nil
+	}
+
+	return createdDate, nil
+}
+
+// parseSuggestedCreatedDate parses the LLM answer into a strict ISO date and rejects implausible dates.
+// "Unknown" yields an empty date without an error.
+func parseSuggestedCreatedDate(response string, now time.Time) (string, error) {
+	response = strings.TrimSpace(strings.Trim(strings.TrimSpace(response), "\"'`."))
+	if response == "" || strings.EqualFold(response, "unknown") {
+		return "", nil
+	}
+
+	createdDate, err := time.Parse("2006-01-02", response)
+	if err != nil {
+		return "", fmt.Errorf("'%s' is not an ISO date (YYYY-MM-DD)", response)
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if createdDate.After(today) {
+		return "", fmt.Errorf("'%s' is in the future", response)
+	}
+	if createdDate.Year() < 1900 {
+		return "", fmt.Errorf("'%s' is before 1900", response)
+	}
+
+	return createdDate.Format("2006-01-02"), nil
+}
+
 // getSuggestedTags generates suggested tags for a document using the LLM
 func (app *App) getSuggestedTags(
 	ctx context.Context,
@@ -144,6 +447,11 @@ func (app *App) getSuggestedTags(
 		suggestedTags[i] = strings.TrimSpace(tag)
 	}
 
+	return filterSuggestedTags(suggestedTags, originalTags, availableTags), nil
+}
+
+// filterSuggestedTags merges the suggested tags with the original tags and keeps only tags from the available tags list
+func filterSuggestedTags(suggestedTags []string, originalTags []string, availableTags []string) []string {
 	// append the original tags to the suggested tags
 	suggestedTags = append(suggestedTags, originalTags...)
 	// Remove duplicates
@@ -161,10 +469,22 @@ func (app *App) getSuggestedTags(
 		}
 	}
 
-	return filteredTags, nil
+	return filteredTags
 }
 
-func (app *App) doOCRViaLLM(ctx context.Context, jpegBytes []byte, logger *logrus.Entry) (string, error) {
+// matchAvailableName returns the name from the list that matches the LLM response (case-insensitive), or "" if none does
+func matchAvailableName(response string, availableNames []string) string {
+	response = strings.TrimSpace(strings.Trim(response, "\""))
+	for _, name := range availableNames {
+		if strings.EqualFold(response, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// renderOCRPrompt executes the OCR prompt template
+func renderOCRPrompt() (string, error) {
 	templateMutex.RLock()
 	defer templateMutex.RUnlock()
 	likelyLanguage := getLikelyLanguage()
@@ -176,8 +496,24 @@ func (app *App) doOCRViaLLM(ctx context.Context, jpegBytes []byte, logger *logru
 	if err != nil {
 		return "", fmt.Errorf("error executing tag template: %v", err)
 	}
+	// The table instructions are part of the prompt, so changing OCR_TABLES also changes the OCR cache key
+	if instructions := ocrTableInstructions(ocrTables); instructions != "" {
+		promptBuffer.WriteString("\n\n" + instructions)
+	}
+	return promptBuffer.String(), nil
+}
 
-	prompt := promptBuffer.String()
+func (app *App) doOCRViaLLM(ctx context.Context, jpegBytes []byte, logger *logrus.Entry) (string, error) {
+	prompt, err := renderOCRPrompt()
+	if err != nil {
+		return "", err
+	}
+
+	// Scale the image down to the size the vision provider works with
+	jpegBytes, err = resizeJPEG(jpegBytes, ocrMaxImageDimension)
+	if err != nil {
+		return "", err
+	}
 
 	// Log the image dimensions
 	img, _, err := image.Decode(bytes.NewReader(jpegBytes))
@@ -187,9 +523,9 @@ func (app *App) doOCRViaLLM(ctx context.Context, jpegBytes []byte, logger *logru
 	bounds := img.Bounds()
 	logger.Debugf("Image dimensions: %dx%d", bounds.Dx(), bounds.Dy())
 
-	// If not OpenAI then use binary part for image, otherwise, use the ImageURL part with encoding from https://platform.openai.com/docs/guides/vision
+	// Use the ImageURL part with encoding from https://platform.openai.com/docs/guides/vision for OpenAI-compatible APIs, otherwise use binary part for image
 	var parts []llms.ContentPart
-	if strings.ToLower(visionLlmProvider) != "openai" {
+	if !visionLLMUsesImageURL() {
 		// Log image size in kilobytes
 		logger.Debugf("Image size: %d KB", len(jpegBytes)/1024)
 		parts = []llms.ContentPart{
@@ -206,6 +542,14 @@ func (app *App) doOCRViaLLM(ctx context.Context, jpegBytes []byte, logger *logru
 		}
 	}
 
+	// Wait for a free slot if the number of concurrent vision requests is limited
+	if visionRequests != nil {
+		if err := visionRequests.Acquire(ctx, 1); err != nil {
+			return "", err
+		}
+		defer visionRequests.Release(1)
+	}
+
 	// Convert the image to text
 	completion, err := app.VisionLLM.GenerateContent(ctx, []llms.MessageContent{
 		{
@@ -307,6 +651,55 @@ func (app *App) generateDocumentSuggestions(ctx context.Context, suggestionReque
 		availableCorrespondentNames = append(availableCorrespondentNames, correspondentName)
 	}
 
+	// Prepare a list of document type names
+	var availableDocumentTypeNames []string
+	if suggestionRequest.GenerateDocumentTypes {
+		availableDocumentTypesMap, err := app.Client.GetAllDocumentTypes(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch available document types: %v", err)
+		}
+
+		availableDocumentTypeNames = make([]string, 0, len(availableDocumentTypesMap))
+		for documentTypeName := range availableDocumentTypesMap {
+			availableDocumentTypeNames = append(availableDocumentTypeNames, documentTypeName)
+		}
+	}
+
+	// Prepare a list of storage paths, sorted by name for a stable prompt
+	var availableStoragePaths []StoragePath
+	if suggestionRequest.GenerateStoragePaths {
+		availableStoragePathsMap, err := app.Client.GetAllStoragePaths(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch available storage paths: %v", err)
+		}
+
+		availableStoragePaths = make([]StoragePath, 0, len(availableStoragePathsMap))
+		for _, storagePath := range availableStoragePathsMap {
+			availableStoragePaths = append(availableStoragePaths, storagePath)
+		}
+		slices.SortFunc(availableStoragePaths, func(a, b StoragePath) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+	}
+
+	// Prepare a list of custom fields whose data type can be extracted
+	var availableCustomFields []CustomField
+	if suggestionRequest.GenerateCustomFields {
+		availableCustomFieldsMap, err := app.Client.GetAllCustomFields(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch available custom fields: %v", err)
+		}
+
+		for _, customField := range availableCustomFieldsMap {
+			if isSupportedCustomFieldType(customField.DataType) {
+				availableCustomFields = append(availableCustomFields, customField)
+			}
+		}
+		slices.SortFunc(availableCustomFields, func(a, b CustomField) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+	}
+
 	documents := suggestionRequest.Documents
 	documentSuggestions := []DocumentSuggestion{}
 
@@ -323,11 +716,55 @@ func (app *App) generateDocumentSuggestions(ctx context.Context, suggestionReque
 			docLogger.Printf("Processing Document ID %d...", documentID)
 
 			content := doc.Content
+			if contentStrategy == contentStrategyMapReduce {
+				condensed, err := app.condenseContent(ctx, content, condensedTokenBudget(), docLogger)
+				if err != nil {
+					mu.Lock()
+					errorsList = append(errorsList, fmt.Errorf("Document %d: %v", documentID, err))
+					mu.Unlock()
+					docLogger.Errorf("Error condensing content of document %d: %v", documentID, err)
+					return
+				}
+				content = condensed
+			}
+
 			suggestedTitle := doc.Title
 			var suggestedTags []string
 			var suggestedCorrespondent string
+			var suggestedDocumentType string
+			var suggestedStoragePath string
+			var suggestedCustomFields []CustomFieldSuggestion
+			var suggestedCreatedDate string
+
+			// Try to get all suggestions with a single call first, falling back to separate calls
+			combined := false
+			if useCombinedSuggestions {
+				promptDoc := doc
+				promptDoc.Content = content
+				result, combinedErr := app.getCombinedSuggestions(ctx, promptDoc, suggestionRequest, combinedSuggestionChoices{
+					AvailableTags:           availableTagNames,
+					AvailableCorrespondents: availableCorrespondentNames,
+					AvailableDocumentTypes:  availableDocumentTypeNames,
+					AvailableStoragePaths:   availableStoragePaths,
+					AvailableCustomFields:   availableCustomFields,
+				}, docLogger)
+				if combinedErr != nil {
+					docLogger.Warnf("Combined suggestions for document %d failed, falling back to separate calls: %v", documentID, combinedErr)
+				} else {
+					combined = true
+					if suggestionRequest.GenerateTitles {
+						suggestedTitle = result.Title
+					}
+					suggestedTags = result.Tags
+					suggestedCorrespondent = result.Correspondent
+					suggestedDocumentType = result.DocumentType
+					suggestedStoragePath = result.StoragePath
+					suggestedCustomFields = result.CustomFields
+					suggestedCreatedDate = result.CreatedDate
+				}
+			}
 
-			if suggestionRequest.GenerateTitles {
+			if !combined && suggestionRequest.GenerateTitles {
 				suggestedTitle, err = app.getSuggestedTitle(ctx, content, suggestedTitle, docLogger)
 				if err != nil {
 					mu.Lock()
@@ -338,7 +775,7 @@ func (app *App) generateDocumentSuggestions(ctx context.Context, suggestionReque
 				}
 			}
 
-			if suggestionRequest.GenerateTags {
+			if !combined && suggestionRequest.GenerateTags {
 				suggestedTags, err = app.getSuggestedTags(ctx, content, suggestedTitle, availableTagNames, doc.Tags, docLogger)
 				if err != nil {
 					mu.Lock()
@@ -349,7 +786,7 @@ func (app *App) generateDocumentSuggestions(ctx context.Context, suggestionReque
 				}
 			}
 
-			if suggestionRequest.GenerateCorrespondents {
+			if !combined && suggestionRequest.GenerateCorrespondents {
 				suggestedCorrespondent, err = app.getSuggestedCorrespondent(ctx, content, suggestedTitle, availableCorrespondentNames, correspondentBlackList)
 				if err != nil {
 					mu.Lock()
@@ -360,6 +797,50 @@ func (app *App) generateDocumentSuggestions(ctx context.Context, suggestionReque
 				}
 			}
 
+			if !combined && suggestionRequest.GenerateDocumentTypes {
+				suggestedDocumentType, err = app.getSuggestedDocumentType(ctx, content, suggestedTitle, availableDocumentTypeNames, docLogger)
+				if err != nil {
+					mu.Lock()
+					errorsList = append(errorsList, fmt.Errorf("Document %d: %v", documentID, err))
+					mu.Unlock()
+					docLogger.Errorf("Error generating document type for document %d: %v", documentID, err)
+					return
+				}
+			}
+
+			if !combined && suggestionRequest.GenerateStoragePaths {
+				suggestedStoragePath, err = app.getSuggestedStoragePath(ctx, content, suggestedTitle, availableStoragePaths, docLogger)
+				if err != nil {
+					mu.Lock()
+					errorsList = append(errorsList, fmt.Errorf("Document %d: %v", documentID, err))
+					mu.Unlock()
+					docLogger.Errorf("Error generating storage path for document %d: %v", documentID, err)
+					return
+				}
+			}
+
+			if !combined && suggestionRequest.GenerateCustomFields && len(availableCustomFields) > 0 {
+				suggestedCustomFields, err = app.getSuggestedCustomFields(ctx, content, suggestedTitle, availableCustomFields, docLogger)
+				if err != nil {
+					mu.Lock()
+					errorsList = append(errorsList, fmt.Errorf("Document %d: %v", documentID, err))
+					mu.Unlock()
+					docLogger.Errorf("Error generating custom fields for document %d: %v", documentID, err)
+					return
+				}
+			}
+
+			if !combined && suggestionRequest.GenerateCreatedDate {
+				suggestedCreatedDate, err = app.getSuggestedCreatedDate(ctx, content, suggestedTitle, docLogger)
+				if err != nil {
+					mu.Lock()
+					errorsList = append(errorsList, fmt.Errorf("Document %d: %v", documentID, err))
+					mu.Unlock()
+					docLogger.Errorf("Error generating created date for document %d: %v", documentID, err)
+					return
+				}
+			}
+
 			mu.Lock()
 			suggestion := DocumentSuggestion{
 				ID:               documentID,
@@ -388,6 +869,30 @@ func (app *App) generateDocumentSuggestions(ctx context.Context, suggestionReque
 			} else {
 				suggestion.SuggestedCorrespondent = ""
 			}
+
+			// Document types
+			if suggestionRequest.GenerateDocumentTypes {
+				docLogger.Printf("Suggested document type for document %d: %s", documentID, suggestedDocumentType)
+				suggestion.SuggestedDocumentType = suggestedDocumentType
+			}
+
+			// Storage paths
+			if suggestionRequest.GenerateStoragePaths {
+				docLogger.Printf("Suggested storage path for document %d: %s", documentID, suggestedStoragePath)
+				suggestion.SuggestedStoragePath = suggestedStoragePath
+			}
+
+			// Custom fields
+			if suggestionRequest.GenerateCustomFields {
+				docLogger.Printf("Suggested custom fields for document %d: %v", documentID, suggestedCustomFields)
+				suggestion.SuggestedCustomFields = suggestedCustomFields
+			}
+
+			// Created date
+			if suggestionRequest.GenerateCreatedDate {
+				docLogger.Printf("Suggested created date for document %d: %s", documentID, suggestedCreatedDate)
+				suggestion.SuggestedCreatedDate = suggestedCreatedDate
+			}
 			// Remove manual tag from the list of suggested tags
 			suggestion.RemoveTags = []string{manualTag, autoTag}
 
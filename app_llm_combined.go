@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// combinedSuggestionChoices holds the values the LLM may choose from in combined mode
+type combinedSuggestionChoices struct {
+	AvailableTags           []string
+	AvailableCorrespondents []string
+	AvailableDocumentTypes  []string
+	AvailableStoragePaths   []StoragePath
+	AvailableCustomFields   []CustomField
+}
+
+// combinedSuggestions holds the validated result of a combined suggestion call
+type combinedSuggestions struct {
+	Title         string
+	Tags          []string
+	Correspondent string
+	DocumentType  string
+	StoragePath   string
+	CustomFields  []CustomFieldSuggestion
+	CreatedDate   string
+}
+
+// getCombinedSuggestions asks the LLM for all requested fields of a document in a single call.
+// The reply must be a JSON object that passes validateCombinedSuggestions; otherwise an error is
+// returned so the caller can fall back to separate calls per field.
+func (app *App) getCombinedSuggestions(
+	ctx context.Context,
+	doc Document,
+	suggestionRequest GenerateSuggestionsRequest,
+	choices combinedSuggestionChoices,
+	logger *logrus.Entry) (combinedSuggestions, error) {
+	likelyLanguage := getLikelyLanguage()
+
+	templateMutex.RLock()
+	defer templateMutex.RUnlock()
+
+	// Remove all paperless-gpt related tags from available tags
+	availableTags := removeTagFromList(choices.AvailableTags, manualTag)
+	availableTags = removeTagFromList(availableTags, autoTag)
+	availableTags = removeTagFromList(availableTags, autoOcrTag)
+
+	generateCustomFields := suggestionRequest.GenerateCustomFields && len(choices.AvailableCustomFields) > 0
+
+	// Get available tokens for content
+	templateData := map[string]interface{}{
+		"Language":                likelyLanguage,
+		"Title":                   doc.Title,
+		"OriginalTags":            doc.Tags,
+		"Today":                   time.Now().Format("2006-01-02"),
+		"GenerateTitles":          suggestionRequest.GenerateTitles,
+		"GenerateTags":            suggestionRequest.GenerateTags,
+		"GenerateCorrespondents":  suggestionRequest.GenerateCorrespondents,
+		"GenerateDocumentTypes":   suggestionRequest.GenerateDocumentTypes,
+		"GenerateStoragePaths":    suggestionRequest.GenerateStoragePaths,
+		"GenerateCustomFields":    generateCustomFields,
+		"GenerateCreatedDate":     suggestionRequest.GenerateCreatedDate,
+		"AvailableTags":           availableTags,
+		"AvailableCorrespondents": choices.AvailableCorrespondents,
+		"BlackList":               correspondentBlackList,
+		"AvailableDocumentTypes":  choices.AvailableDocumentTypes,
+		"AvailableStoragePaths":   choices.AvailableStoragePaths,
+		"AvailableCustomFields":   choices.AvailableCustomFields,
+	}
+
+	availableTokens, err := getAvailableTokensForContent(combinedTemplate, templateData)
+	if err != nil {
+		return combinedSuggestions{}, fmt.Errorf("error calculating available tokens: %v", err)
+	}
+
+	// Truncate content if needed
+	truncatedContent, err := truncateContentByTokens(doc.Content, availableTokens)
+	if err != nil {
+		return combinedSuggestions{}, fmt.Errorf("error truncating content: %v", err)
+	}
+
+	// Execute template with truncated content
+	var promptBuffer bytes.Buffer
+	templateData["Content"] = truncatedContent
+	err = combinedTemplate.Execute(&promptBuffer, templateData)
+	if err != nil {
+		return combinedSuggestions{}, fmt.Errorf("error executing combined template: %v", err)
+	}
+
+	prompt := promptBuffer.String()
+	logger.Debugf("Combined suggestion prompt: %s", prompt)
+
+	completion, err := app.LLM.GenerateContent(ctx, []llms.MessageContent{
+		{
+			Parts: []llms.ContentPart{
+				llms.TextContent{
+					Text: prompt,
+				},
+			},
+			Role: llms.ChatMessageTypeHuman,
+		},
+	}, llms.WithJSONMode())
+	if err != nil {
+		return combinedSuggestions{}, fmt.Errorf("error getting response from LLM: %v", err)
+	}
+
+	response := stripReasoning(completion.Choices[0].Content)
+	logger.Debugf("Combined suggestion response: %s", response)
+
+	raw, err := validateCombinedSuggestions(response, suggestionRequest, generateCustomFields)
+	if err != nil {
+		return combinedSuggestions{}, err
+	}
+
+	// Apply the same post-processing as the separate calls
+	result := combinedSuggestions{
+		Title:         strings.TrimSpace(strings.Trim(raw.Title, "\"")),
+		Correspondent: strings.TrimSpace(raw.Correspondent),
+		DocumentType:  matchAvailableName(raw.DocumentType, choices.AvailableDocumentTypes),
+	}
+	if suggestionRequest.GenerateTags {
+		for i, tag := range raw.Tags {
+			raw.Tags[i] = strings.TrimSpace(tag)
+		}
+		result.Tags = filterSuggestedTags(raw.Tags, doc.Tags, availableTags)
+	}
+	if suggestionRequest.GenerateStoragePaths {
+		storagePathNames := make([]string, 0, len(choices.AvailableStoragePaths))
+		for _, storagePath := range choices.AvailableStoragePaths {
+			storagePathNames = append(storagePathNames, storagePath.Name)
+		}
+		result.StoragePath = matchAvailableName(raw.StoragePath, storagePathNames)
+	}
+	if generateCustomFields {
+		result.CustomFields = validateCustomFieldValues(raw.CustomFields, choices.AvailableCustomFields)
+	}
+	if suggestionRequest.GenerateCreatedDate {
+		result.CreatedDate, err = parseSuggestedCreatedDate(raw.CreatedDate, time.Now())
+		if err != nil {
+			logger.Warnf("Ignoring suggested created date: %v", err)
+		}
+	}
+
+	return result, nil
+}
+
+// combinedSuggestionsResponse is the raw JSON reply of the LLM in combined mode
+type combinedSuggestionsResponse struct {
+	Title         string
+	Tags          []string
+	Correspondent string
+	DocumentType  string
+	StoragePath   string
+	CustomFields  map[string]interface{}
+	CreatedDate   string
+}
+
+// validateCombinedSuggestions checks the reply of the LLM against the schema of the requested fields:
+// every requested key must be present with the expected JSON type, and the title must not be empty.
+func validateCombinedSuggestions(response string, suggestionRequest GenerateSuggestionsRequest, generateCustomFields bool) (combinedSuggestionsResponse, error) {
+	var result combinedSuggestionsResponse
+
+	jsonObject, err := extractJSONObject(response)
+	if err != nil {
+		return result, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(jsonObject), &fields); err != nil {
+		return result, fmt.Errorf("invalid JSON object: %v", err)
+	}
+
+	schema := []struct {
+		key       string
+		requested bool
+		target    interface{}
+	}{
+		{"title", suggestionRequest.GenerateTitles, &result.Title},
+		{"tags", suggestionRequest.GenerateTags, &result.Tags},
+		{"correspondent", suggestionRequest.GenerateCorrespondents, &result.Correspondent},
+		{"document_type", suggestionRequest.GenerateDocumentTypes, &result.DocumentType},
+		{"storage_path", suggestionRequest.GenerateStoragePaths, &result.StoragePath},
+		{"custom_fields", generateCustomFields, &result.CustomFields},
+		{"created_date", suggestionRequest.GenerateCreatedDate, &result.CreatedDate},
+	}
+
+	for _, field := range schema {
+		if !field.requested {
+			continue
+		}
+		value, exists := fields[field.key]
+		if !exists || string(value) == "null" {
+			return result, fmt.Errorf("missing key %q", field.key)
+		}
+		if err := json.Unmarshal(value, field.target); err != nil {
+			return result, fmt.Errorf("key %q has the wrong type: %v", field.key, err)
+		}
+	}
+
+	if suggestionRequest.GenerateTitles && strings.TrimSpace(result.Title) == "" {
+		return result, fmt.Errorf("title is empty")
+	}
+
+	return result, nil
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"sync"
 	"testing"
 	"text/template"
+	"time"
 
+	"github.com/Masterminds/sprig/v3"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -14,26 +18,52 @@ import (
 	"github.com/tmc/langchaingo/textsplitter"
 )
 
-// Mock LLM for testing
+// Mock LLM for testing. It returns response, or err if set, or the result of respond if set.
+// It is safe for concurrent use, respond is called without holding the lock.
 type mockLLM struct {
+	mu         sync.Mutex
 	lastPrompt string
+	lastParts  []llms.ContentPart
+	response   string // Response to return, defaults to "test response"
+	err        error  // Error to return instead of a response
+	respond    func(ctx context.Context, call int, parts []llms.ContentPart) (string, error)
+	calls      int
 }
 
 func (m *mockLLM) CreateEmbedding(_ context.Context, texts []string) ([][]float32, error) {
 	return nil, nil
 }
 
-func (m *mockLLM) Call(_ context.Context, prompt string, _ ...llms.CallOption) (string, error) {
-	m.lastPrompt = prompt
-	return "test response", nil
+func (m *mockLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
 }
 
 func (m *mockLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
-	m.lastPrompt = messages[0].Parts[0].(llms.TextContent).Text
+	m.mu.Lock()
+	m.calls++
+	call := m.calls
+	m.lastParts = messages[0].Parts
+	for _, part := range messages[0].Parts {
+		if text, ok := part.(llms.TextContent); ok {
+			m.lastPrompt = text.Text
+			break
+		}
+	}
+	response, err, respond := m.response, m.err, m.respond
+	m.mu.Unlock()
+
+	if respond != nil {
+		response, err = respond(ctx, call, messages[0].Parts)
+	} else if response == "" {
+		response = "test response"
+	}
+	if err != nil {
+		return nil, err
+	}
 	return &llms.ContentResponse{
 		Choices: []*llms.ContentChoice{
 			{
-				Content: "test response",
+				Content: response,
 			},
 		},
 	}, nil
@@ -266,6 +296,174 @@ func TestTokenLimitInTitleGeneration(t *testing.T) {
 	// Final prompt should be within token limit
 	assert.LessOrEqual(t, len(tokens), 50, "Final prompt should be within token limit")
 }
+
+func TestGetSuggestedStoragePath(t *testing.T) {
+	testLogger := logrus.WithField("test", "test")
+
+	// Disable the token limit left over by other tests
+	originalLimit := tokenLimit
+	defer func() { tokenLimit = originalLimit }()
+	tokenLimit = 0
+
+	var err error
+	storagePathTemplate, err = template.New("storage_path").Parse(defaultStoragePathTemplate)
+	require.NoError(t, err)
+
+	mockLLM := &mockLLM{response: "<think>Taxes or home?</think> \"taxes\""}
+	app := &App{
+		LLM: mockLLM,
+	}
+
+	availableStoragePaths := []StoragePath{
+		{ID: 1, Name: "Home", Path: "home/{{ title }}"},
+		{ID: 2, Name: "Taxes", Path: "taxes/{{ created_year }}/{{ title }}"},
+	}
+
+	ctx := context.Background()
+	storagePath, err := app.getSuggestedStoragePath(ctx, "Tax assessment 2024", "Tax assessment", availableStoragePaths, testLogger)
+	require.NoError(t, err)
+	assert.Equal(t, "Taxes", storagePath)
+	assert.Contains(t, mockLLM.lastPrompt, "- Taxes (path template: taxes/{{ created_year }}/{{ title }})")
+
+	// Storage paths that do not exist are ignored
+	mockLLM.response = "Unknown"
+	storagePath, err = app.getSuggestedStoragePath(ctx, "Tax assessment 2024", "Tax assessment", availableStoragePaths, testLogger)
+	require.NoError(t, err)
+	assert.Empty(t, storagePath)
+}
+
+func TestGenerateDocumentSuggestions_Combined(t *testing.T) {
+	// Disable the token limit left over by other tests
+	originalLimit := tokenLimit
+	defer func() { tokenLimit = originalLimit }()
+	tokenLimit = 0
+
+	originalCombined := useCombinedSuggestions
+	defer func() { useCombinedSuggestions = originalCombined }()
+	useCombinedSuggestions = true
+
+	var err error
+	combinedTemplate, err = template.New("combined").Funcs(sprig.FuncMap()).Parse(defaultCombinedTemplate)
+	require.NoError(t, err)
+	titleTemplate, err = template.New("title").Parse(testTitleTemplate)
+	require.NoError(t, err)
+
+	env := newTestEnv(t)
+	defer env.teardown()
+	env.setMockResponse("/api/tags/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"results": [{"id": 1, "name": "finance"}, {"id": 2, "name": "insurance"}]}`))
+	})
+
+	suggestionRequest := GenerateSuggestionsRequest{
+		Documents:             []Document{{ID: 1, Title: "scan_001", Content: "Invoice from ACME dated 2024-03-01", Tags: []string{"insurance"}}},
+		GenerateTitles:        true,
+		GenerateTags:          true,
+		GenerateDocumentTypes: true,
+		GenerateCreatedDate:   true,
+	}
+
+	t.Run("valid JSON uses a single call", func(t *testing.T) {
+		mockLLM := &mockLLM{response: "```json\n" + `{"title": "ACME Invoice", "tags": ["finance", "unknown"], "document_type": "invoice", "created_date": "2024-03-01"}` + "\n```"}
+		app := &App{Client: env.client, LLM: mockLLM}
+
+		suggestions, err := app.generateDocumentSuggestions(context.Background(), suggestionRequest, logrus.WithField("test", "test"))
+		require.NoError(t, err)
+		require.Len(t, suggestions, 1)
+
+		assert.Equal(t, 1, mockLLM.calls)
+		assert.Contains(t, mockLLM.lastPrompt, `"document_type"`)
+		assert.NotContains(t, mockLLM.lastPrompt, `"storage_path"`)
+		assert.Equal(t, "ACME Invoice", suggestions[0].SuggestedTitle)
+		// Unknown tags are dropped and original tags are kept
+		assert.ElementsMatch(t, []string{"finance", "insurance"}, suggestions[0].SuggestedTags)
+		assert.Equal(t, "Invoice", suggestions[0].SuggestedDocumentType)
+		assert.Equal(t, "2024-03-01", suggestions[0].SuggestedCreatedDate)
+	})
+
+	t.Run("invalid JSON falls back to separate calls", func(t *testing.T) {
+		mockLLM := &mockLLM{response: "ACME Invoice"}
+		app := &App{Client: env.client, LLM: mockLLM}
+
+		titleOnly := GenerateSuggestionsRequest{
+			Documents:      suggestionRequest.Documents,
+			GenerateTitles: true,
+		}
+		suggestions, err := app.generateDocumentSuggestions(context.Background(), titleOnly, logrus.WithField("test", "test"))
+		require.NoError(t, err)
+		require.Len(t, suggestions, 1)
+
+		assert.Equal(t, 2, mockLLM.calls)
+		assert.Equal(t, "ACME Invoice", suggestions[0].SuggestedTitle)
+	})
+}
+
+func TestValidateCombinedSuggestions(t *testing.T) {
+	suggestionRequest := GenerateSuggestionsRequest{
+		GenerateTitles:       true,
+		GenerateTags:         true,
+		GenerateCustomFields: true,
+	}
+
+	tests := []struct {
+		name     string
+		response string
+		wantErr  bool
+	}{
+		{name: "valid", response: `{"title": "Invoice", "tags": ["finance"], "custom_fields": {"Total": "EUR12.00"}}`},
+		{name: "extra keys are ignored", response: `{"title": "Invoice", "tags": [], "custom_fields": {}, "correspondent": "ACME"}`},
+		{name: "missing key", response: `{"title": "Invoice", "tags": ["finance"]}`, wantErr: true},
+		{name: "null value", response: `{"title": "Invoice", "tags": null, "custom_fields": {}}`, wantErr: true},
+		{name: "wrong type", response: `{"title": "Invoice", "tags": "finance", "custom_fields": {}}`, wantErr: true},
+		{name: "empty title", response: `{"title": " ", "tags": [], "custom_fields": {}}`, wantErr: true},
+		{name: "no JSON", response: "Invoice", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := validateCombinedSuggestions(tc.response, suggestionRequest, true)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseSuggestedCreatedDate(t *testing.T) {
+	now := time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		response string
+		expected string
+		wantErr  bool
+	}{
+		{name: "ISO date", response: "2024-03-01", expected: "2024-03-01"},
+		{name: "quoted with whitespace", response: "  \"2024-03-01\"\n", expected: "2024-03-01"},
+		{name: "today", response: "2024-06-15", expected: "2024-06-15"},
+		{name: "unknown", response: "Unknown", expected: ""},
+		{name: "future date", response: "2024-06-16", wantErr: true},
+		{name: "too old", response: "1899-12-31", wantErr: true},
+		{name: "not ISO", response: "01.03.2024", wantErr: true},
+		{name: "invalid day", response: "2024-02-30", wantErr: true},
+		{name: "sentence", response: "The document is dated 2024-03-01", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := parseSuggestedCreatedDate(tc.response, now)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
 func TestStripReasoning(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Kinds of background processing whose failures are tracked per document
+const (
+	autoFailureKindTag = "auto_tag"
+	autoFailureKindOCR = "auto_ocr"
+)
+
+// failedDocument is a document that failed in the current run of a background processing loop
+type failedDocument struct {
+	document Document
+	err      error
+}
+
+// processAutoBatch processes the documents of one run of a background loop one by one, so that a
+// failing document does not block the others. Failures are counted per document and a document
+// that failed autoMaxFailures times in a row is moved from sourceTag to autoFailedTag.
+//
+// If no document of the batch succeeded and all errors are transient, the backend is most likely
+// down. The failures are then not counted against the documents and an error is returned, so that
+// the loop backs off instead of quarantining every document during an outage.
+func (app *App) processAutoBatch(ctx context.Context, kind, sourceTag string, documents []Document, process func(document Document, logger *logrus.Entry) error) (int, error) {
+	var failed []failedDocument
+	succeeded := 0
+
+	for _, document := range documents {
+		if err := app.runAutoProcess(kind, document, process); err != nil {
+			failed = append(failed, failedDocument{document: document, err: err})
+			continue
+		}
+		succeeded++
+	}
+
+	if len(failed) == 0 {
+		return succeeded, nil
+	}
+
+	if succeeded == 0 && allTransientFailures(failed) {
+		return 0, fmt.Errorf("all %d documents failed with transient errors, last error: %w", len(failed), failed[len(failed)-1].err)
+	}
+
+	quarantined := 0
+	var errs []error
+	for _, f := range failed {
+		isQuarantined, err := app.recordAutoFailure(ctx, kind, sourceTag, f.document, f.err)
+		if err != nil {
+			documentLogger(f.document.ID).Errorf("Error recording failure: %v", err)
+		}
+		if isQuarantined {
+			quarantined++
+		}
+		errs = append(errs, fmt.Errorf("document %d: %w", f.document.ID, f.err))
+	}
+
+	if succeeded == 0 && quarantined == 0 {
+		return 0, fmt.Errorf("all %d documents failed: %w", len(failed), errors.Join(errs...))
+	}
+	return succeeded + quarantined, nil
+}
+
+// processAutoDocument processes a single document outside of a batch, like a document sent by the
+// webhook. One document can't tell a backend outage from a broken document, so a failure is always
+// counted against it. It reports whether the document succeeded; errors are only logged, so that
+// one document doesn't make the background loop back off.
+func (app *App) processAutoDocument(ctx context.Context, kind, sourceTag string, document Document, process func(document Document, logger *logrus.Entry) error) bool {
+	cause := app.runAutoProcess(kind, document, process)
+	if cause == nil {
+		return true
+	}
+	if _, err := app.recordAutoFailure(ctx, kind, sourceTag, document, cause); err != nil {
+		documentLogger(document.ID).Errorf("Error recording failure: %v", err)
+	}
+	return false
+}
+
+// runAutoProcess processes a document, publishes its events and resets its failure count on success
+func (app *App) runAutoProcess(kind string, document Document, process func(document Document, logger *logrus.Entry) error) error {
+	docLogger := documentLogger(document.ID)
+	eventBus.Publish(eventAutoProcessing, AutoProcessingEvent{DocumentID: document.ID, Kind: kind, Status: "started"})
+	if err := process(document, docLogger); err != nil {
+		docLogger.Errorf("Error processing document: %v", err)
+		eventBus.Publish(eventAutoProcessing, AutoProcessingEvent{DocumentID: document.ID, Kind: kind, Status: "failed", Error: err.Error()})
+		return err
+	}
+
+	eventBus.Publish(eventAutoProcessing, AutoProcessingEvent{DocumentID: document.ID, Kind: kind, Status: "succeeded"})
+	if err := ClearDocumentFailures(app.Database, uint(document.ID), kind); err != nil {
+		docLogger.Warnf("Error clearing failure count: %v", err)
+	}
+	return nil
+}
+
+// allTransientFailures reports whether all failures look like a temporary problem of the backends.
+// Only errors that match network errors, 408, 429 or 5xx count, any other error is counted against the document.
+func allTransientFailures(failed []failedDocument) bool {
+	for _, f := range failed {
+		if !isTransientLLMError(f.err, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordAutoFailure counts a failure of a document and quarantines the document once it
+// reached autoMaxFailures. It reports whether the document was quarantined.
+func (app *App) recordAutoFailure(ctx context.Context, kind, sourceTag string, document Document, cause error) (bool, error) {
+	docLogger := documentLogger(document.ID)
+
+	failure, err := RecordDocumentFailure(app.Database, uint(document.ID), kind, cause.Error())
+	if err != nil {
+		return false, err
+	}
+	if failure.Attempts < autoMaxFailures {
+		docLogger.Warnf("Document failed %d of %d times, it will be retried", failure.Attempts, autoMaxFailures)
+		return false, nil
+	}
+
+	if err := app.quarantineDocument(ctx, document, sourceTag, failure); err != nil {
+		return false, fmt.Errorf("error moving document to tag %s: %w", autoFailedTag, err)
+	}
+	eventBus.Publish(eventAutoProcessing, AutoProcessingEvent{DocumentID: document.ID, Kind: kind, Status: "quarantined", Error: failure.LastError})
+
+	// Start counting from scratch if the document is tagged again
+	if err := ClearDocumentFailures(app.Database, uint(document.ID), kind); err != nil {
+		docLogger.Warnf("Error clearing failure count: %v", err)
+	}
+	return true, nil
+}
+
+// quarantineDocument replaces sourceTag with autoFailedTag and attaches the last error as a note
+func (app *App) quarantineDocument(ctx context.Context, document Document, sourceTag string, failure *DocumentFailure) error {
+	docLogger := documentLogger(document.ID)
+
+	if _, err := app.Client.CreateOrGetTag(ctx, autoFailedTag); err != nil {
+		return err
+	}
+
+	tags := append(removeTagFromList(document.Tags, sourceTag), autoFailedTag)
+	err := app.Client.UpdateDocuments(ctx, []DocumentSuggestion{
+		{
+			ID:               document.ID,
+			OriginalDocument: document,
+			SuggestedTags:    tags,
+			RemoveTags:       []string{sourceTag},
+		},
+	}, app.Database, false)
+	if err != nil {
+		return err
+	}
+	docLogger.Warnf("Document failed %d times, moved it from tag %s to %s", failure.Attempts, sourceTag, autoFailedTag)
+
+	note := fmt.Sprintf("paperless-gpt moved this document from tag %s to %s after %d failed attempts.\n\nLast error: %s",
+		sourceTag, autoFailedTag, failure.Attempts, failure.LastError)
+	if err := app.Client.AddDocumentNote(ctx, document.ID, note); err != nil {
+		docLogger.Errorf("Error adding failure note: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// poisonResponse returns a respond function for mockLLM that fails with err for prompts containing "poison"
+func poisonResponse(err error) func(context.Context, int, []llms.ContentPart) (string, error) {
+	return func(_ context.Context, _ int, parts []llms.ContentPart) (string, error) {
+		if strings.Contains(parts[0].(llms.TextContent).Text, "poison") {
+			return "", err
+		}
+		return "New Title", nil
+	}
+}
+
+// setupAutoTagTest configures the auto-tagging settings and a paperless mock with two tagged documents
+func setupAutoTagTest(t *testing.T) (*testEnv, map[int][]interface{}, *[]string) {
+	originalLimit, originalMaxFailures := tokenLimit, autoMaxFailures
+	originalTags, originalCorrespondents := autoGenerateTags, autoGenerateCorrespondents
+	originalAutoTag, originalFailedTag := autoTag, autoFailedTag
+	t.Cleanup(func() {
+		tokenLimit, autoMaxFailures = originalLimit, originalMaxFailures
+		autoGenerateTags, autoGenerateCorrespondents = originalTags, originalCorrespondents
+		autoTag, autoFailedTag = originalAutoTag, originalFailedTag
+	})
+	tokenLimit = 0
+	autoMaxFailures = 2
+	autoGenerateTags, autoGenerateCorrespondents = "false", "false"
+	autoTag, autoFailedTag = "paperless-gpt-auto", "paperless-gpt-failed"
+
+	var err error
+	titleTemplate, err = template.New("title").Parse(testTitleTemplate)
+	require.NoError(t, err)
+
+	env := newTestEnv(t)
+	t.Cleanup(env.teardown)
+	require.NoError(t, env.db.Where("1 = 1").Delete(&DocumentFailure{}).Error)
+
+	tags := []map[string]interface{}{{"id": 1, "name": "paperless-gpt-auto"}, {"id": 2, "name": "finance"}}
+	env.setMockResponse("/api/tags/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			var tag map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&tag))
+			tags = append(tags, map[string]interface{}{"id": 9, "name": tag["name"]})
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 9}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": tags})
+	})
+	env.setMockResponse("/api/documents/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"results": [
+			{"id": 1, "title": "scan_001", "content": "poison", "tags": [1, 2]},
+			{"id": 2, "title": "scan_002", "content": "Invoice from ACME", "tags": [1]}
+		]}`))
+	})
+
+	updatedTags := make(map[int][]interface{})
+	for _, id := range []int{1, 2} {
+		id := id
+		env.setMockResponse(fmt.Sprintf("/api/documents/%d/", id), func(w http.ResponseWriter, r *http.Request) {
+			var fields map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&fields))
+			updatedTags[id] = fields["tags"].([]interface{})
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+
+	var notes []string
+	env.setMockResponse("/api/documents/1/notes/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		body, _ := io.ReadAll(r.Body)
+		var note map[string]string
+		require.NoError(t, json.Unmarshal(body, &note))
+		notes = append(notes, note["note"])
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`[]`))
+	})
+
+	return env, updatedTags, &notes
+}
+
+func TestProcessAutoTagDocuments_QuarantinesFailingDocument(t *testing.T) {
+	env, updatedTags, notes := setupAutoTagTest(t)
+	app := &App{
+		Client:   env.client,
+		Database: env.db,
+		LLM:      &mockLLM{respond: poisonResponse(errors.New("API returned unexpected status code: 400: content policy violation"))},
+	}
+
+	// The failing document does not block the other one and is retried
+	count, err := app.processAutoTagDocuments()
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.NotContains(t, updatedTags, 1)
+	assert.Equal(t, []interface{}{}, updatedTags[2])
+
+	var failure DocumentFailure
+	require.NoError(t, env.db.Where("document_id = ? AND kind = ?", 1, autoFailureKindTag).First(&failure).Error)
+	assert.Equal(t, 1, failure.Attempts)
+	assert.Contains(t, failure.LastError, "content policy violation")
+
+	// After the second failure the document is moved to the failed tag
+	count, err = app.processAutoTagDocuments()
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.ElementsMatch(t, []interface{}{float64(2), float64(9)}, updatedTags[1])
+	require.Len(t, *notes, 1)
+	assert.Contains(t, (*notes)[0], "after 2 failed attempts")
+	assert.Contains(t, (*notes)[0], "content policy violation")
+
+	var remaining int64
+	env.db.Model(&DocumentFailure{}).Count(&remaining)
+	assert.Zero(t, remaining)
+}
+
+func TestProcessAutoTagDocuments_Outage(t *testing.T) {
+	env, updatedTags, notes := setupAutoTagTest(t)
+	autoMaxFailures = 1
+	app := &App{
+		Client:   env.client,
+		Database: env.db,
+		LLM:      &mockLLM{err: errors.New("dial tcp 127.0.0.1:11434: connection refused")},
+	}
+
+	// When every document fails with a transient error nothing is counted or quarantined
+	count, err := app.processAutoTagDocuments()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "transient")
+	assert.Zero(t, count)
+	assert.Empty(t, updatedTags)
+	assert.Empty(t, *notes)
+
+	var failures int64
+	env.db.Model(&DocumentFailure{}).Count(&failures)
+	assert.Zero(t, failures)
+}
+
+func TestProcessAutoTagDocuments_PermanentErrorForAllDocuments(t *testing.T) {
+	env, updatedTags, _ := setupAutoTagTest(t)
+	env.setMockResponse("/api/documents/2/notes/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`[]`))
+	})
+	app := &App{
+		Client:   env.client,
+		Database: env.db,
+		LLM:      &mockLLM{err: errors.New("error parsing JSON")},
+	}
+
+	// Errors that are not known to be transient are counted, even if every document fails
+	count, err := app.processAutoTagDocuments()
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "transient")
+	assert.Zero(t, count)
+
+	var failures int64
+	env.db.Model(&DocumentFailure{}).Where("kind = ? AND attempts = 1", autoFailureKindTag).Count(&failures)
+	assert.Equal(t, int64(2), failures)
+
+	// So the documents are quarantined instead of blocking the loop forever
+	count, err = app.processAutoTagDocuments()
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Contains(t, updatedTags[1], float64(9))
+	assert.Contains(t, updatedTags[2], float64(9))
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Strategies for content that exceeds TOKEN_LIMIT, selected by CONTENT_STRATEGY
+const (
+	contentStrategyTruncate  = "truncate"
+	contentStrategyMapReduce = "map_reduce"
+)
+
+// maxCondenseRounds limits how often condensed content is condensed again before it is truncated
+const maxCondenseRounds = 3
+
+// condensedTokenBudget returns the number of tokens condensed content may use,
+// leaving the rest of TOKEN_LIMIT for the prompt templates and their tag or correspondent lists
+func condensedTokenBudget() int {
+	return tokenLimit / 2
+}
+
+// splitContentByTokens splits content into chunks of at most chunkTokens tokens,
+// preferring to cut at line breaks or spaces
+func splitContentByTokens(content string, chunkTokens int) ([]string, error) {
+	if chunkTokens <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive, got %d", chunkTokens)
+	}
+
+	var chunks []string
+	remaining := content
+	for strings.TrimSpace(remaining) != "" {
+		chunk, err := truncateContentByTokens(remaining, chunkTokens)
+		if err != nil {
+			return nil, err
+		}
+		if chunk == "" {
+			return nil, fmt.Errorf("chunk size of %d tokens is too small to split content", chunkTokens)
+		}
+
+		// Cut at a natural boundary if one exists in the second half of the chunk
+		if len(chunk) < len(remaining) {
+			if cut := strings.LastIndex(chunk, "\n"); cut > len(chunk)/2 {
+				chunk = chunk[:cut+1]
+			} else if cut := strings.LastIndex(chunk, " "); cut > len(chunk)/2 {
+				chunk = chunk[:cut+1]
+			}
+		}
+
+		if trimmed := strings.TrimSpace(chunk); trimmed != "" {
+			chunks = append(chunks, trimmed)
+		}
+		remaining = remaining[len(chunk):]
+	}
+
+	return chunks, nil
+}
+
+// condenseContent shrinks content to at most targetTokens tokens with a map-reduce pass:
+// the content is split into chunks that fit the summary prompt, every chunk is condensed by the LLM
+// and the results are joined. This is repeated while the joined text is still too long.
+func (app *App) condenseContent(ctx context.Context, content string, targetTokens int, logger *logrus.Entry) (string, error) {
+	if tokenLimit <= 0 {
+		return content, nil
+	}
+
+	for round := 1; ; round++ {
+		contentTokens, err := getTokenCount(content)
+		if err != nil {
+			return "", fmt.Errorf("error counting tokens: %v", err)
+		}
+		if contentTokens <= targetTokens {
+			return content, nil
+		}
+		if round > maxCondenseRounds {
+			logger.Warnf("Content still has %d tokens after %d condense rounds, truncating to %d tokens", contentTokens, maxCondenseRounds, targetTokens)
+			return truncateContentByTokens(content, targetTokens)
+		}
+
+		chunkTokens, err := getSummaryChunkTokens()
+		if err != nil {
+			return "", err
+		}
+
+		chunks, err := splitContentByTokens(content, chunkTokens)
+		if err != nil {
+			return "", fmt.Errorf("error splitting content: %v", err)
+		}
+		logger.Debugf("Condensing %d tokens in %d chunks (round %d)", contentTokens, len(chunks), round)
+
+		condensedChunks := make([]string, 0, len(chunks))
+		for i, chunk := range chunks {
+			condensed, err := app.condenseChunk(ctx, chunk, logger)
+			if err != nil {
+				return "", fmt.Errorf("error condensing chunk %d of %d: %v", i+1, len(chunks), err)
+			}
+			condensedChunks = append(condensedChunks, condensed)
+		}
+		content = strings.Join(condensedChunks, "\n\n")
+	}
+}
+
+// getSummaryChunkTokens returns how many content tokens fit into a single summary prompt
+func getSummaryChunkTokens() (int, error) {
+	templateMutex.RLock()
+	defer templateMutex.RUnlock()
+
+	chunkTokens, err := getAvailableTokensForContent(summaryTemplate, map[string]interface{}{
+		"Language": getLikelyLanguage(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error calculating available tokens for summary: %v", err)
+	}
+	return chunkTokens, nil
+}
+
+// condenseChunk asks the LLM to condense a single chunk of content
+func (app *App) condenseChunk(ctx context.Context, chunk string, logger *logrus.Entry) (string, error) {
+	templateMutex.RLock()
+	defer templateMutex.RUnlock()
+
+	var promptBuffer bytes.Buffer
+	err := summaryTemplate.Execute(&promptBuffer, map[string]interface{}{
+		"Language": getLikelyLanguage(),
+		"Content":  chunk,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error executing summary template: %v", err)
+	}
+
+	prompt := promptBuffer.String()
+	logger.Debugf("Summary prompt: %s", prompt)
+
+	completion, err := app.LLM.GenerateContent(ctx, []llms.MessageContent{
+		{
+			Parts: []llms.ContentPart{
+				llms.TextContent{
+					Text: prompt,
+				},
+			},
+			Role: llms.ChatMessageTypeHuman,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting response from LLM: %v", err)
+	}
+
+	return strings.TrimSpace(stripReasoning(completion.Choices[0].Content)), nil
+}
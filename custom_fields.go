@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// customFieldModPrefix prefixes the ModField of modification records for custom fields, e.g. "custom_field:Invoice Total"
+const customFieldModPrefix = "custom_field:"
+
+// supportedCustomFieldTypes lists the paperless-ngx custom field data types that can be extracted by the LLM
+var supportedCustomFieldTypes = []string{"string", "url", "date", "boolean", "integer", "float", "monetary"}
+
+// monetaryPattern matches paperless-ngx monetary values like "EUR12.50" or "12.50"
+var monetaryPattern = regexp.MustCompile(`^([A-Z]{3})?(-?\d+(?:\.\d{1,2})?)$`)
+
+// isSupportedCustomFieldType reports whether values of the given data type can be extracted
+func isSupportedCustomFieldType(dataType string) bool {
+	for _, supported := range supportedCustomFieldTypes {
+		if dataType == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCustomFieldValue validates a raw value against a custom field data type and
+// normalises it to the representation expected by the paperless-ngx API
+func parseCustomFieldValue(dataType string, raw interface{}) (interface{}, error) {
+	// Accept numbers and booleans given as strings, since LLMs frequently quote them
+	str, isString := raw.(string)
+	if isString {
+		str = strings.TrimSpace(str)
+		if str == "" {
+			return nil, fmt.Errorf("empty value")
+		}
+	}
+
+	switch dataType {
+	case "string":
+		if !isString {
+			return nil, fmt.Errorf("expected a string, got %T", raw)
+		}
+		if len([]rune(str)) > 128 {
+			str = string([]rune(str)[:128])
+		}
+		return str, nil
+
+	case "longtext":
+		// Not extracted by the LLM, but written by OCR_LINE_ITEMS and restored by undo
+		if !isString {
+			return nil, fmt.Errorf("expected a string, got %T", raw)
+		}
+		return str, nil
+
+	case "url":
+		if !isString {
+			return nil, fmt.Errorf("expected a URL string, got %T", raw)
+		}
+		parsed, err := url.ParseRequestURI(str)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid URL: %q", str)
+		}
+		return str, nil
+
+	case "date":
+		if !isString {
+			return nil, fmt.Errorf("expected a date string, got %T", raw)
+		}
+		parsed, err := time.Parse("2006-01-02", str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", str)
+		}
+		return parsed.Format("2006-01-02"), nil
+
+	case "boolean":
+		switch v := raw.(type) {
+		case bool:
+			return v, nil
+		case string:
+			parsed, err := strconv.ParseBool(strings.ToLower(str))
+			if err != nil {
+				return nil, fmt.Errorf("invalid boolean %q", str)
+			}
+			return parsed, nil
+		}
+		return nil, fmt.Errorf("expected a boolean, got %T", raw)
+
+	case "integer":
+		switch v := raw.(type) {
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("expected an integer, got %v", v)
+			}
+			return int(v), nil
+		case string:
+			parsed, err := strconv.Atoi(str)
+			if err != nil {
+				return nil, fmt.Errorf("invalid integer %q", str)
+			}
+			return parsed, nil
+		}
+		return nil, fmt.Errorf("expected an integer, got %T", raw)
+
+	case "float":
+		switch v := raw.(type) {
+		case float64:
+			return v, nil
+		case string:
+			parsed, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", str)
+			}
+			return parsed, nil
+		}
+		return nil, fmt.Errorf("expected a number, got %T", raw)
+
+	case "monetary":
+		switch v := raw.(type) {
+		case float64:
+			return fmt.Sprintf("%.2f", v), nil
+		case string:
+			matches := monetaryPattern.FindStringSubmatch(strings.ReplaceAll(str, " ", ""))
+			if matches == nil {
+				return nil, fmt.Errorf("invalid monetary value %q, expected e.g. EUR12.50", str)
+			}
+			amount, err := strconv.ParseFloat(matches[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid monetary value %q", str)
+			}
+			return fmt.Sprintf("%s%.2f", matches[1], amount), nil
+		}
+		return nil, fmt.Errorf("expected a monetary value, got %T", raw)
+	}
+
+	return nil, fmt.Errorf("unsupported custom field data type: %s", dataType)
+}
+
+// extractJSONObject returns the outermost JSON object of an LLM response, tolerating code fences or surrounding text
+func extractJSONObject(response string) (string, error) {
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start == -1 || end < start {
+		return "", fmt.Errorf("no JSON object found in response")
+	}
+	return response[start : end+1], nil
+}
+
+// parseCustomFieldsResponse parses the JSON object returned by the LLM and validates each value
+// against its custom field definition. Invalid or missing values are skipped.
+func parseCustomFieldsResponse(response string, customFields []CustomField) ([]CustomFieldSuggestion, error) {
+	jsonObject, err := extractJSONObject(response)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(jsonObject), &values); err != nil {
+		return nil, fmt.Errorf("error parsing custom fields JSON: %v", err)
+	}
+
+	return validateCustomFieldValues(values, customFields), nil
+}
+
+// validateCustomFieldValues validates the extracted values against their custom field definitions.
+// Invalid or missing values are skipped.
+func validateCustomFieldValues(values map[string]interface{}, customFields []CustomField) []CustomFieldSuggestion {
+	suggestions := []CustomFieldSuggestion{}
+	for _, customField := range customFields {
+		raw, exists := values[customField.Name]
+		if !exists || raw == nil {
+			continue
+		}
+
+		value, err := parseCustomFieldValue(customField.DataType, raw)
+		if err != nil {
+			log.Warnf("Ignoring value for custom field '%s': %v", customField.Name, err)
+			continue
+		}
+
+		suggestions = append(suggestions, CustomFieldSuggestion{
+			ID:       customField.ID,
+			Name:     customField.Name,
+			DataType: customField.DataType,
+			Value:    value,
+		})
+	}
+
+	return suggestions
+}
+
+// mergeCustomFields applies the suggested values on top of the document's current custom fields
+func mergeCustomFields(original []CustomFieldValue, suggestions []CustomFieldSuggestion) []CustomFieldValue {
+	merged := make([]CustomFieldValue, len(original))
+	copy(merged, original)
+
+	for _, suggestion := range suggestions {
+		found := false
+		for i := range merged {
+			if merged[i].Field == suggestion.ID {
+				merged[i].Value = suggestion.Value
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, CustomFieldValue{Field: suggestion.ID, Value: suggestion.Value})
+		}
+	}
+
+	return merged
+}
+
+// customFieldValueString formats a custom field value for the modification history, with "" for no value
+func customFieldValueString(customFields []CustomFieldValue, fieldID int) string {
+	for _, customField := range customFields {
+		if customField.Field == fieldID {
+			return formatCustomFieldValue(customField.Value)
+		}
+	}
+	return ""
+}
+
+// formatCustomFieldValue formats a single custom field value so that parseCustomFieldValue can read it back,
+// with "" for no value. Numbers from JSON are float64 and must not be written in exponent notation.
+func formatCustomFieldValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// removeCustomField returns the custom fields of a document without the given field
+func removeCustomField(customFields []CustomFieldValue, fieldID int) []CustomFieldValue {
+	remaining := make([]CustomFieldValue, 0, len(customFields))
+	for _, customField := range customFields {
+		if customField.Field != fieldID {
+			remaining = append(remaining, customField)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCustomFieldValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		dataType string
+		raw      interface{}
+		expected interface{}
+		wantErr  bool
+	}{
+		{name: "string", dataType: "string", raw: " INV-2024-001 ", expected: "INV-2024-001"},
+		{name: "string not a string", dataType: "string", raw: 12.0, wantErr: true},
+		{name: "url", dataType: "url", raw: "https://example.com/invoice", expected: "https://example.com/invoice"},
+		{name: "url without scheme", dataType: "url", raw: "example.com", wantErr: true},
+		{name: "date", dataType: "date", raw: "2024-03-01", expected: "2024-03-01"},
+		{name: "date in other format", dataType: "date", raw: "01.03.2024", wantErr: true},
+		{name: "boolean", dataType: "boolean", raw: true, expected: true},
+		{name: "boolean as string", dataType: "boolean", raw: "False", expected: false},
+		{name: "integer", dataType: "integer", raw: 42.0, expected: 42},
+		{name: "integer as string", dataType: "integer", raw: "42", expected: 42},
+		{name: "integer with fraction", dataType: "integer", raw: 42.5, wantErr: true},
+		{name: "float", dataType: "float", raw: "3.14", expected: 3.14},
+		{name: "monetary with currency", dataType: "monetary", raw: "EUR 1234.5", expected: "EUR1234.50"},
+		{name: "monetary as number", dataType: "monetary", raw: 99.0, expected: "99.00"},
+		{name: "monetary with comma", dataType: "monetary", raw: "1.234,50 €", wantErr: true},
+		{name: "empty string", dataType: "string", raw: "  ", wantErr: true},
+		{name: "unsupported type", dataType: "documentlink", raw: "1", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := parseCustomFieldValue(tc.dataType, tc.raw)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, value)
+		})
+	}
+}
+
+func TestParseCustomFieldsResponse(t *testing.T) {
+	customFields := []CustomField{
+		{ID: 1, Name: "Invoice Total", DataType: "monetary"},
+		{ID: 2, Name: "Due Date", DataType: "date"},
+		{ID: 3, Name: "IBAN", DataType: "string"},
+		{ID: 4, Name: "Paid", DataType: "boolean"},
+	}
+
+	response := "```json\n" + `{"Invoice Total": "EUR120.5", "Due Date": "next week", "IBAN": "DE89 3704 0044 0532 0130 00", "Paid": null}` + "\n```"
+
+	suggestions, err := parseCustomFieldsResponse(response, customFields)
+	require.NoError(t, err)
+
+	// The invalid date and the null value are dropped
+	expected := []CustomFieldSuggestion{
+		{ID: 1, Name: "Invoice Total", DataType: "monetary", Value: "EUR120.50"},
+		{ID: 3, Name: "IBAN", DataType: "string", Value: "DE89 3704 0044 0532 0130 00"},
+	}
+	assert.Equal(t, expected, suggestions)
+
+	_, err = parseCustomFieldsResponse("I could not find any values.", customFields)
+	assert.Error(t, err)
+}
+
+func TestMergeCustomFields(t *testing.T) {
+	original := []CustomFieldValue{
+		{Field: 1, Value: "EUR10.00"},
+		{Field: 5, Value: "keep me"},
+	}
+	suggestions := []CustomFieldSuggestion{
+		{ID: 1, Value: "EUR12.00"},
+		{ID: 2, Value: "2024-03-01"},
+	}
+
+	merged := mergeCustomFields(original, suggestions)
+
+	assert.Equal(t, []CustomFieldValue{
+		{Field: 1, Value: "EUR12.00"},
+		{Field: 5, Value: "keep me"},
+		{Field: 2, Value: "2024-03-01"},
+	}, merged)
+	// The original slice must not be modified
+	assert.Equal(t, "EUR10.00", original[0].Value)
+}
+
+func TestCustomFieldValueString(t *testing.T) {
+	// Values as decoded from the paperless-ngx API
+	customFields := []CustomFieldValue{
+		{Field: 1, Value: float64(1500000)},
+		{Field: 2, Value: 12.5},
+		{Field: 3, Value: "EUR12.00"},
+		{Field: 4, Value: nil},
+	}
+
+	assert.Equal(t, "1500000", customFieldValueString(customFields, 1))
+	assert.Equal(t, "12.5", customFieldValueString(customFields, 2))
+	assert.Equal(t, "EUR12.00", customFieldValueString(customFields, 3))
+	assert.Equal(t, "", customFieldValueString(customFields, 4))
+	assert.Equal(t, "", customFieldValueString(customFields, 5))
+
+	// Large integers can be restored by undo
+	value, err := parseCustomFieldValue("integer", customFieldValueString(customFields, 1))
+	require.NoError(t, err)
+	assert.Equal(t, 1500000, value)
+}
+
+func TestUndoCustomFieldModification_RemovesField(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	env := newTestEnv(t)
+	defer env.teardown()
+
+	env.setMockResponse("/api/tags/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": []}`))
+	})
+	env.setMockResponse("/api/custom_fields/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [{"id": 3, "name": "Invoice Number", "data_type": "string"}]}`))
+	})
+	var patched map[string]interface{}
+	env.setMockResponse("/api/documents/7/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PATCH" {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&patched))
+		}
+		w.Write([]byte(`{"id": 7, "title": "Invoice", "custom_fields": [{"field": 3, "value": "INV-1"}, {"field": 5, "value": "keep me"}]}`))
+	})
+
+	modification := ModificationHistory{DocumentID: 7, ModField: customFieldModPrefix + "Invoice Number", NewValue: "INV-1"}
+	require.NoError(t, InsertModification(env.db, &modification))
+
+	app := &App{Client: env.client, Database: env.db}
+	router := gin.New()
+	router.POST("/api/undo-modification/:id", app.undoModificationHandler)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", fmt.Sprintf("/api/undo-modification/%d", modification.ID), nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// The field is removed instead of being set to null
+	assert.Equal(t, []interface{}{map[string]interface{}{"field": float64(5), "value": "keep me"}}, patched["custom_fields"])
+}
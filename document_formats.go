@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Decoders for the image originals
+	_ "image/png"
+	"net/http"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Content types of the files OCR can read
+const (
+	contentTypePDF  = "application/pdf"
+	contentTypeJPEG = "image/jpeg"
+	contentTypePNG  = "image/png"
+	contentTypeWebP = "image/webp"
+	contentTypeTIFF = "image/tiff"
+)
+
+// detectContentType returns the MIME type of a downloaded document file without parameters
+func detectContentType(data []byte) string {
+	// http.DetectContentType doesn't know TIFF
+	if bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")) {
+		return contentTypeTIFF
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	return contentType
+}
+
+// isOCRContentType reports whether pages can be rendered from files of the content type
+func isOCRContentType(contentType string) bool {
+	switch contentType {
+	case contentTypePDF, contentTypeTIFF, contentTypeJPEG, contentTypePNG, contentTypeWebP:
+		return true
+	}
+	return false
+}
+
+// isSinglePageImage reports whether files of the content type are a single image that is used
+// as it is instead of being rendered with MuPDF. MuPDF would scale photos by the resolution in
+// their metadata, which is often 72 DPI for photos taken with a phone.
+func isSinglePageImage(contentType string) bool {
+	return contentType == contentTypeJPEG || contentType == contentTypePNG || contentType == contentTypeWebP
+}
+
+// decodePageImage decodes a JPEG, PNG or WebP original and rotates JPEG photos upright
+// according to their EXIF orientation
+func decodePageImage(data []byte) (image.Image, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %w", err)
+	}
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	return img, nil
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG file from 1 to 8, 1 if it has none
+func jpegOrientation(data []byte) int {
+	const (
+		markerSOS          = 0xDA
+		markerAPP1         = 0xE1
+		orientationTag     = 0x0112
+		exifHeader         = "Exif\x00\x00"
+		defaultOrientation = 1
+	)
+
+	// Walk the segments up to the image data to find the EXIF segment
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == markerSOS {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+		segment := data[i+4 : i+2+length]
+		i += 2 + length
+		if marker != markerAPP1 || !bytes.HasPrefix(segment, []byte(exifHeader)) {
+			continue
+		}
+
+		// The EXIF data is a TIFF file, the orientation is a SHORT in its first IFD
+		tiff := segment[len(exifHeader):]
+		if len(tiff) < 8 {
+			return defaultOrientation
+		}
+		var order binary.ByteOrder
+		switch string(tiff[:2]) {
+		case "II":
+			order = binary.LittleEndian
+		case "MM":
+			order = binary.BigEndian
+		default:
+			return defaultOrientation
+		}
+		ifd := int(order.Uint32(tiff[4:]))
+		if ifd+2 > len(tiff) {
+			return defaultOrientation
+		}
+		entries := int(order.Uint16(tiff[ifd:]))
+		for e := 0; e < entries; e++ {
+			entry := ifd + 2 + 12*e
+			if entry+12 > len(tiff) {
+				break
+			}
+			if order.Uint16(tiff[entry:]) == orientationTag {
+				if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+					return orientation
+				}
+				break
+			}
+		}
+		return defaultOrientation
+	}
+	return defaultOrientation
+}
+
+// applyOrientation transforms an image with the EXIF orientation so that it is displayed upright
+func applyOrientation(src image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	img := toRGBA(src)
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		// Orientations 5 to 8 swap width and height
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // Rotated by 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // Transposed
+				sx, sy = y, x
+			case 6: // Needs a rotation by 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // Transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // Needs a rotation by 90° counterclockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], img.Pix[img.PixOffset(sx, sy):img.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTIFF encodes grayscale images as an uncompressed TIFF with one page per image
+func testTIFF(pages ...*image.Gray) []byte {
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	buf.WriteString("II")
+	binary.Write(&buf, le, uint16(42))
+	binary.Write(&buf, le, uint32(8))
+
+	for i, page := range pages {
+		width, height := page.Bounds().Dx(), page.Bounds().Dy()
+		ifdOffset := uint32(buf.Len())
+		const entries = 9
+		stripOffset := ifdOffset + 2 + entries*12 + 4
+
+		binary.Write(&buf, le, uint16(entries))
+		for _, entry := range [][3]uint32{
+			{256, 4, uint32(width)},  // ImageWidth
+			{257, 4, uint32(height)}, // ImageLength
+			{258, 3, 8},              // BitsPerSample
+			{259, 3, 1},              // Compression: none
+			{262, 3, 1},              // PhotometricInterpretation: black is zero
+			{273, 4, stripOffset},    // StripOffsets
+			{277, 3, 1},              // SamplesPerPixel
+			{278, 4, uint32(height)}, // RowsPerStrip
+			{279, 4, uint32(width * height)},
+		} {
+			binary.Write(&buf, le, uint16(entry[0]))
+			binary.Write(&buf, le, uint16(entry[1]))
+			binary.Write(&buf, le, uint32(1))
+			binary.Write(&buf, le, entry[2])
+		}
+		nextIFD := uint32(0)
+		if i < len(pages)-1 {
+			nextIFD = stripOffset + uint32(width*height)
+		}
+		binary.Write(&buf, le, nextIFD)
+		for y := 0; y < height; y++ {
+			buf.Write(page.Pix[y*page.Stride : y*page.Stride+width])
+		}
+	}
+	return buf.Bytes()
+}
+
+// testJPEGWithOrientation encodes a 40x20 image with a black left half as JPEG with an EXIF orientation
+func testJPEGWithOrientation(t *testing.T, orientation uint16) []byte {
+	img := image.NewGray(image.Rect(0, 0, 40, 20))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, 20, 20), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	var encoded bytes.Buffer
+	require.NoError(t, jpeg.Encode(&encoded, img, nil))
+
+	// A big endian TIFF with a single IFD entry for the orientation
+	var exif bytes.Buffer
+	exif.WriteString("Exif\x00\x00MM\x00*")
+	for _, value := range []any{uint32(8), uint16(1), uint16(0x0112), uint16(3), uint32(1), orientation, uint16(0), uint32(0)} {
+		require.NoError(t, binary.Write(&exif, binary.BigEndian, value))
+	}
+
+	var buf bytes.Buffer
+	buf.Write(encoded.Bytes()[:2])
+	buf.Write([]byte{0xFF, 0xE1})
+	binary.Write(&buf, binary.BigEndian, uint16(exif.Len()+2))
+	buf.Write(exif.Bytes())
+	buf.Write(encoded.Bytes()[2:])
+	return buf.Bytes()
+}
+
+func TestDetectContentType(t *testing.T) {
+	pdf, err := os.ReadFile("tests/pdf/sample.pdf")
+	require.NoError(t, err)
+	webp, err := os.ReadFile("tests/images/photo.webp")
+	require.NoError(t, err)
+	var pngBytes bytes.Buffer
+	require.NoError(t, png.Encode(&pngBytes, image.NewGray(image.Rect(0, 0, 10, 10))))
+
+	assert.Equal(t, contentTypePDF, detectContentType(pdf))
+	assert.Equal(t, contentTypeWebP, detectContentType(webp))
+	assert.Equal(t, contentTypePNG, detectContentType(pngBytes.Bytes()))
+	assert.Equal(t, contentTypeJPEG, detectContentType(testJPEGWithOrientation(t, 1)))
+	assert.Equal(t, contentTypeTIFF, detectContentType(testTIFF(image.NewGray(image.Rect(0, 0, 10, 10)))))
+	assert.Equal(t, "text/plain", detectContentType([]byte("plain text")))
+	assert.False(t, isOCRContentType("application/zip"))
+}
+
+func TestDecodePageImage_Orientation(t *testing.T) {
+	for _, tc := range []struct {
+		orientation uint16
+		size        image.Point
+		black       image.Point // A pixel of the black half
+		white       image.Point
+	}{
+		{orientation: 1, size: image.Pt(40, 20), black: image.Pt(5, 10), white: image.Pt(35, 10)},
+		{orientation: 3, size: image.Pt(40, 20), black: image.Pt(35, 10), white: image.Pt(5, 10)},
+		{orientation: 6, size: image.Pt(20, 40), black: image.Pt(10, 5), white: image.Pt(10, 35)},
+		{orientation: 8, size: image.Pt(20, 40), black: image.Pt(10, 35), white: image.Pt(10, 5)},
+	} {
+		img, err := decodePageImage(testJPEGWithOrientation(t, tc.orientation))
+		require.NoError(t, err)
+		assert.Equal(t, tc.size, img.Bounds().Size(), "orientation %d", tc.orientation)
+		assert.Equal(t, uint8(0), luminance(toRGBA(img), tc.black.X, tc.black.Y)/64, "orientation %d", tc.orientation)
+		assert.Equal(t, uint8(3), luminance(toRGBA(img), tc.white.X, tc.white.Y)/64, "orientation %d", tc.orientation)
+	}
+
+	// Broken EXIF data is ignored
+	assert.Equal(t, 1, jpegOrientation([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x10, 'E', 'x', 'i', 'f', 0, 0, 'M', 'M'}))
+}
+
+func TestDownloadDocumentAsImages_Formats(t *testing.T) {
+	pdf, err := os.ReadFile("tests/pdf/sample.pdf")
+	require.NoError(t, err)
+	webp, err := os.ReadFile("tests/images/photo.webp")
+	require.NoError(t, err)
+	var pngBytes bytes.Buffer
+	require.NoError(t, png.Encode(&pngBytes, testPage(300, 400)))
+	// MuPDF assumes 96 DPI for TIFFs without a resolution
+	landscape := image.NewGray(image.Rect(0, 0, 200, 100))
+	portrait := image.NewGray(image.Rect(0, 0, 100, 200))
+	docx := append([]byte("PK\x03\x04"), bytes.Repeat([]byte("word/document.xml"), 10)...)
+
+	for _, tc := range []struct {
+		name     string
+		original []byte
+		archive  []byte
+		sizes    []image.Point
+		err      string
+	}{
+		{name: "png", original: pngBytes.Bytes(), sizes: []image.Point{{300, 400}}},
+		{name: "jpeg photo", original: testJPEGWithOrientation(t, 6), sizes: []image.Point{{20, 40}}},
+		{name: "webp", original: webp, sizes: []image.Point{{150, 100}}},
+		{name: "multipage tiff", original: testTIFF(landscape, portrait), sizes: []image.Point{{625, 313}, {313, 625}}},
+		{name: "office document", original: docx, archive: pdf, sizes: []image.Point{{2481, 3508}}},
+		{name: "no archive version", original: docx, archive: docx, err: "application/zip"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			defer env.teardown()
+			env.client.CacheFolder = t.TempDir()
+
+			archiveRequested := false
+			env.setMockResponse("/api/documents/7/download/", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				if r.URL.Query().Get("original") == "false" {
+					archiveRequested = true
+					w.Write(tc.archive)
+					return
+				}
+				w.Write(tc.original)
+			})
+
+			imagePaths, err := env.client.DownloadDocumentAsImages(context.Background(), 7, allPages)
+			assert.Equal(t, tc.archive != nil, archiveRequested)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, imagePaths, len(tc.sizes))
+			for i, pageImage := range imagePaths {
+				f, err := os.Open(pageImage.Path)
+				require.NoError(t, err)
+				config, err := jpeg.DecodeConfig(f)
+				f.Close()
+				require.NoError(t, err)
+				assert.InDelta(t, tc.sizes[i].X, config.Width, 2, "page %d", i)
+				assert.InDelta(t, tc.sizes[i].Y, config.Height, 2, "page %d", i)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Types of the events published on the event bus
+const (
+	eventJob            = "job"             // An OCR job was added or changed its status
+	eventJobProgress    = "job_progress"    // An OCR job finished a page
+	eventAutoProcessing = "auto_processing" // A document was processed in the background
+	eventModification   = "modification"    // A modification was recorded in the history
+)
+
+// Event is a notification for the clients of the event stream
+type Event struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// JobEvent is the data of job and job_progress events
+type JobEvent struct {
+	JobID      string `json:"job_id"`
+	DocumentID int    `json:"document_id"`
+	Status     string `json:"status,omitempty"`
+	PagesDone  int    `json:"pages_done"`
+	TotalPages int    `json:"total_pages"`
+}
+
+// AutoProcessingEvent is the data of auto_processing events
+type AutoProcessingEvent struct {
+	DocumentID int    `json:"document_id"`
+	Kind       string `json:"kind"`   // "auto_tag" or "auto_ocr"
+	Status     string `json:"status"` // "started", "succeeded", "failed" or "quarantined"
+	Error      string `json:"error,omitempty"`
+}
+
+// EventBus distributes events to all subscribers. Publishing never blocks: events
+// for subscribers that don't keep up are dropped.
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[chan Event]struct{}
+}
+
+// eventBus is the event bus of the process, streamed to the web app by eventsHandler
+var eventBus = NewEventBus()
+
+// eventBufferSize is the number of events buffered for each subscriber
+const eventBufferSize = 64
+
+// eventHeartbeatInterval is the interval of the comments that keep idle event streams open
+const eventHeartbeatInterval = 30 * time.Second
+
+// NewEventBus creates an event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel that receives all events published from now on and a function to unsubscribe
+func (bus *EventBus) Subscribe() (<-chan Event, func()) {
+	events := make(chan Event, eventBufferSize)
+
+	bus.mu.Lock()
+	bus.subscribers[events] = struct{}{}
+	bus.mu.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			bus.mu.Lock()
+			delete(bus.subscribers, events)
+			bus.mu.Unlock()
+			close(events)
+		})
+	}
+}
+
+// Publish sends an event to all subscribers
+func (bus *EventBus) Publish(eventType string, data interface{}) {
+	event := Event{Type: eventType, Time: time.Now(), Data: data}
+
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+	for subscriber := range bus.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			log.Debugf("Dropping %s event for a slow subscriber", eventType)
+		}
+	}
+}
+
+// eventsHandler streams the events of the event bus as Server-Sent Events.
+// The optional types parameter limits the stream to a comma-separated list of event types.
+func (app *App) eventsHandler(c *gin.Context) {
+	var types map[string]bool
+	if rawTypes := c.Query("types"); rawTypes != "" {
+		types = make(map[string]bool)
+		for _, eventType := range strings.Split(rawTypes, ",") {
+			types[strings.TrimSpace(eventType)] = true
+		}
+	}
+
+	events, unsubscribe := eventBus.Subscribe()
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable buffering in nginx
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			if types == nil || types[event.Type] {
+				c.SSEvent(event.Type, event)
+			}
+			return true
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+
+	first, unsubscribeFirst := bus.Subscribe()
+	second, unsubscribeSecond := bus.Subscribe()
+	defer unsubscribeSecond()
+
+	bus.Publish(eventJob, JobEvent{JobID: "job-1", Status: "pending"})
+	for _, events := range []<-chan Event{first, second} {
+		event := <-events
+		assert.Equal(t, eventJob, event.Type)
+		assert.Equal(t, JobEvent{JobID: "job-1", Status: "pending"}, event.Data)
+	}
+
+	// Unsubscribed channels are closed and receive nothing
+	unsubscribeFirst()
+	unsubscribeFirst()
+	bus.Publish(eventJob, JobEvent{JobID: "job-2"})
+	_, ok := <-first
+	assert.False(t, ok)
+	assert.Equal(t, "job-2", (<-second).Data.(JobEvent).JobID)
+
+	// Publishing does not block when a subscriber falls behind
+	for i := 0; i < eventBufferSize+10; i++ {
+		bus.Publish(eventJobProgress, JobEvent{JobID: "job-3", PagesDone: i})
+	}
+	assert.Len(t, second, eventBufferSize)
+}
+
+func TestJobStore_PublishesEvents(t *testing.T) {
+	originalBus := eventBus
+	defer func() { eventBus = originalBus }()
+	eventBus = NewEventBus()
+	events, unsubscribe := eventBus.Subscribe()
+	defer unsubscribe()
+
+	store := newTestJobStore(t)
+	require.NoError(t, store.addJob(&Job{ID: "job-1", DocumentID: 7, Status: "pending"}))
+	_, _, ok := store.claimNextJob()
+	require.True(t, ok)
+	store.updateProgress("job-1", OCRProgress{PagesDone: 1, TotalPages: 2})
+	store.updateJobStatus("job-1", "completed", "OCR text")
+
+	expected := []Event{
+		{Type: eventJob, Data: JobEvent{JobID: "job-1", DocumentID: 7, Status: "pending"}},
+		{Type: eventJob, Data: JobEvent{JobID: "job-1", DocumentID: 7, Status: "in_progress"}},
+		{Type: eventJobProgress, Data: JobEvent{JobID: "job-1", DocumentID: 7, PagesDone: 1, TotalPages: 2}},
+		{Type: eventJob, Data: JobEvent{JobID: "job-1", DocumentID: 7, Status: "completed"}},
+	}
+	for _, want := range expected {
+		event := <-events
+		assert.Equal(t, want.Type, event.Type)
+		assert.Equal(t, want.Data, event.Data)
+	}
+}
+
+func TestEventsHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	originalBus := eventBus
+	defer func() { eventBus = originalBus }()
+	eventBus = NewEventBus()
+
+	app := &App{}
+	router := gin.New()
+	router.GET("/api/events", app.eventsHandler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/events?types=job", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// Wait until the handler subscribed before publishing
+	require.Eventually(t, func() bool {
+		eventBus.mu.RLock()
+		defer eventBus.mu.RUnlock()
+		return len(eventBus.subscribers) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// Events of other types are filtered out
+	eventBus.Publish(eventModification, &ModificationHistory{DocumentID: 1})
+	eventBus.Publish(eventJob, JobEvent{JobID: "job-1", Status: "completed"})
+
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 2 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	assert.Equal(t, "event:job", lines[0])
+	assert.Contains(t, lines[1], `"job_id":"job-1"`)
+	assert.Contains(t, lines[1], `"status":"completed"`)
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Steps of the preprocessing chain that can be selected with OCR_PREPROCESS
+const (
+	preprocessGrayscale = "grayscale" // Remove the colors
+	preprocessNormalize = "normalize" // Stretch the brightness to the full range, for faint prints
+	preprocessDeskew    = "deskew"    // Rotate skewed scans so that the lines are horizontal
+	preprocessCrop      = "crop"      // Remove uniform borders, like scanner beds and margins
+)
+
+var preprocessSteps = []string{preprocessGrayscale, preprocessNormalize, preprocessDeskew, preprocessCrop}
+
+// Defaults for the rendering of PDF pages
+const (
+	defaultRenderDPI   = 300
+	defaultJPEGQuality = jpeg.DefaultQuality
+)
+
+// renderDPI returns the resolution at which PDF pages are rendered for OCR
+func renderDPI() float64 {
+	if ocrRenderDPI <= 0 {
+		return defaultRenderDPI
+	}
+	return float64(ocrRenderDPI)
+}
+
+// jpegQuality returns the quality of the JPEG images of the pages
+func jpegQuality() int {
+	if ocrJPEGQuality <= 0 {
+		return defaultJPEGQuality
+	}
+	return ocrJPEGQuality
+}
+
+// parsePreprocessSteps parses a comma-separated list of preprocessing steps, in the order they are run
+func parsePreprocessSteps(raw string) ([]string, error) {
+	var steps []string
+	for _, step := range strings.Split(raw, ",") {
+		step = strings.ToLower(strings.TrimSpace(step))
+		if step == "" {
+			continue
+		}
+		if !slices.Contains(preprocessSteps, step) {
+			return nil, fmt.Errorf("unknown preprocessing step '%s', use %s", step, strings.Join(preprocessSteps, ", "))
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// defaultMaxImageDimension returns the longest image side a vision provider works with. Larger images are
+// scaled down by the provider anyway, so sending them only costs bandwidth. 0 means no known limit.
+func defaultMaxImageDimension(provider string) int {
+	switch strings.ToLower(provider) {
+	case "openai":
+		return 2048
+	case "anthropic":
+		return 1568
+	case "googleai":
+		return 3072
+	default:
+		return 0
+	}
+}
+
+// preprocessPageImage runs the preprocessing steps on a JPEG page image and returns the new JPEG
+func preprocessPageImage(jpegBytes []byte, steps []string) ([]byte, error) {
+	if len(steps) == 0 {
+		return jpegBytes, nil
+	}
+
+	decoded, err := jpeg.Decode(bytes.NewReader(jpegBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %w", err)
+	}
+	img := toRGBA(decoded)
+
+	gray := false
+	for _, step := range steps {
+		switch step {
+		case preprocessGrayscale:
+			grayscaleImage(img)
+			gray = true
+		case preprocessNormalize:
+			normalizeContrast(img)
+		case preprocessDeskew:
+			if angle := detectSkew(img); angle != 0 {
+				img = rotateImage(img, -angle)
+			}
+		case preprocessCrop:
+			img = cropBorders(img)
+		}
+	}
+
+	return encodeJPEG(img, gray)
+}
+
+// resizeJPEG scales a JPEG image down so that its longest side is at most maxDimension pixels
+func resizeJPEG(jpegBytes []byte, maxDimension int) ([]byte, error) {
+	config, err := jpeg.DecodeConfig(bytes.NewReader(jpegBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %w", err)
+	}
+	if maxDimension <= 0 || max(config.Width, config.Height) <= maxDimension {
+		return jpegBytes, nil
+	}
+
+	decoded, err := jpeg.Decode(bytes.NewReader(jpegBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %w", err)
+	}
+	_, gray := decoded.(*image.Gray)
+	return encodeJPEG(resizeToFit(toRGBA(decoded), maxDimension), gray)
+}
+
+func encodeJPEG(img *image.RGBA, gray bool) ([]byte, error) {
+	var out image.Image = img
+	if gray {
+		grayImg := image.NewGray(img.Bounds())
+		draw.Draw(grayImg, grayImg.Bounds(), img, img.Bounds().Min, draw.Src)
+		out = grayImg
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, out, &jpeg.Options{Quality: jpegQuality()}); err != nil {
+		return nil, fmt.Errorf("error encoding image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// toRGBA converts an image to RGBA with its origin at 0,0
+func toRGBA(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(img, img.Bounds(), src, bounds.Min, draw.Src)
+	return img
+}
+
+// luminance returns the brightness of a pixel of an RGBA image from 0 to 255
+func luminance(img *image.RGBA, x, y int) uint8 {
+	i := img.PixOffset(x, y)
+	p := img.Pix[i : i+3 : i+3]
+	return uint8((299*uint32(p[0]) + 587*uint32(p[1]) + 114*uint32(p[2])) / 1000)
+}
+
+func grayscaleImage(img *image.RGBA) {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			l := luminance(img, x, y)
+			i := img.PixOffset(x, y)
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2] = l, l, l
+		}
+	}
+}
+
+// normalizeContrast stretches the brightness so that the darkest and brightest percent of the pixels become
+// black and white. This makes faint prints like thermal paper receipts readable.
+func normalizeContrast(img *image.RGBA) {
+	var histogram [256]int
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			histogram[luminance(img, x, y)]++
+		}
+	}
+
+	clip := bounds.Dx() * bounds.Dy() / 100
+	low, high := 0, 255
+	for count := 0; low < 255 && count+histogram[low] <= clip; low++ {
+		count += histogram[low]
+	}
+	for count := 0; high > 0 && count+histogram[high] <= clip; high-- {
+		count += histogram[high]
+	}
+	if high <= low {
+		return
+	}
+
+	var lookup [256]uint8
+	for v := range lookup {
+		lookup[v] = uint8(min(max((v-low)*255/(high-low), 0), 255))
+	}
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2] = lookup[img.Pix[i]], lookup[img.Pix[i+1]], lookup[img.Pix[i+2]]
+	}
+}
+
+// Search range and precision of detectSkew in degrees
+const (
+	maxSkewAngle  = 5.0
+	skewAngleStep = 0.1
+)
+
+// detectSkew returns the angle in degrees by which the text lines of a page are rotated counterclockwise,
+// or 0 if the page is not skewed. The angle is found by rotating the dark pixels and looking for the angle
+// at which the rows are most distinct, i.e. at which the variance of the row sums is largest.
+func detectSkew(img *image.RGBA) float64 {
+	// Work on a smaller sample of dark pixels, which is precise enough for the angle
+	bounds := img.Bounds()
+	step := max(1, max(bounds.Dx(), bounds.Dy())/1000)
+	var points [][2]float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			if luminance(img, x, y) < 128 {
+				points = append(points, [2]float64{float64(x / step), float64(y / step)})
+			}
+		}
+	}
+	// Empty pages and pages that are mostly dark have no lines to align
+	samples := (bounds.Dx() / step) * (bounds.Dy() / step)
+	if len(points) < 100 || len(points) > samples/2 {
+		return 0
+	}
+
+	height := float64(bounds.Dy()/step + bounds.Dx()/step)
+	score := func(angle float64) float64 {
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		rows := make([]float64, int(2*height)+1)
+		for _, p := range points {
+			row := int(p[1]*cos + p[0]*sin + height)
+			if row >= 0 && row < len(rows) {
+				rows[row]++
+			}
+		}
+		sum := 0.0
+		for _, count := range rows {
+			sum += count * count
+		}
+		return sum
+	}
+
+	bestAngle, bestScore := 0.0, score(0)
+	for angle := -maxSkewAngle; angle <= maxSkewAngle+skewAngleStep/2; angle += skewAngleStep {
+		if s := score(angle); s > bestScore*1.0001 {
+			bestAngle, bestScore = angle, s
+		}
+	}
+	if math.Abs(bestAngle) < skewAngleStep {
+		return 0
+	}
+	return math.Round(bestAngle*10) / 10
+}
+
+// rotateImage rotates an image counterclockwise by angle degrees around its center and fills the corners with white
+func rotateImage(img *image.RGBA, angle float64) *image.RGBA {
+	bounds := img.Bounds()
+	rotated := image.NewRGBA(bounds)
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	cx, cy := float64(bounds.Dx())/2, float64(bounds.Dy())/2
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			// Position in the source image, with y pointing down
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			sx := dx*cos - dy*sin + cx - 0.5
+			sy := dx*sin + dy*cos + cy - 0.5
+
+			o := rotated.PixOffset(x, y)
+			x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+			if x0 < 0 || y0 < 0 || x0+1 >= bounds.Dx() || y0+1 >= bounds.Dy() {
+				copy(rotated.Pix[o:o+4], []uint8{255, 255, 255, 255})
+				continue
+			}
+
+			// Bilinear interpolation of the four neighbours
+			fx, fy := sx-float64(x0), sy-float64(y0)
+			i00, i10 := img.PixOffset(x0, y0), img.PixOffset(x0+1, y0)
+			i01, i11 := img.PixOffset(x0, y0+1), img.PixOffset(x0+1, y0+1)
+			for c := 0; c < 4; c++ {
+				top := float64(img.Pix[i00+c])*(1-fx) + float64(img.Pix[i10+c])*fx
+				bottom := float64(img.Pix[i01+c])*(1-fx) + float64(img.Pix[i11+c])*fx
+				rotated.Pix[o+c] = uint8(top*(1-fy) + bottom*fy + 0.5)
+			}
+		}
+	}
+	return rotated
+}
+
+// cropBorders removes rows and columns of nearly uniform brightness from the edges of an image,
+// like the black border of a scanner bed or wide white margins. A small margin is kept.
+func cropBorders(img *image.RGBA) *image.RGBA {
+	bounds := img.Bounds()
+	uniform := func(x0, y0, dx, dy, n int) bool {
+		lowest, highest := uint8(255), uint8(0)
+		for i := 0; i < n; i++ {
+			l := luminance(img, x0+i*dx, y0+i*dy)
+			lowest, highest = min(lowest, l), max(highest, l)
+		}
+		// Allow for scanner noise and JPEG artifacts
+		return int(highest)-int(lowest) < 48
+	}
+
+	// Rows are only uniform once the columns of a border on the sides are cropped and vice versa,
+	// so crop until nothing changes
+	top, bottom := bounds.Min.Y, bounds.Max.Y-1
+	left, right := bounds.Min.X, bounds.Max.X-1
+	for changed := true; changed; {
+		previous := image.Rect(left, top, right, bottom)
+		for top < bottom && uniform(left, top, 1, 0, right-left+1) {
+			top++
+		}
+		for bottom > top && uniform(left, bottom, 1, 0, right-left+1) {
+			bottom--
+		}
+		for left < right && uniform(left, top, 0, 1, bottom-top+1) {
+			left++
+		}
+		for right > left && uniform(right, top, 0, 1, bottom-top+1) {
+			right--
+		}
+		changed = previous != image.Rect(left, top, right, bottom)
+	}
+
+	// Don't crop blank pages away, and keep the page if there is nothing to crop
+	content := image.Rect(left, top, right+1, bottom+1)
+	if content.Dx() < bounds.Dx()/10 || content.Dy() < bounds.Dy()/10 || content == bounds {
+		return img
+	}
+
+	margin := max(bounds.Dx(), bounds.Dy()) / 100
+	content = content.Inset(-margin).Intersect(bounds)
+	return toRGBA(img.SubImage(content))
+}
+
+// resizeToFit scales an image down so that its longest side is at most maxDimension pixels.
+// Each target pixel is the average of the source pixels it covers, which keeps thin strokes readable.
+func resizeToFit(img *image.RGBA, maxDimension int) *image.RGBA {
+	bounds := img.Bounds()
+	scale := float64(maxDimension) / float64(max(bounds.Dx(), bounds.Dy()))
+	if scale >= 1 {
+		return img
+	}
+
+	width := max(1, int(math.Round(float64(bounds.Dx())*scale)))
+	height := max(1, int(math.Round(float64(bounds.Dy())*scale)))
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		sy0 := y * bounds.Dy() / height
+		sy1 := max(sy0+1, (y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			sx0 := x * bounds.Dx() / width
+			sx1 := max(sx0+1, (x+1)*bounds.Dx()/width)
+
+			var sum [4]int
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					i := img.PixOffset(bounds.Min.X+sx, bounds.Min.Y+sy)
+					for c := 0; c < 4; c++ {
+						sum[c] += int(img.Pix[i+c])
+					}
+				}
+			}
+			count := (sy1 - sy0) * (sx1 - sx0)
+			o := resized.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				resized.Pix[o+c] = uint8(sum[c] / count)
+			}
+		}
+	}
+	return resized
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPage draws a white page with lines of dark "words"
+func testPage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for y := height / 10; y < height*9/10; y += height / 20 {
+		for x := width / 10; x < width*9/10; x += 40 {
+			draw.Draw(img, image.Rect(x, y, min(x+30, width*9/10), y+height/100+1), image.NewUniform(color.Black), image.Point{}, draw.Src)
+		}
+	}
+	return img
+}
+
+func TestParsePreprocessSteps(t *testing.T) {
+	steps, err := parsePreprocessSteps(" Deskew, grayscale,,crop ")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deskew", "grayscale", "crop"}, steps)
+
+	steps, err = parsePreprocessSteps("")
+	require.NoError(t, err)
+	assert.Empty(t, steps)
+
+	_, err = parsePreprocessSteps("grayscale,sharpen")
+	assert.ErrorContains(t, err, "sharpen")
+}
+
+func TestNormalizeContrast(t *testing.T) {
+	// Faint gray text on light gray paper, like a thermal paper receipt
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{200, 200, 200, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(10, 10, 90, 30), image.NewUniform(color.RGBA{160, 160, 160, 255}), image.Point{}, draw.Src)
+
+	normalizeContrast(img)
+	assert.Equal(t, uint8(255), luminance(img, 0, 0))
+	assert.Equal(t, uint8(0), luminance(img, 20, 20))
+}
+
+func TestDetectSkewAndRotate(t *testing.T) {
+	page := testPage(800, 1000)
+	assert.Zero(t, detectSkew(page))
+
+	for _, angle := range []float64{2, -3.5} {
+		skewed := rotateImage(page, angle)
+		detected := detectSkew(skewed)
+		assert.InDelta(t, angle, detected, 0.2, "angle %v", angle)
+
+		// Rotating back makes the lines horizontal again
+		assert.InDelta(t, 0, detectSkew(rotateImage(skewed, -detected)), 0.2)
+	}
+
+	// Blank pages are not rotated
+	blank := image.NewRGBA(image.Rect(0, 0, 200, 200))
+	draw.Draw(blank, blank.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	assert.Zero(t, detectSkew(blank))
+}
+
+func TestCropBorders(t *testing.T) {
+	// A page on a black scanner bed
+	img := image.NewRGBA(image.Rect(0, 0, 1000, 1200))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(100, 150, 900, 1100), testPage(800, 950), image.Point{}, draw.Src)
+
+	cropped := cropBorders(img)
+	// The black border and the white margins around the text are gone, apart from a small margin
+	assert.InDelta(t, 630+2*12, cropped.Bounds().Dx(), 4)
+	assert.Less(t, cropped.Bounds().Dy(), 950)
+	assert.Equal(t, image.Point{}, cropped.Bounds().Min)
+
+	// Blank pages are kept
+	blank := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	assert.Equal(t, blank.Bounds(), cropBorders(blank).Bounds())
+}
+
+func TestResizeJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 2480, 3508)), nil))
+
+	resized, err := resizeJPEG(buf.Bytes(), 1568)
+	require.NoError(t, err)
+	decoded, err := jpeg.Decode(bytes.NewReader(resized))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 1109, 1568), decoded.Bounds())
+	assert.IsType(t, &image.Gray{}, decoded)
+
+	// Images within the limit are passed through
+	unchanged, err := resizeJPEG(buf.Bytes(), 4000)
+	require.NoError(t, err)
+	assert.Equal(t, buf.Bytes(), unchanged)
+	unchanged, err = resizeJPEG(buf.Bytes(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, buf.Bytes(), unchanged)
+}
+
+func TestPreprocessPageImage(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, rotateImage(testPage(600, 800), 3), nil))
+
+	unchanged, err := preprocessPageImage(buf.Bytes(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, buf.Bytes(), unchanged)
+
+	processed, err := preprocessPageImage(buf.Bytes(), []string{preprocessGrayscale, preprocessNormalize, preprocessDeskew, preprocessCrop})
+	require.NoError(t, err)
+	decoded, err := jpeg.Decode(bytes.NewReader(processed))
+	require.NoError(t, err)
+	assert.IsType(t, &image.Gray{}, decoded)
+	assert.Less(t, decoded.Bounds().Dx(), 600)
+	assert.InDelta(t, 0, detectSkew(toRGBA(decoded)), 0.3)
+}
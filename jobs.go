@@ -2,41 +2,76 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
-	"sort"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
-// Job represents an OCR job
+// Job represents an OCR job, persisted in the jobs table so that it survives restarts
 type Job struct {
-	ID         string
-	DocumentID int
-	Status     string // "pending", "in_progress", "completed", "failed"
-	Result     string // OCR result or error message
-	CreatedAt  time.Time
+	ID         string    `gorm:"primaryKey;size:36"`
+	DocumentID int       `gorm:"not null;index"`
+	Status     string    `gorm:"size:16;not null;index"` // "pending", "in_progress", "completed", "failed", "cancelled"
+	Result     string    // OCR result or error message
+	Attempts   int       `gorm:"not null;default:0"` // Number of times processing was started
+	CreatedAt  time.Time `gorm:"index"`
 	UpdatedAt  time.Time
-	PagesDone  int // Number of pages processed
+	PagesDone  int      // Number of pages processed
+	TotalPages int      // Number of pages to process, 0 until the document was downloaded
+	PageTexts  []string `gorm:"serializer:json"` // OCR results of the pages processed so far
+	Pages      string   // Page selection of the job, empty for the pages selected with OCR_PAGES
 }
 
-// JobStore manages jobs and their statuses
+// pageSelection returns the pages the job reads
+func (job *Job) pageSelection() (pageSelection, error) {
+	if job.Pages == "" {
+		return ocrPages, nil
+	}
+	return parsePageSelection(job.Pages)
+}
+
+// maxJobAttempts is the number of times a job is started before it is given up.
+// Jobs are only started again if they were interrupted by a restart.
+const maxJobAttempts = 3
+
+// JobStore manages jobs and their statuses in the database
 type JobStore struct {
 	sync.RWMutex
-	jobs map[string]*Job
+	db *gorm.DB
+
+	// ready is signalled when a job is added, to wake up a worker
+	ready chan struct{}
+
+	// cancels holds the functions that cancel the jobs in progress
+	cancels map[string]context.CancelFunc
 }
 
+var (
+	errJobNotFound = errors.New("job not found")
+	errJobState    = errors.New("job is in the wrong state")
+)
+
 var (
 	logger = logrus.New()
 
-	jobStore = &JobStore{
-		jobs: make(map[string]*Job),
-	}
-	jobQueue = make(chan *Job, 100) // Buffered channel with capacity of 100 jobs
+	jobStore *JobStore // Will be initialized with the database in main
 )
 
+// NewJobStore creates a job store backed by the given database
+func NewJobStore(db *gorm.DB) *JobStore {
+	return &JobStore{
+		db:      db,
+		ready:   make(chan struct{}, 1),
+		cancels: make(map[string]context.CancelFunc),
+	}
+}
+
 func init() {
 
 	// Initialize logger
@@ -52,79 +87,316 @@ func generateJobID() string {
 	return uuid.New().String()
 }
 
-func (store *JobStore) addJob(job *Job) {
+func (store *JobStore) addJob(job *Job) error {
 	store.Lock()
 	defer store.Unlock()
 	job.PagesDone = 0 // Initialize PagesDone to 0
-	store.jobs[job.ID] = job
-	logger.Infof("Job added: %v", job)
+	job.TotalPages = 0
+	if err := store.db.Create(job).Error; err != nil {
+		return err
+	}
+	logger.Infof("Job added: %s for document %d", job.ID, job.DocumentID)
+	eventBus.Publish(eventJob, JobEvent{JobID: job.ID, DocumentID: job.DocumentID, Status: job.Status})
+	store.signal()
+	return nil
 }
 
 func (store *JobStore) getJob(jobID string) (*Job, bool) {
 	store.RLock()
 	defer store.RUnlock()
-	job, exists := store.jobs[jobID]
-	return job, exists
+	var job Job
+	if err := store.db.First(&job, "id = ?", jobID).Error; err != nil {
+		return nil, false
+	}
+	return &job, true
 }
 
 func (store *JobStore) GetAllJobs() []*Job {
 	store.RLock()
 	defer store.RUnlock()
 
-	jobs := make([]*Job, 0, len(store.jobs))
-	for _, job := range store.jobs {
-		jobs = append(jobs, job)
+	var jobs []*Job
+	if err := store.db.Order("created_at DESC").Find(&jobs).Error; err != nil {
+		logger.Errorf("Error fetching jobs: %v", err)
+		return []*Job{}
 	}
+	return jobs
+}
 
-	sort.Slice(jobs, func(i, j int) bool {
-		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
-	})
+// latestJobs returns the most recent job of each of the given documents that has one
+func (store *JobStore) latestJobs(documentIDs []int) map[int]*Job {
+	store.RLock()
+	defer store.RUnlock()
 
-	return jobs
+	latest := make(map[int]*Job)
+	if len(documentIDs) == 0 {
+		return latest
+	}
+	var jobs []*Job
+	if err := store.db.Where("document_id IN ?", documentIDs).Order("created_at ASC").Find(&jobs).Error; err != nil {
+		logger.Errorf("Error fetching jobs: %v", err)
+		return latest
+	}
+	for _, job := range jobs {
+		latest[job.DocumentID] = job
+	}
+	return latest
 }
 
 func (store *JobStore) updateJobStatus(jobID, status, result string) {
 	store.Lock()
 	defer store.Unlock()
-	if job, exists := store.jobs[jobID]; exists {
-		job.Status = status
-		if result != "" {
-			job.Result = result
-		}
-		job.UpdatedAt = time.Now()
-		logger.Infof("Job status updated: %v", job)
+	updates := map[string]interface{}{"status": status, "updated_at": time.Now()}
+	if result != "" {
+		updates["result"] = result
 	}
+	if err := store.db.Model(&Job{}).Where("id = ?", jobID).Updates(updates).Error; err != nil {
+		logger.Errorf("Error updating status of job %s: %v", jobID, err)
+		return
+	}
+	logger.Infof("Job status updated: %s is %s", jobID, status)
+	eventBus.Publish(eventJob, JobEvent{JobID: jobID, DocumentID: store.documentIDOf(jobID), Status: status})
 }
 
-func (store *JobStore) updatePagesDone(jobID string, pagesDone int) {
+func (store *JobStore) updateProgress(jobID string, progress OCRProgress) {
 	store.Lock()
 	defer store.Unlock()
-	if job, exists := store.jobs[jobID]; exists {
-		job.PagesDone = pagesDone
+	job := Job{
+		PagesDone:  progress.PagesDone,
+		TotalPages: progress.TotalPages,
+		PageTexts:  progress.PageTexts,
+		UpdatedAt:  time.Now(),
+	}
+	err := store.db.Model(&Job{}).Where("id = ?", jobID).
+		Select("pages_done", "total_pages", "page_texts", "updated_at").Updates(&job).Error
+	if err != nil {
+		logger.Errorf("Error updating progress of job %s: %v", jobID, err)
+		return
+	}
+	logger.Infof("Job progress updated: %s has %d of %d pages done", jobID, progress.PagesDone, progress.TotalPages)
+	eventBus.Publish(eventJobProgress, JobEvent{
+		JobID:      jobID,
+		DocumentID: store.documentIDOf(jobID),
+		PagesDone:  progress.PagesDone,
+		TotalPages: progress.TotalPages,
+	})
+}
+
+// documentIDOf returns the document of a job for its events, 0 if the job doesn't exist.
+// It must be called with the lock held.
+func (store *JobStore) documentIDOf(jobID string) int {
+	var documentIDs []int
+	if err := store.db.Model(&Job{}).Where("id = ?", jobID).Pluck("document_id", &documentIDs).Error; err != nil {
+		logger.Warnf("Error looking up the document of job %s: %v", jobID, err)
+		return 0
+	}
+	if len(documentIDs) == 0 {
+		return 0
+	}
+	return documentIDs[0]
+}
+
+// claimNextJob marks the oldest pending job as in progress and returns it with
+// a context that is cancelled when the job is cancelled
+func (store *JobStore) claimNextJob() (*Job, context.Context, bool) {
+	store.Lock()
+	defer store.Unlock()
+
+	var job Job
+	result := store.db.Where("status = ?", "pending").Order("created_at").Limit(1).Find(&job)
+	if result.Error != nil {
+		logger.Errorf("Error fetching pending jobs: %v", result.Error)
+		return nil, nil, false
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, false
+	}
+
+	job.Status = "in_progress"
+	job.Attempts++
+	job.UpdatedAt = time.Now()
+	if err := store.db.Model(&job).Select("status", "attempts", "updated_at").Updates(&job).Error; err != nil {
+		logger.Errorf("Error claiming job %s: %v", job.ID, err)
+		return nil, nil, false
+	}
+
+	eventBus.Publish(eventJob, JobEvent{JobID: job.ID, DocumentID: job.DocumentID, Status: job.Status})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	store.cancels[job.ID] = cancel
+	return &job, ctx, true
+}
+
+// releaseJob forgets the cancel function of a job that is no longer in progress
+func (store *JobStore) releaseJob(jobID string) {
+	store.Lock()
+	defer store.Unlock()
+	if cancel, exists := store.cancels[jobID]; exists {
+		cancel()
+		delete(store.cancels, jobID)
+	}
+}
+
+// cancelJob cancels a pending job right away. A job in progress is stopped through
+// its context and marked as cancelled by its worker.
+func (store *JobStore) cancelJob(jobID string) (*Job, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	var job Job
+	if err := store.db.First(&job, "id = ?", jobID).Error; err != nil {
+		return nil, errJobNotFound
+	}
+
+	switch job.Status {
+	case "pending":
+		job.Status = "cancelled"
+		job.Result = "Job was cancelled before it started"
 		job.UpdatedAt = time.Now()
-		logger.Infof("Job pages done updated: %v", job)
+		if err := store.db.Model(&job).Select("status", "result", "updated_at").Updates(&job).Error; err != nil {
+			return nil, err
+		}
+		eventBus.Publish(eventJob, JobEvent{JobID: job.ID, DocumentID: job.DocumentID, Status: job.Status})
+	case "in_progress":
+		if cancel, exists := store.cancels[jobID]; exists {
+			cancel()
+		}
+	default:
+		return &job, fmt.Errorf("%w: cannot cancel a job that is %s", errJobState, job.Status)
+	}
+
+	logger.Infof("Job cancelled: %s", jobID)
+	return &job, nil
+}
+
+// retryJob puts a failed or cancelled job back into the queue
+func (store *JobStore) retryJob(jobID string) (*Job, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	var job Job
+	if err := store.db.First(&job, "id = ?", jobID).Error; err != nil {
+		return nil, errJobNotFound
+	}
+	if job.Status != "failed" && job.Status != "cancelled" {
+		return &job, fmt.Errorf("%w: only failed or cancelled jobs can be retried, this one is %s", errJobState, job.Status)
+	}
+
+	job.Status = "pending"
+	job.Result = ""
+	job.Attempts = 0
+	job.PagesDone = 0
+	job.TotalPages = 0
+	job.PageTexts = nil
+	job.UpdatedAt = time.Now()
+	if err := store.db.Model(&job).Select("status", "result", "attempts", "pages_done", "total_pages", "page_texts", "updated_at").Updates(&job).Error; err != nil {
+		return nil, err
+	}
+
+	logger.Infof("Job queued for retry: %s", jobID)
+	eventBus.Publish(eventJob, JobEvent{JobID: job.ID, DocumentID: job.DocumentID, Status: job.Status})
+	store.signal()
+	return &job, nil
+}
+
+// deleteJobs removes the jobs with one of the given statuses that were last updated before the given time
+func (store *JobStore) deleteJobs(statuses []string, before time.Time) (int64, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	result := store.db.Where("status IN ? AND updated_at < ?", statuses, before).Delete(&Job{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	logger.Infof("Deleted %d jobs with status %v older than %s", result.RowsAffected, statuses, before.Format(time.RFC3339))
+	return result.RowsAffected, nil
+}
+
+// resumeJobs puts the jobs that were in progress when paperless-gpt stopped back into the queue.
+// Jobs that were already interrupted maxJobAttempts times are marked as failed.
+func (store *JobStore) resumeJobs() error {
+	store.Lock()
+	defer store.Unlock()
+
+	var interrupted []Job
+	if err := store.db.Where("status = ?", "in_progress").Find(&interrupted).Error; err != nil {
+		return err
+	}
+	for _, job := range interrupted {
+		updates := map[string]interface{}{"status": "pending", "updated_at": time.Now()}
+		if job.Attempts >= maxJobAttempts {
+			updates["status"] = "failed"
+			updates["result"] = fmt.Sprintf("job was interrupted %d times", job.Attempts)
+		}
+		if err := store.db.Model(&Job{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		logger.Infof("Job %s for document %d was interrupted, now %s", job.ID, job.DocumentID, updates["status"])
+	}
+
+	var pending int64
+	if err := store.db.Model(&Job{}).Where("status = ?", "pending").Count(&pending).Error; err != nil {
+		return err
+	}
+	if pending > 0 {
+		logger.Infof("Resuming %d pending jobs", pending)
+		store.signal()
+	}
+	return nil
+}
+
+// signal wakes up a waiting worker without blocking
+func (store *JobStore) signal() {
+	select {
+	case store.ready <- struct{}{}:
+	default:
 	}
 }
 
 func startWorkerPool(app *App, numWorkers int) {
+	if err := jobStore.resumeJobs(); err != nil {
+		logger.Errorf("Error resuming jobs: %v", err)
+	}
+
 	for i := 0; i < numWorkers; i++ {
 		go func(workerID int) {
 			logger.Infof("Worker %d started", workerID)
-			for job := range jobQueue {
-				logger.Infof("Worker %d processing job: %s", workerID, job.ID)
-				processJob(app, job)
+			for range jobStore.ready {
+				for {
+					job, ctx, ok := jobStore.claimNextJob()
+					if !ok {
+						break
+					}
+					// Let another worker pick up the next job in the meantime
+					jobStore.signal()
+					logger.Infof("Worker %d processing job: %s", workerID, job.ID)
+					processJob(ctx, app, job)
+				}
 			}
 		}(i)
 	}
 }
 
-func processJob(app *App, job *Job) {
-	jobStore.updateJobStatus(job.ID, "in_progress", "")
+func processJob(ctx context.Context, app *App, job *Job) {
+	defer jobStore.releaseJob(job.ID)
 
-	ctx := context.Background()
+	pages, err := job.pageSelection()
+	if err != nil {
+		logger.Errorf("Invalid page selection of job %s: %v", job.ID, err)
+		jobStore.updateJobStatus(job.ID, "failed", err.Error())
+		return
+	}
 
-	fullOcrText, err := app.ProcessDocumentOCR(ctx, job.DocumentID)
+	// Nothing is written to the document before the result is accepted
+	fullOcrText, err := app.processDocumentOCR(ctx, job.DocumentID, pages, func(progress OCRProgress) {
+		jobStore.updateProgress(job.ID, progress)
+	}, ocrWrites{})
 	if err != nil {
+		if ctx.Err() != nil {
+			logger.Infof("Job %s was cancelled while running", job.ID)
+			jobStore.updateJobStatus(job.ID, "cancelled", "Job was cancelled while running")
+			return
+		}
 		logger.Errorf("Error processing document OCR for job %s: %v", job.ID, err)
 		jobStore.updateJobStatus(job.ID, "failed", err.Error())
 		return
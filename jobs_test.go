@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestJobStore creates a job store on an empty jobs table of the test database
+func newTestJobStore(t *testing.T) *JobStore {
+	db, err := InitializeTestDB()
+	require.NoError(t, err)
+	require.NoError(t, db.Where("1 = 1").Delete(&Job{}).Error)
+	return NewJobStore(db)
+}
+
+func TestJobStore_Persistence(t *testing.T) {
+	store := newTestJobStore(t)
+
+	created := time.Now().Add(-time.Minute)
+	require.NoError(t, store.addJob(&Job{ID: "job-1", DocumentID: 1, Status: "pending", CreatedAt: created}))
+	require.NoError(t, store.addJob(&Job{ID: "job-2", DocumentID: 2, Status: "pending", CreatedAt: created.Add(time.Second)}))
+
+	// Jobs are claimed oldest first
+	job, _, ok := store.claimNextJob()
+	require.True(t, ok)
+	assert.Equal(t, "job-1", job.ID)
+	assert.Equal(t, "in_progress", job.Status)
+	assert.Equal(t, 1, job.Attempts)
+
+	store.updateProgress("job-1", OCRProgress{PagesDone: 2, TotalPages: 3, PageTexts: []string{"page 1", "page 2"}})
+	store.updateJobStatus("job-1", "completed", "OCR text")
+
+	// A new store on the same database sees the jobs of the old one
+	restarted := NewJobStore(store.db)
+	job, ok = restarted.getJob("job-1")
+	require.True(t, ok)
+	assert.Equal(t, "completed", job.Status)
+	assert.Equal(t, "OCR text", job.Result)
+	assert.Equal(t, 2, job.PagesDone)
+	assert.Equal(t, 3, job.TotalPages)
+	assert.Equal(t, []string{"page 1", "page 2"}, job.PageTexts)
+
+	jobs := restarted.GetAllJobs()
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "job-2", jobs[0].ID)
+
+	_, ok = restarted.getJob("unknown")
+	assert.False(t, ok)
+}
+
+func TestJobStore_ResumeJobs(t *testing.T) {
+	store := newTestJobStore(t)
+
+	require.NoError(t, store.addJob(&Job{ID: "interrupted", DocumentID: 1, Status: "pending"}))
+	require.NoError(t, store.addJob(&Job{ID: "crashing", DocumentID: 2, Status: "pending"}))
+	_, _, ok := store.claimNextJob()
+	require.True(t, ok)
+	require.NoError(t, store.db.Model(&Job{}).Where("id = ?", "crashing").Updates(map[string]interface{}{"status": "in_progress", "attempts": maxJobAttempts}).Error)
+
+	// Simulate a restart: in-progress jobs are queued again unless they were interrupted too often
+	restarted := NewJobStore(store.db)
+	require.NoError(t, restarted.resumeJobs())
+
+	job, _ := restarted.getJob("interrupted")
+	assert.Equal(t, "pending", job.Status)
+	job, _ = restarted.getJob("crashing")
+	assert.Equal(t, "failed", job.Status)
+	assert.Contains(t, job.Result, "interrupted 3 times")
+
+	// The workers are woken up for the resumed job
+	select {
+	case <-restarted.ready:
+	default:
+		t.Fatal("expected the workers to be signalled")
+	}
+	job, _, ok = restarted.claimNextJob()
+	require.True(t, ok)
+	assert.Equal(t, "interrupted", job.ID)
+	assert.Equal(t, 2, job.Attempts)
+}
+
+func TestJobStore_CancelJob(t *testing.T) {
+	store := newTestJobStore(t)
+
+	require.NoError(t, store.addJob(&Job{ID: "running", DocumentID: 1, Status: "pending", CreatedAt: time.Now().Add(-time.Second)}))
+	require.NoError(t, store.addJob(&Job{ID: "waiting", DocumentID: 2, Status: "pending"}))
+	_, ctx, ok := store.claimNextJob()
+	require.True(t, ok)
+
+	// A pending job is cancelled right away and never claimed
+	job, err := store.cancelJob("waiting")
+	require.NoError(t, err)
+	assert.Equal(t, "cancelled", job.Status)
+	_, _, ok = store.claimNextJob()
+	assert.False(t, ok)
+
+	// A running job is cancelled through its context
+	job, err = store.cancelJob("running")
+	require.NoError(t, err)
+	assert.Equal(t, "in_progress", job.Status)
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	store.updateJobStatus("running", "completed", "OCR text")
+	store.releaseJob("running")
+	_, err = store.cancelJob("running")
+	assert.ErrorIs(t, err, errJobState)
+
+	_, err = store.cancelJob("unknown")
+	assert.ErrorIs(t, err, errJobNotFound)
+}
+
+func TestJobStore_RetryJob(t *testing.T) {
+	store := newTestJobStore(t)
+
+	require.NoError(t, store.addJob(&Job{ID: "failed", DocumentID: 1, Status: "pending"}))
+	_, _, ok := store.claimNextJob()
+	require.True(t, ok)
+	store.updateProgress("failed", OCRProgress{PagesDone: 1, TotalPages: 3, PageTexts: []string{"page 1"}})
+	store.updateJobStatus("failed", "failed", "vision model not found")
+
+	job, err := store.retryJob("failed")
+	require.NoError(t, err)
+	assert.Equal(t, "pending", job.Status)
+
+	job, _, ok = store.claimNextJob()
+	require.True(t, ok)
+	assert.Equal(t, "failed", job.ID)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Empty(t, job.Result)
+	assert.Zero(t, job.PagesDone)
+	assert.Zero(t, job.TotalPages)
+	assert.Empty(t, job.PageTexts)
+
+	// Jobs that did not fail can't be retried
+	_, err = store.retryJob("failed")
+	assert.ErrorIs(t, err, errJobState)
+}
+
+func TestJobStore_DeleteJobs(t *testing.T) {
+	store := newTestJobStore(t)
+
+	old := time.Now().Add(-48 * time.Hour)
+	for _, job := range []*Job{
+		{ID: "old-completed", Status: "completed", CreatedAt: old, UpdatedAt: old},
+		{ID: "old-failed", Status: "failed", CreatedAt: old, UpdatedAt: old},
+		{ID: "new-completed", Status: "completed"},
+		{ID: "old-pending", Status: "pending", CreatedAt: old, UpdatedAt: old},
+	} {
+		require.NoError(t, store.addJob(job))
+	}
+
+	deleted, err := store.deleteJobs([]string{"completed"}, time.Now().Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	var remaining []string
+	for _, job := range store.GetAllJobs() {
+		remaining = append(remaining, job.ID)
+	}
+	assert.ElementsMatch(t, []string{"old-failed", "new-completed", "old-pending"}, remaining)
+}
+
+func TestParseJobAge(t *testing.T) {
+	age, err := parseJobAge("7d")
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, age)
+
+	age, err = parseJobAge("90m")
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Minute, age)
+
+	for _, invalid := range []string{"", "d", "-1d", "soon", "-5m"} {
+		_, err = parseJobAge(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// llmBackend is a single LLM backend of a fallback chain
+type llmBackend struct {
+	Name        string // "provider:model"
+	Model       llms.Model
+	UseImageURL bool // Send images as base64 data URLs instead of binary parts
+
+	unhealthyUntil time.Time
+	lastError      string
+	served         int
+	failed         int
+}
+
+// LLMBackendStatus describes the health of a backend in a fallback chain
+type LLMBackendStatus struct {
+	Name           string     `json:"name"`
+	Healthy        bool       `json:"healthy"`
+	UnhealthyUntil *time.Time `json:"unhealthy_until,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	Served         int        `json:"served"`
+	Failed         int        `json:"failed"`
+}
+
+// FallbackLLM is an llms.Model that sends each request to the first healthy backend of an ordered list.
+// Backends that fail or time out are skipped for the cooldown period and the next backend is tried.
+type FallbackLLM struct {
+	backends []*llmBackend
+	cooldown time.Duration
+	timeout  time.Duration // Per-backend request timeout, 0 for none
+
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// NewFallbackLLM creates a fallback chain of the given backends, the first backend being the primary one
+func NewFallbackLLM(backends []*llmBackend, cooldown, timeout time.Duration) *FallbackLLM {
+	return &FallbackLLM{
+		backends: backends,
+		cooldown: cooldown,
+		timeout:  timeout,
+		now:      time.Now,
+	}
+}
+
+// GenerateContent implements the llms.Model interface
+func (f *FallbackLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var errs []error
+	for _, backend := range f.candidates() {
+		requestCtx, cancel := ctx, context.CancelFunc(func() {})
+		if f.timeout > 0 {
+			requestCtx, cancel = context.WithTimeout(ctx, f.timeout)
+		}
+		response, err := backend.Model.GenerateContent(requestCtx, adaptImageParts(messages, backend.UseImageURL), options...)
+		cancel()
+
+		if err == nil {
+			f.markHealthy(backend)
+			if servedBy, ok := ctx.Value(llmServedByKey{}).(*llmServedBy); ok {
+				servedBy.record(backend.Name, backend != f.backends[0])
+			}
+			if backend == f.backends[0] {
+				log.Debugf("LLM request served by %s", backend.Name)
+			} else {
+				log.Infof("LLM request served by fallback backend %s", backend.Name)
+			}
+			return response, nil
+		}
+
+		// Don't blame the backend if the caller gave up
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		f.markUnhealthy(backend, err)
+		log.Warnf("LLM backend %s failed, marking it unhealthy for %s: %v", backend.Name, f.cooldown, err)
+		errs = append(errs, fmt.Errorf("%s: %w", backend.Name, err))
+	}
+
+	return nil, fmt.Errorf("all LLM backends failed: %w", errors.Join(errs...))
+}
+
+// Call implements the llms.Model interface
+func (f *FallbackLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, f, prompt, options...)
+}
+
+// Status returns the health of all backends in order
+func (f *FallbackLLM) Status() []LLMBackendStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	status := make([]LLMBackendStatus, 0, len(f.backends))
+	for _, backend := range f.backends {
+		backendStatus := LLMBackendStatus{
+			Name:      backend.Name,
+			Healthy:   !now.Before(backend.unhealthyUntil),
+			LastError: backend.lastError,
+			Served:    backend.served,
+			Failed:    backend.failed,
+		}
+		if !backendStatus.Healthy {
+			unhealthyUntil := backend.unhealthyUntil
+			backendStatus.UnhealthyUntil = &unhealthyUntil
+		}
+		status = append(status, backendStatus)
+	}
+	return status
+}
+
+// candidates returns the healthy backends in order. If all backends are in their cooldown,
+// all of them are returned so that requests are not rejected without trying.
+func (f *FallbackLLM) candidates() []*llmBackend {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	healthy := make([]*llmBackend, 0, len(f.backends))
+	for _, backend := range f.backends {
+		if !now.Before(backend.unhealthyUntil) {
+			healthy = append(healthy, backend)
+		}
+	}
+	if len(healthy) == 0 {
+		return f.backends
+	}
+	return healthy
+}
+
+func (f *FallbackLLM) markHealthy(backend *llmBackend) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	backend.unhealthyUntil = time.Time{}
+	backend.served++
+}
+
+func (f *FallbackLLM) markUnhealthy(backend *llmBackend, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	backend.unhealthyUntil = f.now().Add(f.cooldown)
+	backend.lastError = err.Error()
+	backend.failed++
+}
+
+// llmServedBy records which backend of a fallback chain answered a request
+type llmServedBy struct {
+	mu       sync.Mutex
+	name     string
+	fallback bool // The answer came from a fallback backend instead of the primary one
+}
+
+type llmServedByKey struct{}
+
+// withLLMServedBy returns a context that lets FallbackLLM record the backend that answered for the caller
+func withLLMServedBy(ctx context.Context) (context.Context, *llmServedBy) {
+	servedBy := &llmServedBy{}
+	return context.WithValue(ctx, llmServedByKey{}, servedBy), servedBy
+}
+
+func (s *llmServedBy) get() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.name, s.fallback
+}
+
+func (s *llmServedBy) record(name string, fallback bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+	s.fallback = fallback
+}
+
+// adaptImageParts converts the image parts of the messages to the format a backend expects:
+// base64 data URLs for OpenAI-compatible APIs, binary parts for all others
+func adaptImageParts(messages []llms.MessageContent, useImageURL bool) []llms.MessageContent {
+	adapted := make([]llms.MessageContent, len(messages))
+	for i, message := range messages {
+		parts := make([]llms.ContentPart, len(message.Parts))
+		for j, part := range message.Parts {
+			parts[j] = part
+			switch p := part.(type) {
+			case llms.BinaryContent:
+				if useImageURL {
+					parts[j] = llms.ImageURLPart(fmt.Sprintf("data:%s;base64,%s", p.MIMEType, base64.StdEncoding.EncodeToString(p.Data)))
+				}
+			case llms.ImageURLContent:
+				if !useImageURL {
+					if mimeType, data, ok := decodeDataURL(p.URL); ok {
+						parts[j] = llms.BinaryPart(mimeType, data)
+					}
+				}
+			}
+		}
+		adapted[i] = llms.MessageContent{Role: message.Role, Parts: parts}
+	}
+	return adapted
+}
+
+// decodeDataURL decodes a base64 data URL like "data:image/jpeg;base64,..."
+func decodeDataURL(url string) (string, []byte, bool) {
+	header, encoded, found := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	if !found || !strings.HasPrefix(url, "data:") || !strings.HasSuffix(header, ";base64") {
+		return "", nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, false
+	}
+	return strings.TrimSuffix(header, ";base64"), data, true
+}
+
+// llmBackendConfig is a provider and model pair from LLM_FALLBACKS or VISION_LLM_FALLBACKS
+type llmBackendConfig struct {
+	Provider string
+	Model    string
+}
+
+// parseLLMBackends parses a comma-separated list of "provider:model" entries, e.g. "ollama:qwen2.5:7b,openai:gpt-4o-mini"
+func parseLLMBackends(raw string) ([]llmBackendConfig, error) {
+	var configs []llmBackendConfig
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		provider, model, found := strings.Cut(entry, ":")
+		provider = strings.ToLower(strings.TrimSpace(provider))
+		model = strings.TrimSpace(model)
+		if !found || model == "" {
+			return nil, fmt.Errorf("invalid backend '%s', expected provider:model", entry)
+		}
+		if !isSupportedLLMProvider(provider) {
+			return nil, fmt.Errorf("unsupported provider '%s' in backend '%s'", provider, entry)
+		}
+		configs = append(configs, llmBackendConfig{Provider: provider, Model: model})
+	}
+	return configs, nil
+}
+
+// createLLMChain creates the client of the given provider and model. If fallbacks are configured,
+// the client is wrapped in a FallbackLLM together with the clients of the fallback backends.
+func createLLMChain(provider, model, fallbacks string, vision bool) (llms.Model, error) {
+	primary, err := newProviderLLM(provider, model, vision)
+	if err != nil {
+		return nil, err
+	}
+	primary = withRetry(primary, strings.ToLower(provider)+":"+model)
+
+	configs, err := parseLLMBackends(fallbacks)
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return primary, nil
+	}
+
+	backends := []*llmBackend{{
+		Name:        strings.ToLower(provider) + ":" + model,
+		Model:       primary,
+		UseImageURL: providerUsesImageURL(provider),
+	}}
+	for _, config := range configs {
+		name := config.Provider + ":" + config.Model
+		backendModel, err := newProviderLLM(config.Provider, config.Model, vision)
+		if err != nil {
+			return nil, fmt.Errorf("error creating fallback backend %s: %v", name, err)
+		}
+		backends = append(backends, &llmBackend{
+			Name:        name,
+			Model:       withRetry(backendModel, name),
+			UseImageURL: providerUsesImageURL(config.Provider),
+		})
+	}
+
+	names := make([]string, 0, len(backends))
+	for _, backend := range backends {
+		names = append(names, backend.Name)
+	}
+	log.Infof("Using LLM fallback chain: %s", strings.Join(names, " -> "))
+
+	return NewFallbackLLM(backends, llmFallbackCooldown, llmFallbackTimeout), nil
+}
+
+// llmBackendStatus returns the health of the backends behind a model, or a single entry if it has no fallbacks
+func llmBackendStatus(model llms.Model, provider, modelName string) []LLMBackendStatus {
+	if model == nil {
+		return []LLMBackendStatus{}
+	}
+	if fallback, ok := model.(*FallbackLLM); ok {
+		return fallback.Status()
+	}
+	return []LLMBackendStatus{{Name: strings.ToLower(provider) + ":" + modelName, Healthy: true}}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// hang is a respond function for mockLLM that blocks until the context is done
+func hang(ctx context.Context, _ int, _ []llms.ContentPart) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestFallbackLLM(t *testing.T) {
+	primary := &mockLLM{err: errors.New("connection refused")}
+	secondary := &mockLLM{response: "from secondary"}
+
+	fallback := NewFallbackLLM([]*llmBackend{
+		{Name: "ollama:llama3", Model: primary},
+		{Name: "openai:gpt-4o-mini", Model: secondary},
+	}, time.Minute, 0)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	fallback.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	response, err := fallback.Call(ctx, "prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "from secondary", response)
+	assert.Equal(t, 1, primary.calls)
+
+	status := fallback.Status()
+	assert.False(t, status[0].Healthy)
+	assert.Equal(t, "connection refused", status[0].LastError)
+	assert.True(t, status[1].Healthy)
+	assert.Equal(t, 1, status[1].Served)
+
+	// The unhealthy primary is skipped during the cooldown
+	_, err = fallback.Call(ctx, "prompt")
+	require.NoError(t, err)
+	assert.Equal(t, 1, primary.calls)
+	assert.Equal(t, 2, secondary.calls)
+
+	// After the cooldown the primary is tried again and serves once it has recovered
+	now = now.Add(2 * time.Minute)
+	primary.err = nil
+	primary.response = "from primary"
+	response, err = fallback.Call(ctx, "prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "from primary", response)
+	assert.True(t, fallback.Status()[0].Healthy)
+}
+
+func TestFallbackLLM_AllBackendsFail(t *testing.T) {
+	fallback := NewFallbackLLM([]*llmBackend{
+		{Name: "ollama:llama3", Model: &mockLLM{err: errors.New("connection refused")}},
+		{Name: "openai:gpt-4o-mini", Model: &mockLLM{err: errors.New("quota exceeded")}},
+	}, time.Minute, 0)
+
+	_, err := fallback.Call(context.Background(), "prompt")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ollama:llama3: connection refused")
+	assert.Contains(t, err.Error(), "openai:gpt-4o-mini: quota exceeded")
+
+	// Backends in their cooldown are still tried if no healthy backend is left
+	_, err = fallback.Call(context.Background(), "prompt")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ollama:llama3")
+}
+
+func TestFallbackLLM_Timeout(t *testing.T) {
+	primary := &mockLLM{respond: hang}
+	secondary := &mockLLM{response: "from secondary"}
+
+	fallback := NewFallbackLLM([]*llmBackend{
+		{Name: "ollama:llama3", Model: primary},
+		{Name: "openai:gpt-4o-mini", Model: secondary},
+	}, time.Minute, 10*time.Millisecond)
+
+	response, err := fallback.Call(context.Background(), "prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "from secondary", response)
+	assert.False(t, fallback.Status()[0].Healthy)
+}
+
+func TestFallbackLLM_CanceledContext(t *testing.T) {
+	primary := &mockLLM{respond: hang}
+	fallback := NewFallbackLLM([]*llmBackend{{Name: "ollama:llama3", Model: primary}}, time.Minute, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := fallback.Call(ctx, "prompt")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// A request given up by the caller does not mark the backend unhealthy
+	assert.True(t, fallback.Status()[0].Healthy)
+}
+
+func TestFallbackLLM_ImageParts(t *testing.T) {
+	ollamaBackend := &mockLLM{err: errors.New("model not loaded")}
+	openaiBackend := &mockLLM{response: "text"}
+
+	fallback := NewFallbackLLM([]*llmBackend{
+		{Name: "ollama:minicpm-v", Model: ollamaBackend},
+		{Name: "openai:gpt-4o", Model: openaiBackend, UseImageURL: true},
+	}, time.Minute, 0)
+
+	_, err := fallback.GenerateContent(context.Background(), []llms.MessageContent{{
+		Role:  llms.ChatMessageTypeHuman,
+		Parts: []llms.ContentPart{llms.BinaryPart("image/jpeg", []byte("jpeg")), llms.TextPart("transcribe")},
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, llms.BinaryPart("image/jpeg", []byte("jpeg")), ollamaBackend.lastParts[0])
+	assert.Equal(t, llms.ImageURLPart("data:image/jpeg;base64,anBlZw=="), openaiBackend.lastParts[0])
+	assert.Equal(t, llms.TextPart("transcribe"), openaiBackend.lastParts[1])
+
+	// Data URLs are converted back to binary parts
+	adapted := adaptImageParts([]llms.MessageContent{{Parts: []llms.ContentPart{llms.ImageURLPart("data:image/jpeg;base64,anBlZw==")}}}, false)
+	assert.Equal(t, llms.BinaryPart("image/jpeg", []byte("jpeg")), adapted[0].Parts[0])
+}
+
+func TestParseLLMBackends(t *testing.T) {
+	configs, err := parseLLMBackends(" ollama:qwen2.5:7b , OpenAI:gpt-4o-mini,")
+	require.NoError(t, err)
+	assert.Equal(t, []llmBackendConfig{
+		{Provider: "ollama", Model: "qwen2.5:7b"},
+		{Provider: "openai", Model: "gpt-4o-mini"},
+	}, configs)
+
+	configs, err = parseLLMBackends("")
+	require.NoError(t, err)
+	assert.Empty(t, configs)
+
+	_, err = parseLLMBackends("ollama")
+	assert.Error(t, err)
+
+	_, err = parseLLMBackends("bedrock:claude")
+	assert.Error(t, err)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/googleai"
+	"github.com/tmc/langchaingo/llms/mistral"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/llms/openai"
+	"google.golang.org/api/option"
+)
+
+// supportedLLMProviders lists the values accepted for LLM_PROVIDER and VISION_LLM_PROVIDER
+var supportedLLMProviders = []string{"openai", "ollama", "anthropic", "googleai", "mistral"}
+
+// Default endpoints of the providers, used when no base URL is configured
+const (
+	defaultOllamaHost       = "http://127.0.0.1:11434"
+	defaultAnthropicBaseURL = "https://api.anthropic.com/v1"
+	defaultMistralBaseURL   = "https://api.mistral.ai"
+)
+
+// isSupportedLLMProvider reports whether the given provider name is supported
+func isSupportedLLMProvider(provider string) bool {
+	for _, supported := range supportedLLMProviders {
+		if strings.ToLower(provider) == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// providerAPIKey returns the configured API key of a provider and the name of its environment variable.
+// The environment variable is empty for providers that don't need a key.
+func providerAPIKey(provider string) (string, string) {
+	switch strings.ToLower(provider) {
+	case "openai":
+		return openaiAPIKey, "OPENAI_API_KEY"
+	case "anthropic":
+		return anthropicAPIKey, "ANTHROPIC_API_KEY"
+	case "googleai":
+		return googleaiAPIKey, "GOOGLEAI_API_KEY"
+	case "mistral":
+		return mistralAPIKey, "MISTRAL_API_KEY"
+	}
+	return "", ""
+}
+
+// visionLLMUsesImageURL reports whether images for the vision LLM are sent as base64 data URLs
+func visionLLMUsesImageURL() bool {
+	return providerUsesImageURL(visionLlmProvider)
+}
+
+// providerUsesImageURL reports whether a provider expects images as base64 data URLs.
+// This is the case for all providers that are accessed through an OpenAI-compatible chat API.
+func providerUsesImageURL(provider string) bool {
+	switch strings.ToLower(provider) {
+	case "openai", "anthropic", "mistral":
+		return true
+	}
+	return false
+}
+
+// newProviderLLM creates a client for the given provider and model.
+// The langchaingo clients for Anthropic and Mistral only support text, so vision requests
+// to these providers use their OpenAI-compatible endpoints instead.
+func newProviderLLM(provider, model string, vision bool) (llms.Model, error) {
+	apiKey, apiKeyEnvVar := providerAPIKey(provider)
+	if apiKeyEnvVar != "" && apiKey == "" {
+		return nil, fmt.Errorf("%s is not set", apiKeyEnvVar)
+	}
+
+	switch strings.ToLower(provider) {
+	case "openai":
+		opts, err := openAIOptions(model, apiKey, vision)
+		if err != nil {
+			return nil, err
+		}
+		return openai.New(opts...)
+	case "ollama":
+		host := os.Getenv("OLLAMA_HOST")
+		if host == "" {
+			host = defaultOllamaHost
+		}
+		return ollama.New(
+			ollama.WithModel(model),
+			ollama.WithServerURL(host),
+			ollama.WithHTTPClient(llmHTTPClient),
+		)
+	case "anthropic":
+		baseURL := anthropicBaseURL
+		if baseURL == "" {
+			baseURL = defaultAnthropicBaseURL
+		}
+		if vision {
+			return openai.New(
+				openai.WithModel(model),
+				openai.WithToken(apiKey),
+				openai.WithHTTPClient(llmHTTPClient),
+				openai.WithBaseURL(baseURL),
+			)
+		}
+		return anthropic.New(
+			anthropic.WithModel(model),
+			anthropic.WithToken(apiKey),
+			anthropic.WithBaseURL(baseURL),
+			anthropic.WithHTTPClient(llmHTTPClient),
+		)
+	case "googleai":
+		opts := []googleai.Option{
+			googleai.WithDefaultModel(model),
+			googleai.WithAPIKey(apiKey),
+			// The client only adds the API key to an HTTP client of its own, so the shared client adds it itself
+			googleai.WithHTTPClient(&http.Client{Transport: &googleAPIKeyTransport{apiKey: apiKey, base: llmHTTPClient.Transport}}),
+		}
+		if googleaiBaseURL != "" {
+			opts = append(opts, func(o *googleai.Options) {
+				o.ClientOptions = append(o.ClientOptions, option.WithEndpoint(googleaiBaseURL))
+			})
+		}
+		return googleai.New(context.Background(), opts...)
+	case "mistral":
+		baseURL := strings.TrimRight(mistralBaseURL, "/")
+		if baseURL == "" {
+			baseURL = defaultMistralBaseURL
+		}
+		if vision {
+			return openai.New(
+				openai.WithModel(model),
+				openai.WithToken(apiKey),
+				openai.WithHTTPClient(llmHTTPClient),
+				openai.WithBaseURL(baseURL+"/v1"),
+			)
+		}
+		// The Mistral client doesn't accept an HTTP client, so Retry-After headers of text requests are not seen
+		return mistral.New(
+			mistral.WithModel(model),
+			mistral.WithAPIKey(apiKey),
+			mistral.WithEndpoint(baseURL),
+		)
+	}
+	return nil, fmt.Errorf("unsupported LLM provider: %s", provider)
+}
+
+// googleAPIKeyTransport adds the API key to the requests of the Google AI client
+type googleAPIKeyTransport struct {
+	apiKey string
+	base   http.RoundTripper
+}
+
+func (t *googleAPIKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("x-goog-api-key", t.apiKey)
+	return t.base.RoundTrip(req)
+}
+
+// openAIOptions builds the options of the OpenAI client from the OPENAI_* settings.
+// The vision client can use its own base URL and deployment, all other settings are shared.
+func openAIOptions(model, apiKey string, vision bool) ([]openai.Option, error) {
+	apiType, err := parseOpenAIAPIType(openaiAPIType)
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := parseExtraHeaders(openaiExtraHeaders)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := openaiBaseURL
+	deployment := openaiDeployment
+	if vision {
+		if visionOpenaiBaseURL != "" {
+			baseURL = visionOpenaiBaseURL
+		}
+		deployment = visionOpenaiDeployment
+	}
+
+	opts := []openai.Option{
+		openai.WithToken(apiKey),
+		openai.WithAPIType(apiType),
+	}
+	if baseURL != "" {
+		opts = append(opts, openai.WithBaseURL(baseURL))
+	}
+	if openaiOrganization != "" {
+		opts = append(opts, openai.WithOrganization(openaiOrganization))
+	}
+
+	if apiType == openai.APITypeOpenAI {
+		opts = append(opts, openai.WithModel(model))
+	} else {
+		// Azure addresses models by the name of their deployment
+		if deployment == "" {
+			deployment = model
+		}
+		apiVersion := openaiAPIVersion
+		if apiVersion == "" {
+			apiVersion = openai.DefaultAPIVersion
+		}
+		opts = append(opts,
+			openai.WithModel(deployment),
+			openai.WithEmbeddingModel(deployment),
+			openai.WithAPIVersion(apiVersion),
+		)
+	}
+
+	if len(headers) > 0 {
+		opts = append(opts, openai.WithHTTPClient(&headerDoer{client: llmHTTPClient, headers: headers}))
+	} else {
+		opts = append(opts, openai.WithHTTPClient(llmHTTPClient))
+	}
+
+	return opts, nil
+}
+
+// parseOpenAIAPIType parses OPENAI_API_TYPE, which is "openai" (default), "azure" or "azure_ad"
+func parseOpenAIAPIType(apiType string) (openai.APIType, error) {
+	switch strings.ToLower(apiType) {
+	case "", "openai":
+		return openai.APITypeOpenAI, nil
+	case "azure":
+		return openai.APITypeAzure, nil
+	case "azure_ad":
+		return openai.APITypeAzureAD, nil
+	}
+	return "", fmt.Errorf("unsupported API type '%s', use 'openai', 'azure' or 'azure_ad'", apiType)
+}
+
+// parseExtraHeaders parses a comma-separated list of headers like "X-Title=paperless-gpt,X-Team=finance"
+func parseExtraHeaders(raw string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, found := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid header '%s', expected Name=value", strings.TrimSpace(pair))
+		}
+		headers[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// headerDoer adds extra headers to every request sent by an LLM client
+type headerDoer struct {
+	client  *http.Client
+	headers map[string]string
+}
+
+// Do sends the request with the extra headers
+func (d *headerDoer) Do(req *http.Request) (*http.Response, error) {
+	for name, value := range d.headers {
+		req.Header.Set(name, value)
+	}
+	return d.client.Do(req)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestNewProviderLLM(t *testing.T) {
+	originalKeys := []string{openaiAPIKey, anthropicAPIKey, googleaiAPIKey, mistralAPIKey}
+	defer func() {
+		openaiAPIKey, anthropicAPIKey, googleaiAPIKey, mistralAPIKey = originalKeys[0], originalKeys[1], originalKeys[2], originalKeys[3]
+	}()
+
+	for _, provider := range []string{"anthropic", "googleai", "mistral"} {
+		for _, vision := range []bool{false, true} {
+			openaiAPIKey, anthropicAPIKey, googleaiAPIKey, mistralAPIKey = "", "", "", ""
+
+			_, err := newProviderLLM(provider, "test-model", vision)
+			assert.Error(t, err, "%s without API key should fail", provider)
+
+			openaiAPIKey, anthropicAPIKey, googleaiAPIKey, mistralAPIKey = "key", "key", "key", "key"
+			model, err := newProviderLLM(provider, "test-model", vision)
+			require.NoError(t, err, provider)
+			assert.NotNil(t, model, provider)
+		}
+	}
+
+	_, err := newProviderLLM("unknown", "test-model", false)
+	assert.Error(t, err)
+}
+
+func TestIsSupportedLLMProvider(t *testing.T) {
+	assert.True(t, isSupportedLLMProvider("openai"))
+	assert.True(t, isSupportedLLMProvider("GoogleAI"))
+	assert.True(t, isSupportedLLMProvider("mistral"))
+	assert.False(t, isSupportedLLMProvider("gemini"))
+	assert.False(t, isSupportedLLMProvider(""))
+}
+
+// setOpenAIConfig sets the OPENAI_* settings for a test and restores them afterwards
+func setOpenAIConfig(t *testing.T, baseURL, apiType, apiVersion, deployment, extraHeaders string) {
+	original := []string{openaiAPIKey, openaiBaseURL, openaiOrganization, openaiAPIType, openaiAPIVersion, openaiDeployment, openaiExtraHeaders, visionOpenaiBaseURL, visionOpenaiDeployment}
+	t.Cleanup(func() {
+		openaiAPIKey, openaiBaseURL, openaiOrganization, openaiAPIType, openaiAPIVersion = original[0], original[1], original[2], original[3], original[4]
+		openaiDeployment, openaiExtraHeaders, visionOpenaiBaseURL, visionOpenaiDeployment = original[5], original[6], original[7], original[8]
+	})
+
+	openaiAPIKey = "test-key"
+	openaiBaseURL = baseURL
+	openaiOrganization = "test-org"
+	openaiAPIType = apiType
+	openaiAPIVersion = apiVersion
+	openaiDeployment = deployment
+	openaiExtraHeaders = extraHeaders
+	visionOpenaiBaseURL = ""
+	visionOpenaiDeployment = ""
+}
+
+// chatCompletionHandler returns a minimal OpenAI chat completion after running the given checks on the request
+func chatCompletionHandler(t *testing.T, check func(r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		check(r)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "1", "object": "chat.completion", "choices": [{"index": 0, "message": {"role": "assistant", "content": "Invoice ACME"}, "finish_reason": "stop"}]}`))
+	}
+}
+
+func TestOpenAICompatibleEndpoint(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(chatCompletionHandler(t, func(r *http.Request) {
+		requests++
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+		assert.Equal(t, "test-org", r.Header.Get("OpenAI-Organization"))
+		assert.Equal(t, "paperless-gpt", r.Header.Get("X-Title"))
+		assert.Equal(t, "finance", r.Header.Get("X-Team"))
+	}))
+	defer server.Close()
+
+	setOpenAIConfig(t, server.URL+"/v1", "", "", "", "X-Title=paperless-gpt, x-team = finance")
+
+	for _, vision := range []bool{false, true} {
+		model, err := newProviderLLM("openai", "local-model", vision)
+		require.NoError(t, err)
+
+		response, err := llms.GenerateFromSinglePrompt(context.Background(), model, "Suggest a title")
+		require.NoError(t, err)
+		assert.Equal(t, "Invoice ACME", response)
+	}
+	assert.Equal(t, 2, requests)
+}
+
+func TestGoogleAIRetryAfter(t *testing.T) {
+	var apiKeys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKeys = append(apiKeys, r.Header.Get("x-goog-api-key"))
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	originalKey, originalBaseURL := googleaiAPIKey, googleaiBaseURL
+	defer func() { googleaiAPIKey, googleaiBaseURL = originalKey, originalBaseURL }()
+	googleaiAPIKey, googleaiBaseURL = "test-key", server.URL
+
+	model, err := newProviderLLM("googleai", "gemini-1.5-flash", false)
+	require.NoError(t, err)
+
+	// The shared HTTP client sends the API key and records the Retry-After header for RetryLLM
+	ctx, info := withLLMResponseInfo(context.Background())
+	_, err = llms.GenerateFromSinglePrompt(ctx, model, "Suggest a title")
+	require.Error(t, err)
+	require.NotEmpty(t, apiKeys)
+	assert.Equal(t, "test-key", apiKeys[0])
+	statusCode, retryAfter := info.get()
+	assert.Equal(t, http.StatusTooManyRequests, statusCode)
+	assert.Equal(t, 7*time.Second, retryAfter)
+}
+
+func TestOpenAIVisionBaseURL(t *testing.T) {
+	textServer := httptest.NewServer(chatCompletionHandler(t, func(r *http.Request) {
+		t.Errorf("Vision request sent to the text endpoint")
+	}))
+	defer textServer.Close()
+
+	var visionRequests int
+	visionServer := httptest.NewServer(chatCompletionHandler(t, func(r *http.Request) {
+		visionRequests++
+	}))
+	defer visionServer.Close()
+
+	setOpenAIConfig(t, textServer.URL, "", "", "", "")
+	visionOpenaiBaseURL = visionServer.URL
+
+	model, err := newProviderLLM("openai", "vision-model", true)
+	require.NoError(t, err)
+	_, err = llms.GenerateFromSinglePrompt(context.Background(), model, "Transcribe")
+	require.NoError(t, err)
+	assert.Equal(t, 1, visionRequests)
+}
+
+func TestOpenAIAzureEndpoint(t *testing.T) {
+	server := httptest.NewServer(chatCompletionHandler(t, func(r *http.Request) {
+		assert.Equal(t, "/openai/deployments/gpt4o-prod/chat/completions", r.URL.Path)
+		assert.Equal(t, "2024-06-01", r.URL.Query().Get("api-version"))
+		assert.Equal(t, "test-key", r.Header.Get("api-key"))
+	}))
+	defer server.Close()
+
+	setOpenAIConfig(t, server.URL, "azure", "2024-06-01", "gpt4o-prod", "")
+
+	model, err := newProviderLLM("openai", "gpt-4o", false)
+	require.NoError(t, err)
+
+	response, err := llms.GenerateFromSinglePrompt(context.Background(), model, "Suggest a title")
+	require.NoError(t, err)
+	assert.Equal(t, "Invoice ACME", response)
+}
+
+func TestParseExtraHeaders(t *testing.T) {
+	headers, err := parseExtraHeaders(" x-title=paperless-gpt,X-Token=a=b,, ")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"X-Title": "paperless-gpt", "X-Token": "a=b"}, headers)
+
+	headers, err = parseExtraHeaders("")
+	require.NoError(t, err)
+	assert.Empty(t, headers)
+
+	_, err = parseExtraHeaders("X-Title")
+	assert.Error(t, err)
+
+	_, err = parseOpenAIAPIType("bedrock")
+	assert.Error(t, err)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// RetryLLM is an llms.Model that retries transient failures of the wrapped model
+// with jittered exponential backoff, honouring Retry-After headers of the backend
+type RetryLLM struct {
+	model       llms.Model
+	name        string
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+
+	sleep  func(ctx context.Context, d time.Duration) error
+	jitter func(d time.Duration) time.Duration
+}
+
+// NewRetryLLM wraps a model so that each request is attempted up to maxAttempts times
+func NewRetryLLM(model llms.Model, name string, maxAttempts int, baseDelay, maxDelay time.Duration) *RetryLLM {
+	return &RetryLLM{
+		model:       model,
+		name:        name,
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+		maxDelay:    maxDelay,
+		sleep:       sleepContext,
+		jitter:      equalJitter,
+	}
+}
+
+// withRetry wraps a model in a RetryLLM unless retries are disabled with LLM_RETRY_ATTEMPTS=1
+func withRetry(model llms.Model, name string) llms.Model {
+	if llmRetryAttempts <= 1 {
+		return model
+	}
+	return NewRetryLLM(model, name, llmRetryAttempts, llmRetryBaseDelay, llmRetryMaxDelay)
+}
+
+// GenerateContent implements the llms.Model interface
+func (r *RetryLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var err error
+	for attempt := 1; ; attempt++ {
+		attemptCtx, info := withLLMResponseInfo(ctx)
+
+		var response *llms.ContentResponse
+		response, err = r.model.GenerateContent(attemptCtx, messages, options...)
+		if err == nil {
+			return response, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		statusCode, retryAfter := info.get()
+		if !isTransientLLMError(err, statusCode) {
+			return nil, fmt.Errorf("permanent LLM error: %w", err)
+		}
+		if attempt >= r.maxAttempts {
+			break
+		}
+
+		delay := r.backoff(attempt)
+		if retryAfter > 0 {
+			delay = min(retryAfter, r.maxDelay)
+		}
+		log.Warnf("LLM request to %s failed (attempt %d of %d), retrying in %s: %v", r.name, attempt, r.maxAttempts, delay.Round(time.Millisecond), err)
+
+		if err := r.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("LLM request to %s failed after %d attempts: %w", r.name, r.maxAttempts, err)
+}
+
+// Call implements the llms.Model interface
+func (r *RetryLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, r, prompt, options...)
+}
+
+// backoff returns the jittered delay before the next attempt
+func (r *RetryLLM) backoff(attempt int) time.Duration {
+	delay := r.baseDelay << (attempt - 1)
+	if delay > r.maxDelay || delay <= 0 {
+		delay = r.maxDelay
+	}
+	return r.jitter(delay)
+}
+
+// equalJitter returns a random duration between d/2 and d
+func equalJitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// sleepContext waits for the given duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+var (
+	// statusCodePattern finds HTTP status codes in the error messages of the langchaingo clients
+	statusCodePattern = regexp.MustCompile(`(?i)status(?: code)?:? (\d{3})\b`)
+
+	// permanentErrorMessages are parts of error messages that retrying cannot fix
+	permanentErrorMessages = []string{
+		"context length", "context_length_exceeded", "maximum context", "too many tokens", "prompt is too long",
+		"invalid api key", "incorrect api key", "unauthorized", "model not found", "does not exist", "invalid_request_error",
+	}
+
+	// transientErrorMessages are parts of error messages that indicate a temporary problem
+	transientErrorMessages = []string{
+		"rate limit", "too many requests", "overloaded", "timeout", "timed out", "temporarily",
+		"connection refused", "connection reset", "broken pipe", "eof", "server error", "unavailable",
+	}
+)
+
+// isTransientLLMError classifies a failed LLM request. Only rate limits, server errors and network
+// errors are transient; bad requests, authentication errors, prompts that exceed the context window
+// and errors it doesn't recognize are permanent. statusCode is the HTTP status of the response, 0 if unknown.
+func isTransientLLMError(err error, statusCode int) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, permanent := range permanentErrorMessages {
+		if strings.Contains(message, permanent) {
+			return false
+		}
+	}
+
+	if statusCode == 0 {
+		if matches := statusCodePattern.FindStringSubmatch(message); matches != nil {
+			statusCode, _ = strconv.Atoi(matches[1])
+		}
+	}
+	if statusCode != 0 {
+		switch {
+		case statusCode == http.StatusRequestTimeout, statusCode == http.StatusTooManyRequests, statusCode >= 500:
+			return true
+		case statusCode >= 400:
+			return false
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	for _, transient := range transientErrorMessages {
+		if strings.Contains(message, transient) {
+			return true
+		}
+	}
+
+	// Errors that can't be classified are not retried, retrying a permanent error only delays it
+	return false
+}
+
+// llmResponseInfo records the status and Retry-After header of the last HTTP response of an LLM request
+type llmResponseInfo struct {
+	mu         sync.Mutex
+	statusCode int
+	retryAfter time.Duration
+}
+
+type llmResponseInfoKey struct{}
+
+// withLLMResponseInfo returns a context that lets llmTransport record response details for the caller
+func withLLMResponseInfo(ctx context.Context) (context.Context, *llmResponseInfo) {
+	info := &llmResponseInfo{}
+	return context.WithValue(ctx, llmResponseInfoKey{}, info), info
+}
+
+func (i *llmResponseInfo) get() (int, time.Duration) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.statusCode, i.retryAfter
+}
+
+func (i *llmResponseInfo) record(resp *http.Response, now time.Time) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.statusCode = resp.StatusCode
+	i.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), now)
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// llmTransport records response details of LLM requests for RetryLLM
+type llmTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *llmTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		if info, ok := req.Context().Value(llmResponseInfoKey{}).(*llmResponseInfo); ok {
+			info.record(resp, time.Now())
+		}
+	}
+	return resp, err
+}
+
+// llmHTTPClient is the HTTP client of the LLM providers that accept a custom client
+var llmHTTPClient = &http.Client{Transport: &llmTransport{base: http.DefaultTransport}}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// failFirst returns a respond function for mockLLM that returns the given errors in order before it succeeds
+func failFirst(errs ...error) func(context.Context, int, []llms.ContentPart) (string, error) {
+	return func(_ context.Context, call int, _ []llms.ContentPart) (string, error) {
+		if call <= len(errs) {
+			return "", errs[call-1]
+		}
+		return "ok", nil
+	}
+}
+
+// newTestRetryLLM creates a RetryLLM without jitter that records its delays instead of sleeping
+func newTestRetryLLM(model llms.Model, maxAttempts int) (*RetryLLM, *[]time.Duration) {
+	var delays []time.Duration
+	retry := NewRetryLLM(model, "test:model", maxAttempts, time.Second, 10*time.Second)
+	retry.jitter = func(d time.Duration) time.Duration { return d }
+	retry.sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	return retry, &delays
+}
+
+func TestRetryLLM_TransientErrors(t *testing.T) {
+	model := &mockLLM{respond: failFirst(
+		errors.New("API returned unexpected status code: 503: service unavailable"),
+		errors.New("API returned unexpected status code: 429: rate limit reached"),
+	)}
+	retry, delays := newTestRetryLLM(model, 3)
+
+	response, err := retry.Call(context.Background(), "prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", response)
+	assert.Equal(t, 3, model.calls)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, *delays)
+}
+
+func TestRetryLLM_PermanentError(t *testing.T) {
+	model := &mockLLM{respond: failFirst(
+		errors.New("API returned unexpected status code: 400: This model's maximum context length is 8192 tokens"),
+	)}
+	retry, delays := newTestRetryLLM(model, 3)
+
+	_, err := retry.Call(context.Background(), "prompt")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "permanent LLM error")
+	assert.Equal(t, 1, model.calls)
+	assert.Empty(t, *delays)
+}
+
+func TestRetryLLM_GivesUp(t *testing.T) {
+	unavailable := errors.New("API returned unexpected status code: 503")
+	model := &mockLLM{respond: failFirst(unavailable, unavailable, unavailable, unavailable, unavailable)}
+	retry, delays := newTestRetryLLM(model, 5)
+
+	_, err := retry.Call(context.Background(), "prompt")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, unavailable)
+	assert.Contains(t, err.Error(), "after 5 attempts")
+	assert.Equal(t, 5, model.calls)
+	// The backoff doubles up to the maximum delay
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}, *delays)
+}
+
+func TestRetryLLM_CanceledContext(t *testing.T) {
+	model := &mockLLM{respond: failFirst(errors.New("connection refused"), errors.New("connection refused"))}
+	retry := NewRetryLLM(model, "test:model", 3, time.Hour, time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := retry.Call(ctx, "prompt")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, model.calls)
+}
+
+func TestRetryLLM_RetryAfter(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error": {"message": "Slow down"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "1", "object": "chat.completion", "choices": [{"index": 0, "message": {"role": "assistant", "content": "Invoice ACME"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	model, err := openai.New(
+		openai.WithToken("test-key"),
+		openai.WithBaseURL(server.URL),
+		openai.WithHTTPClient(llmHTTPClient),
+	)
+	require.NoError(t, err)
+	retry, delays := newTestRetryLLM(model, 3)
+
+	response, err := retry.Call(context.Background(), "prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "Invoice ACME", response)
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, []time.Duration{7 * time.Second}, *delays)
+}
+
+func TestIsTransientLLMError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+		transient  bool
+	}{
+		{name: "rate limited", err: errors.New("API returned unexpected status code: 429"), transient: true},
+		{name: "server error", err: errors.New("API returned unexpected status code: 502: bad gateway"), transient: true},
+		{name: "recorded status", err: errors.New("something went wrong"), statusCode: 503, transient: true},
+		{name: "bad request", err: errors.New("API returned unexpected status code: 400: invalid image"), transient: false},
+		{name: "unauthorized", err: errors.New("API returned unexpected status code: 401"), transient: false},
+		{name: "recorded not found", err: errors.New("model 'llava' not found"), statusCode: 404, transient: false},
+		{name: "context too long", err: errors.New("prompt is too long: 210000 tokens > 200000 maximum"), transient: false},
+		{name: "context too long with server status", err: errors.New("context length exceeded"), statusCode: 500, transient: false},
+		{name: "connection refused", err: fmt.Errorf("dial tcp: %w", syscall.ECONNREFUSED), transient: true},
+		{name: "timeout", err: context.DeadlineExceeded, transient: true},
+		{name: "canceled", err: context.Canceled, transient: false},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, transient: true},
+		{name: "unknown", err: errors.New("invalid character 'x' looking for beginning of value"), transient: false},
+		{name: "not an LLM error", err: errors.New("error downloading document 5: 404, not found"), transient: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.transient, isTransientLLMError(tc.err, tc.statusCode))
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter("Mon, 01 Jan 2024 12:01:30 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Mon, 01 Jan 2024 11:00:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
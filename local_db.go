@@ -21,6 +21,16 @@ type ModificationHistory struct {
 	UndoneDate    string `gorm:"default:null"`           // Date and time of undoing the modification
 }
 
+// DocumentFailure counts the consecutive failures of a document in one of the background processing loops
+type DocumentFailure struct {
+	ID         uint      `gorm:"primaryKey"`                                        // Auto-incrementing primary key
+	DocumentID uint      `gorm:"not null;uniqueIndex:idx_document_failure"`         // ID of the document in paperless-ngx
+	Kind       string    `gorm:"size:32;not null;uniqueIndex:idx_document_failure"` // Processing loop, e.g. "auto_tag" or "auto_ocr"
+	Attempts   int       `gorm:"not null;default:0"`                                // Number of consecutive failures
+	LastError  string    `gorm:"size:65536"`                                        // Error of the last failure
+	UpdatedAt  time.Time // Time of the last failure
+}
+
 // InitializeDB initializes the SQLite database and migrates the schema
 func InitializeDB() *gorm.DB {
 	// Ensure db directory exists
@@ -38,7 +48,7 @@ func InitializeDB() *gorm.DB {
 	}
 
 	// Migrate the schema (create the table if it doesn't exist)
-	err = db.AutoMigrate(&ModificationHistory{})
+	err = db.AutoMigrate(&ModificationHistory{}, &DocumentFailure{}, &Job{}, &OCRCacheEntry{}, &OCRTable{})
 	if err != nil {
 		log.Fatalf("Failed to migrate database schema: %v", err)
 	}
@@ -53,7 +63,11 @@ func InsertModification(db *gorm.DB, record *ModificationHistory) error {
 	log.Debugf("Inserting modification record: %+v", record)
 	result := db.Create(&record) // GORM's Create method
 	log.Debugf("Insertion result: %+v", result)
-	return result.Error
+	if result.Error != nil {
+		return result.Error
+	}
+	eventBus.Publish(eventModification, record)
+	return nil
 }
 
 // GetModification retrieves a modification record by its ID
@@ -99,3 +113,22 @@ func SetModificationUndone(db *gorm.DB, record *ModificationHistory) error {
 	result := db.Save(&record) // GORM's Save method
 	return result.Error
 }
+
+// RecordDocumentFailure increments the failure count of a document and stores the error
+func RecordDocumentFailure(db *gorm.DB, documentID uint, kind string, errorMessage string) (*DocumentFailure, error) {
+	var failure DocumentFailure
+	result := db.Where(DocumentFailure{DocumentID: documentID, Kind: kind}).FirstOrInit(&failure)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	failure.Attempts++
+	failure.LastError = errorMessage
+	result = db.Save(&failure)
+	return &failure, result.Error
+}
+
+// ClearDocumentFailures removes the failure count of a document after it was processed successfully
+func ClearDocumentFailures(db *gorm.DB, documentID uint, kind string) error {
+	result := db.Where("document_id = ? AND kind = ?", documentID, kind).Delete(&DocumentFailure{})
+	return result.Error
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -18,8 +19,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/ollama"
-	"github.com/tmc/langchaingo/llms/openai"
+	"golang.org/x/sync/semaphore"
 	"gorm.io/gorm"
 )
 
@@ -35,26 +35,80 @@ var (
 	paperlessBaseURL           = os.Getenv("PAPERLESS_BASE_URL")
 	paperlessAPIToken          = os.Getenv("PAPERLESS_API_TOKEN")
 	openaiAPIKey               = os.Getenv("OPENAI_API_KEY")
+	openaiBaseURL              = os.Getenv("OPENAI_BASE_URL")
+	openaiOrganization         = os.Getenv("OPENAI_ORGANIZATION")
+	openaiAPIType              = strings.ToLower(os.Getenv("OPENAI_API_TYPE"))
+	openaiAPIVersion           = os.Getenv("OPENAI_API_VERSION")
+	openaiDeployment           = os.Getenv("OPENAI_DEPLOYMENT")
+	openaiExtraHeaders         = os.Getenv("OPENAI_EXTRA_HEADERS")
+	visionOpenaiBaseURL        = os.Getenv("VISION_OPENAI_BASE_URL")
+	visionOpenaiDeployment     = os.Getenv("VISION_OPENAI_DEPLOYMENT")
+	anthropicAPIKey            = os.Getenv("ANTHROPIC_API_KEY")
+	anthropicBaseURL           = os.Getenv("ANTHROPIC_BASE_URL")
+	googleaiAPIKey             = os.Getenv("GOOGLEAI_API_KEY")
+	googleaiBaseURL            = os.Getenv("GOOGLEAI_BASE_URL")
+	mistralAPIKey              = os.Getenv("MISTRAL_API_KEY")
+	mistralBaseURL             = os.Getenv("MISTRAL_BASE_URL")
 	manualTag                  = os.Getenv("MANUAL_TAG")
 	autoTag                    = os.Getenv("AUTO_TAG")
-	manualOcrTag               = os.Getenv("MANUAL_OCR_TAG") // Not used yet
+	manualOcrTag               = os.Getenv("MANUAL_OCR_TAG")
 	autoOcrTag                 = os.Getenv("AUTO_OCR_TAG")
+	autoFailedTag              = os.Getenv("AUTO_FAILED_TAG")
+	autoMaxFailures            int           // Will be read from AUTO_MAX_FAILURES
+	autoPollInterval           time.Duration // Will be read from AUTO_POLL_INTERVAL
+	webhookSecret              = os.Getenv("WEBHOOK_SECRET")
 	llmProvider                = os.Getenv("LLM_PROVIDER")
 	llmModel                   = os.Getenv("LLM_MODEL")
 	visionLlmProvider          = os.Getenv("VISION_LLM_PROVIDER")
 	visionLlmModel             = os.Getenv("VISION_LLM_MODEL")
+	llmFallbacks               = os.Getenv("LLM_FALLBACKS")
+	visionLlmFallbacks         = os.Getenv("VISION_LLM_FALLBACKS")
+	llmFallbackCooldown        time.Duration // Will be read from LLM_FALLBACK_COOLDOWN
+	llmFallbackTimeout         time.Duration // Will be read from LLM_FALLBACK_TIMEOUT
+	llmRetryAttempts           int           // Will be read from LLM_RETRY_ATTEMPTS
+	llmRetryBaseDelay          time.Duration // Will be read from LLM_RETRY_BASE_DELAY
+	llmRetryMaxDelay           time.Duration // Will be read from LLM_RETRY_MAX_DELAY
 	logLevel                   = strings.ToLower(os.Getenv("LOG_LEVEL"))
 	listenInterface            = os.Getenv("LISTEN_INTERFACE")
 	autoGenerateTitle          = os.Getenv("AUTO_GENERATE_TITLE")
 	autoGenerateTags           = os.Getenv("AUTO_GENERATE_TAGS")
 	autoGenerateCorrespondents = os.Getenv("AUTO_GENERATE_CORRESPONDENTS")
-	limitOcrPages              int // Will be read from OCR_LIMIT_PAGES
-	tokenLimit                 = 0 // Will be read from TOKEN_LIMIT
+	autoGenerateDocumentTypes  = os.Getenv("AUTO_GENERATE_DOCUMENT_TYPES")
+	autoGenerateStoragePaths   = os.Getenv("AUTO_GENERATE_STORAGE_PATHS")
+	autoGenerateCustomFields   = os.Getenv("AUTO_GENERATE_CUSTOM_FIELDS")
+	autoGenerateCreatedDate    = os.Getenv("AUTO_GENERATE_CREATED_DATE")
+	useCombinedSuggestions     = os.Getenv("COMBINED_SUGGESTIONS") == "true"
+	contentStrategy            = os.Getenv("CONTENT_STRATEGY")
+	limitOcrPages              int           // Will be read from OCR_LIMIT_PAGES
+	ocrPages                   pageSelection // Will be read from OCR_PAGES, the first OCR_LIMIT_PAGES pages if unset
+	ocrWorkers                 int           // Will be read from OCR_WORKERS
+	ocrPageConcurrency         int           // Will be read from OCR_PAGE_CONCURRENCY
+	visionMaxConcurrent        int           // Will be read from VISION_LLM_MAX_CONCURRENT
+	ocrSearchablePDF           = os.Getenv("OCR_SEARCHABLE_PDF") == "true"
+	ocrCacheEnabled            = os.Getenv("OCR_CACHE") != "false"
+	ocrTables                  = os.Getenv("OCR_TABLES")
+	ocrLineItems               = os.Getenv("OCR_LINE_ITEMS")
+	ocrLineItemsField          = os.Getenv("OCR_LINE_ITEMS_FIELD")
+	ocrProvider                = os.Getenv("OCR_PROVIDER")
+	tesseractPath              = os.Getenv("TESSERACT_PATH")
+	tesseractLanguages         = os.Getenv("TESSERACT_LANGUAGES")
+	ocrHybridMinConfidence     float64  // Will be read from OCR_HYBRID_MIN_CONFIDENCE
+	ocrRenderDPI               int      // Will be read from OCR_RENDER_DPI
+	ocrJPEGQuality             int      // Will be read from OCR_JPEG_QUALITY
+	ocrPreprocess              []string // Will be read from OCR_PREPROCESS
+	ocrMaxImageDimension       int      // Will be read from OCR_MAX_IMAGE_DIMENSION
+	tokenLimit                 = 0      // Will be read from TOKEN_LIMIT
 
 	// Templates
 	titleTemplate         *template.Template
 	tagTemplate           *template.Template
 	correspondentTemplate *template.Template
+	documentTypeTemplate  *template.Template
+	storagePathTemplate   *template.Template
+	customFieldsTemplate  *template.Template
+	createdDateTemplate   *template.Template
+	combinedTemplate      *template.Template
+	summaryTemplate       *template.Template
 	ocrTemplate           *template.Template
 	templateMutex         sync.RWMutex
 
@@ -107,6 +161,128 @@ The content is likely in {{.Language}}.
 
 Document Content:
 {{.Content}}
+`
+	defaultDocumentTypeTemplate = `I will provide you with the content and the title of a document. Your task is to select the document type that best describes the document from the list of available document types I will provide. Only select a document type from the provided list. Respond only with the selected document type, without any additional information. If none of the document types fit, respond with "Unknown". The content is likely in {{.Language}}.
+
+Available Document Types:
+{{.AvailableDocumentTypes | join ", "}}
+
+Title:
+{{.Title}}
+
+Content:
+{{.Content}}
+`
+	defaultStoragePathTemplate = `I will provide you with the content and the title of a document. Your task is to select the storage path where the document should be filed from the list of available storage paths I will provide. Each storage path is listed with its name and the path template paperless-ngx uses to place files on disk. Only select a storage path from the provided list. Respond only with the name of the selected storage path, without any additional information. If none of the storage paths fit, respond with "Unknown". The content is likely in {{.Language}}.
+
+Available Storage Paths:
+{{range .AvailableStoragePaths}}- {{.Name}} (path template: {{.Path}})
+{{end}}
+Title:
+{{.Title}}
+
+Content:
+{{.Content}}
+`
+	defaultCustomFieldsTemplate = `I will provide you with the content and the title of a document. Your task is to extract the values of the custom fields listed below from the document.
+Respond only with a JSON object that maps each custom field name to its value, without any additional information or code block.
+Use null for fields whose value cannot be found in the document. Do not guess.
+
+Use these formats depending on the data type of the field:
+- string: plain text (at most 128 characters)
+- url: a full URL including the scheme, e.g. "https://example.com"
+- date: an ISO date "YYYY-MM-DD"
+- boolean: true or false
+- integer: a whole number without separators
+- float: a number with a dot as decimal separator
+- monetary: the ISO 4217 currency code followed by the amount with two decimals, e.g. "EUR1234.50"
+
+Custom Fields:
+{{range .AvailableCustomFields}}- {{.Name}} ({{.DataType}})
+{{end}}
+Title:
+{{.Title}}
+
+The content is likely in {{.Language}}.
+
+Content:
+{{.Content}}
+`
+	defaultCreatedDateTemplate = `I will provide you with the content and the title of a document. Your task is to find the date the document was created or issued, for example the invoice date, the date of a letter or the statement date.
+Ignore dates that only appear in the content, such as due dates, periods of service, delivery dates or birth dates, unless they are the date of the document itself.
+Respond only with the date in the ISO format YYYY-MM-DD, without any additional information. Today is {{.Today}}, so the date cannot be in the future.
+If you can't find the date of the document, respond with "Unknown".
+
+Title:
+{{.Title}}
+
+The content is likely in {{.Language}}.
+
+Content:
+{{.Content}}
+`
+	defaultCombinedTemplate = `I will provide you with the content and the title of a document that has been partially read by OCR (so it may contain errors). Your task is to suggest metadata for the document so it can be filed in the paperless-ngx program.
+Respond only with a single JSON object, without any additional information or code block. The JSON object must contain exactly these keys:
+{{- if .GenerateTitles}}
+- "title": a suitable title for the document (string)
+{{- end}}
+{{- if .GenerateTags}}
+- "tags": the tags that fit the document, chosen only from the available tags below (array of strings)
+{{- end}}
+{{- if .GenerateCorrespondents}}
+- "correspondent": the sender or issuer of the document, preferably one of the example correspondents below, or "Unknown" (string)
+{{- end}}
+{{- if .GenerateDocumentTypes}}
+- "document_type": the document type chosen from the available document types below, or "Unknown" (string)
+{{- end}}
+{{- if .GenerateStoragePaths}}
+- "storage_path": the name of the storage path chosen from the available storage paths below, or "Unknown" (string)
+{{- end}}
+{{- if .GenerateCustomFields}}
+- "custom_fields": an object that maps each custom field name below to its value, using null for values that cannot be found in the document (object)
+{{- end}}
+{{- if .GenerateCreatedDate}}
+- "created_date": the date the document was created or issued in the format YYYY-MM-DD, or "Unknown". Today is {{.Today}}, so the date cannot be in the future (string)
+{{- end}}
+{{if .GenerateTags}}
+Available Tags:
+{{.AvailableTags | join ", "}}
+{{end}}
+{{- if .GenerateCorrespondents}}
+Example Correspondents:
+{{.AvailableCorrespondents | join ", "}}
+
+Avoid these correspondents or variations of their names:
+{{.BlackList | join ", "}}
+{{end}}
+{{- if .GenerateDocumentTypes}}
+Available Document Types:
+{{.AvailableDocumentTypes | join ", "}}
+{{end}}
+{{- if .GenerateStoragePaths}}
+Available Storage Paths:
+{{range .AvailableStoragePaths}}- {{.Name}} (path template: {{.Path}})
+{{end}}
+{{- end}}
+{{- if .GenerateCustomFields}}
+Custom Fields (use ISO dates, true/false for booleans and e.g. "EUR1234.50" for monetary values):
+{{range .AvailableCustomFields}}- {{.Name}} ({{.DataType}})
+{{end}}
+{{- end}}
+Title:
+{{.Title}}
+
+The content is likely in {{.Language}}.
+
+Content:
+{{.Content}}
+`
+	defaultSummaryTemplate = `I will provide you with a part of a longer document that has been read by OCR (so it may contain errors). Your task is to condense this part so that it can be used later to find the title, tags and correspondent of the whole document.
+Keep all names of people and companies, addresses, dates, amounts, totals, reference numbers and the kind of document. Leave out boilerplate, repeated table rows and legal fine print.
+Respond only with the condensed text in {{.Language}}, without any additional information.
+
+Content:
+{{.Content}}
 `
 	defaultOcrPrompt = `Just transcribe the text in this image and preserve the formatting and layout (high quality OCR). Do that for ALL the text in the image. Be thorough and pay attention. This is very important. The image is from a text document so be sure to continue until the bottom of the page. Thanks a lot! You tend to forget about some text in the image so please focus! Use markdown format but without a code block.`
 )
@@ -117,6 +293,7 @@ type App struct {
 	Database  *gorm.DB
 	LLM       llms.Model
 	VisionLLM llms.Model
+	OCREngine OCREngine // Engine that reads the pages for OCR, the vision LLM if nil
 }
 
 func main() {
@@ -134,6 +311,7 @@ func main() {
 
 	// Initialize Database
 	database := InitializeDB()
+	jobStore = NewJobStore(database)
 
 	// Load Templates
 	loadTemplates()
@@ -157,46 +335,56 @@ func main() {
 		LLM:       llm,
 		VisionLLM: visionLlm,
 	}
+	app.OCREngine = createOCREngine(app)
 
 	// Start background process for auto-tagging
 	go func() {
 		minBackoffDuration := 10 * time.Second
 		maxBackoffDuration := time.Hour
-		pollingInterval := 10 * time.Second
 
 		backoffDuration := minBackoffDuration
+		nextPoll := time.Now()
 		for {
-			processedCount, err := func() (int, error) {
-				count := 0
-				if isOcrEnabled() {
-					ocrCount, err := app.processAutoOcrTagDocuments()
-					if err != nil {
-						return 0, fmt.Errorf("error in processAutoOcrTagDocuments: %w", err)
-					}
-					count += ocrCount
-				}
-				autoCount, err := app.processAutoTagDocuments()
-				if err != nil {
-					return 0, fmt.Errorf("error in processAutoTagDocuments: %w", err)
+			// Documents sent by the webhook are processed right away
+			queuedCount := app.processQueuedDocuments()
+
+			var err error
+			polledCount := 0
+			if autoPollInterval > 0 && !time.Now().Before(nextPoll) {
+				var pollErr error
+				polledCount, pollErr = app.pollAutoDocuments()
+				if pollErr != nil {
+					err = errors.Join(err, pollErr)
+				} else if polledCount == 0 {
+					// Poll again right away while documents are left, otherwise wait for the interval
+					nextPoll = time.Now().Add(autoPollInterval)
 				}
-				count += autoCount
-				return count, nil
-			}()
+			}
 
 			if err != nil {
-				log.Errorf("Error in processAutoTagDocuments: %v", err)
+				log.Errorf("Error in automatic processing: %v", err)
 				time.Sleep(backoffDuration)
 				backoffDuration *= 2 // Exponential backoff
 				if backoffDuration > maxBackoffDuration {
-					log.Warnf("Repeated errors in processAutoTagDocuments detected. Setting backoff to %v", maxBackoffDuration)
+					log.Warnf("Repeated errors in automatic processing detected. Setting backoff to %v", maxBackoffDuration)
 					backoffDuration = maxBackoffDuration
 				}
-			} else {
-				backoffDuration = minBackoffDuration
+				continue
 			}
+			backoffDuration = minBackoffDuration
 
-			if processedCount == 0 {
-				time.Sleep(pollingInterval)
+			if queuedCount+polledCount > 0 {
+				continue
+			}
+
+			// Wait for the next webhook or the next poll, whatever comes first
+			var pollTimer <-chan time.Time
+			if autoPollInterval > 0 {
+				pollTimer = time.After(time.Until(nextPoll))
+			}
+			select {
+			case <-autoQueue.ready:
+			case <-pollTimer:
 			}
 		}
 	}()
@@ -213,7 +401,7 @@ func main() {
 		api.POST("/generate-suggestions", app.generateSuggestionsHandler)
 		api.PATCH("/update-documents", app.updateDocumentsHandler)
 		api.GET("/filter-tag", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{"tag": manualTag})
+			c.JSON(http.StatusOK, gin.H{"tag": manualTag, "ocr_tag": manualOcrTag})
 		})
 		// Get all tags
 		api.GET("/tags", app.getAllTagsHandler)
@@ -224,6 +412,20 @@ func main() {
 		api.POST("/documents/:id/ocr", app.submitOCRJobHandler)
 		api.GET("/jobs/ocr/:job_id", app.getJobStatusHandler)
 		api.GET("/jobs/ocr", app.getAllJobsHandler)
+		api.DELETE("/jobs/ocr", app.deleteJobsHandler)
+		api.DELETE("/jobs/ocr/:job_id", app.cancelJobHandler)
+		api.POST("/jobs/ocr/:job_id/retry", app.retryJobHandler)
+
+		// Manual OCR workflow for documents with the manual OCR tag
+		api.GET("/ocr/documents", app.ocrDocumentsHandler)
+		api.POST("/jobs/ocr/:job_id/accept", app.acceptOCRJobHandler)
+		api.POST("/jobs/ocr/:job_id/reject", app.rejectOCRJobHandler)
+
+		// Cache of the OCR results of the vision LLM
+		api.DELETE("/ocr/cache", app.purgeOCRCacheHandler)
+
+		// Tables found by OCR with OCR_TABLES
+		api.GET("/documents/:id/tables", app.getDocumentTablesHandler)
 
 		// Endpoint to see if user enabled OCR
 		api.GET("/experimental/ocr", func(c *gin.Context) {
@@ -231,6 +433,15 @@ func main() {
 			c.JSON(http.StatusOK, gin.H{"enabled": enabled})
 		})
 
+		// Stream of job, processing and history events
+		api.GET("/events", app.eventsHandler)
+
+		// Webhook for paperless-ngx workflows
+		api.POST("/webhooks/paperless", app.paperlessWebhookHandler)
+
+		// Health of the LLM backends
+		api.GET("/llm/backends", app.getLLMBackendsHandler)
+
 		// Local db actions
 		api.GET("/modifications", app.getModificationHistoryHandler)
 		api.POST("/undo-modification/:id", app.undoModificationHandler)
@@ -280,8 +491,7 @@ func main() {
 	})
 
 	// Start OCR worker pool
-	numWorkers := 1 // Number of workers to start
-	startWorkerPool(app, numWorkers)
+	startWorkerPool(app, ocrWorkers)
 
 	if listenInterface == "" {
 		listenInterface = ":8080"
@@ -338,6 +548,9 @@ func initLogger() {
 }
 
 func isOcrEnabled() bool {
+	if ocrProvider == ocrProviderTesseract {
+		return true
+	}
 	return visionLlmModel != "" && visionLlmProvider != ""
 }
 
@@ -367,6 +580,36 @@ func validateOrDefaultEnvVars() {
 		fmt.Printf("Using %s as auto OCR tag\n", autoOcrTag)
 	}
 
+	if autoFailedTag == "" {
+		autoFailedTag = "paperless-gpt-failed"
+	}
+	fmt.Printf("Using %s as failed tag\n", autoFailedTag)
+
+	autoMaxFailures = 3
+	if rawMaxFailures := os.Getenv("AUTO_MAX_FAILURES"); rawMaxFailures != "" {
+		var err error
+		autoMaxFailures, err = strconv.Atoi(rawMaxFailures)
+		if err != nil || autoMaxFailures < 1 {
+			log.Fatalf("Invalid AUTO_MAX_FAILURES value: '%s'. Use a number of at least 1.", rawMaxFailures)
+		}
+	}
+
+	// Polling is only a safety net when paperless-ngx triggers the webhook
+	autoPollInterval = 10 * time.Second
+	if webhookSecret != "" {
+		autoPollInterval = 10 * time.Minute
+	}
+	if rawInterval := os.Getenv("AUTO_POLL_INTERVAL"); rawInterval != "" {
+		var err error
+		autoPollInterval, err = time.ParseDuration(rawInterval)
+		if err != nil || autoPollInterval < 0 {
+			log.Fatalf("Invalid AUTO_POLL_INTERVAL value: '%s'. Use a duration like '10m', or '0' to disable polling.", rawInterval)
+		}
+	}
+	if autoPollInterval == 0 && webhookSecret == "" {
+		log.Fatal("Polling is disabled with AUTO_POLL_INTERVAL=0, please set WEBHOOK_SECRET to process documents via the webhook.")
+	}
+
 	if paperlessBaseURL == "" {
 		log.Fatal("Please set the PAPERLESS_BASE_URL environment variable.")
 	}
@@ -379,16 +622,86 @@ func validateOrDefaultEnvVars() {
 		log.Fatal("Please set the LLM_PROVIDER environment variable.")
 	}
 
-	if visionLlmProvider != "" && visionLlmProvider != "openai" && visionLlmProvider != "ollama" {
-		log.Fatal("Please set the LLM_PROVIDER environment variable to 'openai' or 'ollama'.")
+	if !isSupportedLLMProvider(llmProvider) {
+		log.Fatalf("Please set the LLM_PROVIDER environment variable to one of: %s.", strings.Join(supportedLLMProviders, ", "))
+	}
+
+	if visionLlmProvider != "" && !isSupportedLLMProvider(visionLlmProvider) {
+		log.Fatalf("Please set the VISION_LLM_PROVIDER environment variable to one of: %s.", strings.Join(supportedLLMProviders, ", "))
 	}
 
 	if llmModel == "" {
 		log.Fatal("Please set the LLM_MODEL environment variable.")
 	}
 
-	if (llmProvider == "openai" || visionLlmProvider == "openai") && openaiAPIKey == "" {
-		log.Fatal("Please set the OPENAI_API_KEY environment variable for OpenAI provider.")
+	for _, provider := range []string{llmProvider, visionLlmProvider} {
+		if apiKey, apiKeyEnvVar := providerAPIKey(provider); apiKeyEnvVar != "" && apiKey == "" {
+			log.Fatalf("Please set the %s environment variable for the %s provider.", apiKeyEnvVar, strings.ToLower(provider))
+		}
+	}
+
+	for envVar, fallbacks := range map[string]string{"LLM_FALLBACKS": llmFallbacks, "VISION_LLM_FALLBACKS": visionLlmFallbacks} {
+		configs, err := parseLLMBackends(fallbacks)
+		if err != nil {
+			log.Fatalf("Invalid %s value: %v", envVar, err)
+		}
+		for _, config := range configs {
+			if apiKey, apiKeyEnvVar := providerAPIKey(config.Provider); apiKeyEnvVar != "" && apiKey == "" {
+				log.Fatalf("Please set the %s environment variable for the %s provider in %s.", apiKeyEnvVar, config.Provider, envVar)
+			}
+		}
+	}
+
+	llmFallbackCooldown = 5 * time.Minute
+	if rawCooldown := os.Getenv("LLM_FALLBACK_COOLDOWN"); rawCooldown != "" {
+		var err error
+		llmFallbackCooldown, err = time.ParseDuration(rawCooldown)
+		if err != nil || llmFallbackCooldown < 0 {
+			log.Fatalf("Invalid LLM_FALLBACK_COOLDOWN value: '%s'. Use a duration like '5m'.", rawCooldown)
+		}
+	}
+
+	if rawTimeout := os.Getenv("LLM_FALLBACK_TIMEOUT"); rawTimeout != "" {
+		var err error
+		llmFallbackTimeout, err = time.ParseDuration(rawTimeout)
+		if err != nil || llmFallbackTimeout < 0 {
+			log.Fatalf("Invalid LLM_FALLBACK_TIMEOUT value: '%s'. Use a duration like '2m'.", rawTimeout)
+		}
+	}
+
+	llmRetryAttempts = 3
+	if rawAttempts := os.Getenv("LLM_RETRY_ATTEMPTS"); rawAttempts != "" {
+		var err error
+		llmRetryAttempts, err = strconv.Atoi(rawAttempts)
+		if err != nil || llmRetryAttempts < 1 {
+			log.Fatalf("Invalid LLM_RETRY_ATTEMPTS value: '%s'. Use a number of at least 1.", rawAttempts)
+		}
+	}
+
+	llmRetryBaseDelay = 2 * time.Second
+	if rawDelay := os.Getenv("LLM_RETRY_BASE_DELAY"); rawDelay != "" {
+		var err error
+		llmRetryBaseDelay, err = time.ParseDuration(rawDelay)
+		if err != nil || llmRetryBaseDelay <= 0 {
+			log.Fatalf("Invalid LLM_RETRY_BASE_DELAY value: '%s'. Use a duration like '2s'.", rawDelay)
+		}
+	}
+
+	llmRetryMaxDelay = time.Minute
+	if rawDelay := os.Getenv("LLM_RETRY_MAX_DELAY"); rawDelay != "" {
+		var err error
+		llmRetryMaxDelay, err = time.ParseDuration(rawDelay)
+		if err != nil || llmRetryMaxDelay < llmRetryBaseDelay {
+			log.Fatalf("Invalid LLM_RETRY_MAX_DELAY value: '%s'. Use a duration like '1m' that is not below LLM_RETRY_BASE_DELAY.", rawDelay)
+		}
+	}
+
+	if _, err := parseOpenAIAPIType(openaiAPIType); err != nil {
+		log.Fatalf("Invalid OPENAI_API_TYPE value: %v", err)
+	}
+
+	if _, err := parseExtraHeaders(openaiExtraHeaders); err != nil {
+		log.Fatalf("Invalid OPENAI_EXTRA_HEADERS value: %v", err)
 	}
 
 	if isOcrEnabled() {
@@ -402,8 +715,122 @@ func validateOrDefaultEnvVars() {
 				log.Fatalf("Invalid OCR_LIMIT_PAGES value: %v", err)
 			}
 		}
+
+		ocrPages = firstPages(limitOcrPages)
+		if raw := os.Getenv("OCR_PAGES"); raw != "" {
+			if rawLimitOcrPages != "" {
+				log.Warnf("OCR_PAGES and OCR_LIMIT_PAGES are both set, OCR_LIMIT_PAGES is ignored")
+			}
+			var err error
+			ocrPages, err = parsePageSelection(raw)
+			if err != nil {
+				log.Fatalf("Invalid OCR_PAGES value: %v", err)
+			}
+		}
 	}
 
+	if ocrProvider == "" {
+		ocrProvider = ocrProviderLLM
+	}
+	switch ocrProvider {
+	case ocrProviderLLM, ocrProviderTesseract:
+	case ocrProviderHybrid:
+		if visionLlmProvider == "" || visionLlmModel == "" {
+			log.Fatal("OCR_PROVIDER 'hybrid' requires VISION_LLM_PROVIDER and VISION_LLM_MODEL for the pages Tesseract can't read")
+		}
+	default:
+		log.Fatalf("Invalid OCR_PROVIDER value: '%s'. Use 'llm', 'tesseract' or 'hybrid'.", ocrProvider)
+	}
+	if tesseractPath == "" {
+		tesseractPath = "tesseract"
+	}
+	if tesseractLanguages == "" {
+		tesseractLanguages = "eng"
+	}
+	ocrHybridMinConfidence = 80
+	if raw := os.Getenv("OCR_HYBRID_MIN_CONFIDENCE"); raw != "" {
+		var err error
+		ocrHybridMinConfidence, err = strconv.ParseFloat(raw, 64)
+		if err != nil || ocrHybridMinConfidence < 0 || ocrHybridMinConfidence > 100 {
+			log.Fatalf("Invalid OCR_HYBRID_MIN_CONFIDENCE value: '%s'. Use a number from 0 to 100.", raw)
+		}
+	}
+
+	ocrRenderDPI = defaultRenderDPI
+	if raw := os.Getenv("OCR_RENDER_DPI"); raw != "" {
+		var err error
+		ocrRenderDPI, err = strconv.Atoi(raw)
+		if err != nil || ocrRenderDPI < 72 || ocrRenderDPI > 1200 {
+			log.Fatalf("Invalid OCR_RENDER_DPI value: '%s'. Use a number from 72 to 1200.", raw)
+		}
+	}
+	ocrJPEGQuality = defaultJPEGQuality
+	if raw := os.Getenv("OCR_JPEG_QUALITY"); raw != "" {
+		var err error
+		ocrJPEGQuality, err = strconv.Atoi(raw)
+		if err != nil || ocrJPEGQuality < 1 || ocrJPEGQuality > 100 {
+			log.Fatalf("Invalid OCR_JPEG_QUALITY value: '%s'. Use a number from 1 to 100.", raw)
+		}
+	}
+	var err error
+	ocrPreprocess, err = parsePreprocessSteps(os.Getenv("OCR_PREPROCESS"))
+	if err != nil {
+		log.Fatalf("Invalid OCR_PREPROCESS value: %v", err)
+	}
+	// By default images are only scaled down to the size the vision provider works with
+	ocrMaxImageDimension = defaultMaxImageDimension(visionLlmProvider)
+	if raw := os.Getenv("OCR_MAX_IMAGE_DIMENSION"); raw != "" {
+		ocrMaxImageDimension, err = strconv.Atoi(raw)
+		if err != nil || ocrMaxImageDimension < 0 {
+			log.Fatalf("Invalid OCR_MAX_IMAGE_DIMENSION value: '%s'. Use a number of pixels, or 0 for no limit.", raw)
+		}
+	}
+
+	switch ocrTables {
+	case "", ocrTablesMarkdown, ocrTablesJSON:
+	default:
+		log.Fatalf("Invalid OCR_TABLES value: '%s'. Use 'markdown' or 'json'.", ocrTables)
+	}
+	switch ocrLineItems {
+	case "":
+	case lineItemsNote, lineItemsCustomField:
+		if ocrTables == "" {
+			log.Fatal("OCR_LINE_ITEMS requires OCR_TABLES to be set")
+		}
+		if ocrLineItems == lineItemsCustomField && ocrLineItemsField == "" {
+			log.Fatal("OCR_LINE_ITEMS 'custom_field' requires OCR_LINE_ITEMS_FIELD to be set")
+		}
+	default:
+		log.Fatalf("Invalid OCR_LINE_ITEMS value: '%s'. Use 'note' or 'custom_field'.", ocrLineItems)
+	}
+
+	if ocrSearchablePDF && !ocrPages.isAll() {
+		log.Warnf("OCR_SEARCHABLE_PDF is enabled, but only the pages '%s' are read: searchable PDFs of longer documents will only contain these pages", ocrPages)
+	}
+
+	ocrWorkers = 1
+	ocrPageConcurrency = 1
+	for envVar, value := range map[string]*int{"OCR_WORKERS": &ocrWorkers, "OCR_PAGE_CONCURRENCY": &ocrPageConcurrency} {
+		if raw := os.Getenv(envVar); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 {
+				log.Fatalf("Invalid %s value: '%s'. Use a number of at least 1.", envVar, raw)
+			}
+			*value = parsed
+		}
+	}
+
+	// By default the vision LLM gets as many concurrent requests as the OCR jobs can send
+	visionMaxConcurrent = ocrWorkers * ocrPageConcurrency
+	if raw := os.Getenv("VISION_LLM_MAX_CONCURRENT"); raw != "" {
+		var err error
+		visionMaxConcurrent, err = strconv.Atoi(raw)
+		if err != nil || visionMaxConcurrent < 1 {
+			log.Fatalf("Invalid VISION_LLM_MAX_CONCURRENT value: '%s'. Use a number of at least 1.", raw)
+		}
+	}
+	visionRequests = semaphore.NewWeighted(int64(visionMaxConcurrent))
+
 	// Initialize token limit from environment variable
 	if limit := os.Getenv("TOKEN_LIMIT"); limit != "" {
 		if parsed, err := strconv.Atoi(limit); err == nil {
@@ -414,6 +841,21 @@ func validateOrDefaultEnvVars() {
 			log.Infof("Using token limit: %d", tokenLimit)
 		}
 	}
+
+	switch contentStrategy {
+	case "":
+		contentStrategy = contentStrategyTruncate
+	case contentStrategyTruncate, contentStrategyMapReduce:
+	default:
+		log.Fatalf("Invalid CONTENT_STRATEGY value: '%s'. Use '%s' or '%s'.", contentStrategy, contentStrategyTruncate, contentStrategyMapReduce)
+	}
+	if contentStrategy == contentStrategyMapReduce {
+		// Without a limit there is nothing to condense the content to
+		if tokenLimit == 0 {
+			log.Fatalf("CONTENT_STRATEGY '%s' requires TOKEN_LIMIT to be set", contentStrategyMapReduce)
+		}
+		log.Infof("Condensing content longer than %d tokens with map-reduce", condensedTokenBudget())
+	}
 }
 
 // documentLogger creates a logger with document context
@@ -421,6 +863,24 @@ func documentLogger(documentID int) *logrus.Entry {
 	return log.WithField("document_id", documentID)
 }
 
+// pollAutoDocuments processes the documents tagged with autoOcrTag and autoTag
+func (app *App) pollAutoDocuments() (int, error) {
+	count := 0
+	if isOcrEnabled() {
+		ocrCount, err := app.processAutoOcrTagDocuments()
+		if err != nil {
+			return 0, fmt.Errorf("error in processAutoOcrTagDocuments: %w", err)
+		}
+		count += ocrCount
+	}
+	autoCount, err := app.processAutoTagDocuments()
+	if err != nil {
+		return 0, fmt.Errorf("error in processAutoTagDocuments: %w", err)
+	}
+	count += autoCount
+	return count, nil
+}
+
 // processAutoTagDocuments handles the background auto-tagging of documents
 func (app *App) processAutoTagDocuments() (int, error) {
 	ctx := context.Background()
@@ -437,30 +897,43 @@ func (app *App) processAutoTagDocuments() (int, error) {
 
 	log.Debugf("Found at least %d remaining documents with tag %s", len(documents), autoTag)
 
-	for _, document := range documents {
-		docLogger := documentLogger(document.ID)
-		docLogger.Info("Processing document for auto-tagging")
+	return app.autoTagDocuments(ctx, documents)
+}
 
-		suggestionRequest := GenerateSuggestionsRequest{
-			Documents:              []Document{document},
-			GenerateTitles:         strings.ToLower(autoGenerateTitle) != "false",
-			GenerateTags:           strings.ToLower(autoGenerateTags) != "false",
-			GenerateCorrespondents: strings.ToLower(autoGenerateCorrespondents) != "false",
-		}
+// autoTagDocuments generates and applies suggestions for documents tagged with autoTag
+func (app *App) autoTagDocuments(ctx context.Context, documents []Document) (int, error) {
+	return app.processAutoBatch(ctx, autoFailureKindTag, autoTag, documents, func(document Document, docLogger *logrus.Entry) error {
+		return app.autoTagDocument(ctx, document, docLogger)
+	})
+}
 
-		suggestions, err := app.generateDocumentSuggestions(ctx, suggestionRequest, docLogger)
-		if err != nil {
-			return 0, fmt.Errorf("error generating suggestions for document %d: %w", document.ID, err)
-		}
+// autoTagDocument generates and applies suggestions for a single document tagged with autoTag
+func (app *App) autoTagDocument(ctx context.Context, document Document, docLogger *logrus.Entry) error {
+	docLogger.Info("Processing document for auto-tagging")
+
+	suggestionRequest := GenerateSuggestionsRequest{
+		Documents:              []Document{document},
+		GenerateTitles:         strings.ToLower(autoGenerateTitle) != "false",
+		GenerateTags:           strings.ToLower(autoGenerateTags) != "false",
+		GenerateCorrespondents: strings.ToLower(autoGenerateCorrespondents) != "false",
+		GenerateDocumentTypes:  strings.ToLower(autoGenerateDocumentTypes) == "true",
+		GenerateStoragePaths:   strings.ToLower(autoGenerateStoragePaths) == "true",
+		GenerateCustomFields:   strings.ToLower(autoGenerateCustomFields) == "true",
+		GenerateCreatedDate:    strings.ToLower(autoGenerateCreatedDate) == "true",
+	}
 
-		err = app.Client.UpdateDocuments(ctx, suggestions, app.Database, false)
-		if err != nil {
-			return 0, fmt.Errorf("error updating document %d: %w", document.ID, err)
-		}
+	suggestions, err := app.generateDocumentSuggestions(ctx, suggestionRequest, docLogger)
+	if err != nil {
+		return fmt.Errorf("error generating suggestions: %w", err)
+	}
 
-		docLogger.Info("Successfully processed document")
+	err = app.Client.UpdateDocuments(ctx, suggestions, app.Database, false)
+	if err != nil {
+		return fmt.Errorf("error updating document: %w", err)
 	}
-	return len(documents), nil
+
+	docLogger.Info("Successfully processed document")
+	return nil
 }
 
 // processAutoOcrTagDocuments handles the background auto-tagging of OCR documents
@@ -479,31 +952,40 @@ func (app *App) processAutoOcrTagDocuments() (int, error) {
 
 	log.Debugf("Found at least %d remaining documents with tag %s", len(documents), autoOcrTag)
 
-	for _, document := range documents {
-		docLogger := documentLogger(document.ID)
-		docLogger.Info("Processing document for OCR")
+	return app.autoOcrDocuments(ctx, documents)
+}
 
-		ocrContent, err := app.ProcessDocumentOCR(ctx, document.ID)
-		if err != nil {
-			return 0, fmt.Errorf("error processing OCR for document %d: %w", document.ID, err)
-		}
-		docLogger.Debug("OCR processing completed")
-
-		err = app.Client.UpdateDocuments(ctx, []DocumentSuggestion{
-			{
-				ID:               document.ID,
-				OriginalDocument: document,
-				SuggestedContent: ocrContent,
-				RemoveTags:       []string{autoOcrTag},
-			},
-		}, app.Database, false)
-		if err != nil {
-			return 0, fmt.Errorf("error updating document %d after OCR: %w", document.ID, err)
-		}
+// autoOcrDocuments runs OCR on documents tagged with autoOcrTag and replaces their content
+func (app *App) autoOcrDocuments(ctx context.Context, documents []Document) (int, error) {
+	return app.processAutoBatch(ctx, autoFailureKindOCR, autoOcrTag, documents, func(document Document, docLogger *logrus.Entry) error {
+		return app.autoOcrDocument(ctx, document, docLogger)
+	})
+}
+
+// autoOcrDocument runs OCR on a single document tagged with autoOcrTag and replaces its content
+func (app *App) autoOcrDocument(ctx context.Context, document Document, docLogger *logrus.Entry) error {
+	docLogger.Info("Processing document for OCR")
 
-		docLogger.Info("Successfully processed document OCR")
+	ocrContent, err := app.ProcessDocumentOCR(ctx, document.ID, ocrPages, nil)
+	if err != nil {
+		return fmt.Errorf("error processing OCR: %w", err)
+	}
+	docLogger.Debug("OCR processing completed")
+
+	err = app.Client.UpdateDocuments(ctx, []DocumentSuggestion{
+		{
+			ID:               document.ID,
+			OriginalDocument: document,
+			SuggestedContent: ocrContent,
+			RemoveTags:       []string{autoOcrTag},
+		},
+	}, app.Database, false)
+	if err != nil {
+		return fmt.Errorf("error updating document after OCR: %w", err)
 	}
-	return 1, nil
+
+	docLogger.Info("Successfully processed document OCR")
+	return nil
 }
 
 // removeTagFromList removes a specific tag from a list of tags
@@ -582,6 +1064,96 @@ func loadTemplates() {
 		log.Fatalf("Failed to parse correspondent template: %v", err)
 	}
 
+	// Load document type template
+	documentTypeTemplatePath := filepath.Join(promptsDir, "document_type_prompt.tmpl")
+	documentTypeTemplateContent, err := os.ReadFile(documentTypeTemplatePath)
+	if err != nil {
+		log.Errorf("Could not read %s, using default template: %v", documentTypeTemplatePath, err)
+		documentTypeTemplateContent = []byte(defaultDocumentTypeTemplate)
+		if err := os.WriteFile(documentTypeTemplatePath, documentTypeTemplateContent, os.ModePerm); err != nil {
+			log.Fatalf("Failed to write default document type template to disk: %v", err)
+		}
+	}
+	documentTypeTemplate, err = template.New("document_type").Funcs(sprig.FuncMap()).Parse(string(documentTypeTemplateContent))
+	if err != nil {
+		log.Fatalf("Failed to parse document type template: %v", err)
+	}
+
+	// Load storage path template
+	storagePathTemplatePath := filepath.Join(promptsDir, "storage_path_prompt.tmpl")
+	storagePathTemplateContent, err := os.ReadFile(storagePathTemplatePath)
+	if err != nil {
+		log.Errorf("Could not read %s, using default template: %v", storagePathTemplatePath, err)
+		storagePathTemplateContent = []byte(defaultStoragePathTemplate)
+		if err := os.WriteFile(storagePathTemplatePath, storagePathTemplateContent, os.ModePerm); err != nil {
+			log.Fatalf("Failed to write default storage path template to disk: %v", err)
+		}
+	}
+	storagePathTemplate, err = template.New("storage_path").Funcs(sprig.FuncMap()).Parse(string(storagePathTemplateContent))
+	if err != nil {
+		log.Fatalf("Failed to parse storage path template: %v", err)
+	}
+
+	// Load custom fields template
+	customFieldsTemplatePath := filepath.Join(promptsDir, "custom_fields_prompt.tmpl")
+	customFieldsTemplateContent, err := os.ReadFile(customFieldsTemplatePath)
+	if err != nil {
+		log.Errorf("Could not read %s, using default template: %v", customFieldsTemplatePath, err)
+		customFieldsTemplateContent = []byte(defaultCustomFieldsTemplate)
+		if err := os.WriteFile(customFieldsTemplatePath, customFieldsTemplateContent, os.ModePerm); err != nil {
+			log.Fatalf("Failed to write default custom fields template to disk: %v", err)
+		}
+	}
+	customFieldsTemplate, err = template.New("custom_fields").Funcs(sprig.FuncMap()).Parse(string(customFieldsTemplateContent))
+	if err != nil {
+		log.Fatalf("Failed to parse custom fields template: %v", err)
+	}
+
+	// Load created date template
+	createdDateTemplatePath := filepath.Join(promptsDir, "created_date_prompt.tmpl")
+	createdDateTemplateContent, err := os.ReadFile(createdDateTemplatePath)
+	if err != nil {
+		log.Errorf("Could not read %s, using default template: %v", createdDateTemplatePath, err)
+		createdDateTemplateContent = []byte(defaultCreatedDateTemplate)
+		if err := os.WriteFile(createdDateTemplatePath, createdDateTemplateContent, os.ModePerm); err != nil {
+			log.Fatalf("Failed to write default created date template to disk: %v", err)
+		}
+	}
+	createdDateTemplate, err = template.New("created_date").Funcs(sprig.FuncMap()).Parse(string(createdDateTemplateContent))
+	if err != nil {
+		log.Fatalf("Failed to parse created date template: %v", err)
+	}
+
+	// Load combined template
+	combinedTemplatePath := filepath.Join(promptsDir, "combined_prompt.tmpl")
+	combinedTemplateContent, err := os.ReadFile(combinedTemplatePath)
+	if err != nil {
+		log.Errorf("Could not read %s, using default template: %v", combinedTemplatePath, err)
+		combinedTemplateContent = []byte(defaultCombinedTemplate)
+		if err := os.WriteFile(combinedTemplatePath, combinedTemplateContent, os.ModePerm); err != nil {
+			log.Fatalf("Failed to write default combined template to disk: %v", err)
+		}
+	}
+	combinedTemplate, err = template.New("combined").Funcs(sprig.FuncMap()).Parse(string(combinedTemplateContent))
+	if err != nil {
+		log.Fatalf("Failed to parse combined template: %v", err)
+	}
+
+	// Load summary template
+	summaryTemplatePath := filepath.Join(promptsDir, "summary_prompt.tmpl")
+	summaryTemplateContent, err := os.ReadFile(summaryTemplatePath)
+	if err != nil {
+		log.Errorf("Could not read %s, using default template: %v", summaryTemplatePath, err)
+		summaryTemplateContent = []byte(defaultSummaryTemplate)
+		if err := os.WriteFile(summaryTemplatePath, summaryTemplateContent, os.ModePerm); err != nil {
+			log.Fatalf("Failed to write default summary template to disk: %v", err)
+		}
+	}
+	summaryTemplate, err = template.New("summary").Funcs(sprig.FuncMap()).Parse(string(summaryTemplateContent))
+	if err != nil {
+		log.Fatalf("Failed to parse summary template: %v", err)
+	}
+
 	// Load OCR template
 	ocrTemplatePath := filepath.Join(promptsDir, "ocr_prompt.tmpl")
 	ocrTemplateContent, err := os.ReadFile(ocrTemplatePath)
@@ -600,50 +1172,13 @@ func loadTemplates() {
 
 // createLLM creates the appropriate LLM client based on the provider
 func createLLM() (llms.Model, error) {
-	switch strings.ToLower(llmProvider) {
-	case "openai":
-		if openaiAPIKey == "" {
-			return nil, fmt.Errorf("OpenAI API key is not set")
-		}
-		return openai.New(
-			openai.WithModel(llmModel),
-			openai.WithToken(openaiAPIKey),
-		)
-	case "ollama":
-		host := os.Getenv("OLLAMA_HOST")
-		if host == "" {
-			host = "http://127.0.0.1:11434"
-		}
-		return ollama.New(
-			ollama.WithModel(llmModel),
-			ollama.WithServerURL(host),
-		)
-	default:
-		return nil, fmt.Errorf("unsupported LLM provider: %s", llmProvider)
-	}
+	return createLLMChain(llmProvider, llmModel, llmFallbacks, false)
 }
 
 func createVisionLLM() (llms.Model, error) {
-	switch strings.ToLower(visionLlmProvider) {
-	case "openai":
-		if openaiAPIKey == "" {
-			return nil, fmt.Errorf("OpenAI API key is not set")
-		}
-		return openai.New(
-			openai.WithModel(visionLlmModel),
-			openai.WithToken(openaiAPIKey),
-		)
-	case "ollama":
-		host := os.Getenv("OLLAMA_HOST")
-		if host == "" {
-			host = "http://127.0.0.1:11434"
-		}
-		return ollama.New(
-			ollama.WithModel(visionLlmModel),
-			ollama.WithServerURL(host),
-		)
-	default:
+	if visionLlmProvider == "" {
 		log.Infoln("Vision LLM not enabled")
 		return nil, nil
 	}
+	return createLLMChain(visionLlmProvider, visionLlmModel, visionLlmFallbacks, true)
 }
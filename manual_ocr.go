@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// reviewOCRJob completes the manual OCR workflow for the document of a finished job.
+// If accept is set, content replaces the content of the document (the OCR result of the job if
+// content is empty) and the writes processJob left out are made, see writeAcceptedOCRJob.
+// In both cases the manual OCR tag is removed, so the document leaves the list.
+func (app *App) reviewOCRJob(ctx context.Context, jobID string, accept bool, content string) (*Job, error) {
+	job, exists := jobStore.getJob(jobID)
+	if !exists {
+		return nil, errJobNotFound
+	}
+
+	if accept {
+		if job.Status != "completed" {
+			return nil, fmt.Errorf("%w: only completed jobs can be accepted, job %s is %s", errJobState, job.ID, job.Status)
+		}
+		if content == "" {
+			content = job.Result
+		}
+		if content == "" {
+			return nil, fmt.Errorf("%w: the OCR result of job %s is empty", errJobState, job.ID)
+		}
+	} else if job.Status == "pending" || job.Status == "in_progress" {
+		return nil, fmt.Errorf("%w: job %s is still %s, cancel it first", errJobState, job.ID, job.Status)
+	}
+
+	document, err := app.Client.GetDocument(ctx, job.DocumentID)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestion := DocumentSuggestion{
+		ID:               document.ID,
+		OriginalDocument: document,
+		RemoveTags:       []string{manualOcrTag},
+	}
+	if accept {
+		suggestion.SuggestedContent = content
+	}
+	if err := app.Client.UpdateDocuments(ctx, []DocumentSuggestion{suggestion}, app.Database, false); err != nil {
+		return nil, fmt.Errorf("error updating document %d: %w", document.ID, err)
+	}
+
+	if accept {
+		documentLogger(document.ID).Infof("Accepted OCR result of job %s", job.ID)
+		app.writeAcceptedOCRJob(ctx, job, content, documentOCRWrites())
+	} else {
+		documentLogger(document.ID).Infof("Rejected OCR result of job %s", job.ID)
+	}
+	return job, nil
+}
+
+// writeAcceptedOCRJob makes the writes to the document of an accepted job that processJob left out.
+// The content is already saved at this point, so errors are only logged and don't fail the review.
+func (app *App) writeAcceptedOCRJob(ctx context.Context, job *Job, content string, writes ocrWrites) {
+	docLogger := documentLogger(job.DocumentID)
+	if writes.SearchablePDF {
+		if err := app.createSearchablePDFForJob(ctx, job, content); err != nil {
+			docLogger.Errorf("Error creating searchable PDF: %v", err)
+		}
+	}
+	if writes.LineItems {
+		if err := app.applyStoredLineItems(ctx, job.DocumentID); err != nil {
+			docLogger.Errorf("Error writing line items: %v", err)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupManualOCRTest mocks a document with the manual OCR tag and records the updates sent to paperless-ngx
+func setupManualOCRTest(t *testing.T) (*App, *testEnv, *[]map[string]interface{}) {
+	originalStore, originalManualOcrTag := jobStore, manualOcrTag
+	t.Cleanup(func() { jobStore, manualOcrTag = originalStore, originalManualOcrTag })
+	jobStore = newTestJobStore(t)
+	manualOcrTag = "paperless-gpt-ocr"
+
+	env := newTestEnv(t)
+	t.Cleanup(env.teardown)
+
+	env.setMockResponse("/api/tags/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"results": [{"id": 1, "name": "paperless-gpt-ocr"}, {"id": 2, "name": "finance"}]}`))
+	})
+	env.setMockResponse("/api/documents/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "paperless-gpt-ocr", r.URL.Query().Get("tags__name__iexact"))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"results": [
+			{"id": 5, "title": "Receipt", "content": "R3ce1pt", "tags": [1, 2]},
+			{"id": 6, "title": "Letter", "content": "", "tags": [1]}
+		]}`))
+	})
+
+	var updates []map[string]interface{}
+	env.setMockResponse("/api/documents/5/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"id": 5, "title": "Receipt", "content": "R3ce1pt", "tags": [1, 2]}`))
+			return
+		}
+		var fields map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&fields))
+		updates = append(updates, fields)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return &App{Client: env.client, Database: env.db}, env, &updates
+}
+
+func TestReviewOCRJob(t *testing.T) {
+	app, _, updates := setupManualOCRTest(t)
+	ctx := context.Background()
+
+	require.NoError(t, jobStore.addJob(&Job{ID: "running", DocumentID: 5, Status: "pending"}))
+	_, err := app.reviewOCRJob(ctx, "running", true, "")
+	assert.ErrorIs(t, err, errJobState)
+	_, err = app.reviewOCRJob(ctx, "running", false, "")
+	assert.ErrorIs(t, err, errJobState)
+	_, err = app.reviewOCRJob(ctx, "unknown", true, "")
+	assert.ErrorIs(t, err, errJobNotFound)
+	assert.Empty(t, *updates)
+
+	// Accepting writes the OCR result and removes the manual OCR tag
+	jobStore.updateJobStatus("running", "completed", "Receipt ACME")
+	_, err = app.reviewOCRJob(ctx, "running", true, "")
+	require.NoError(t, err)
+	require.Len(t, *updates, 1)
+	assert.Equal(t, "Receipt ACME", (*updates)[0]["content"])
+	assert.Equal(t, []interface{}{float64(2)}, (*updates)[0]["tags"])
+
+	// A corrected text replaces the OCR result
+	_, err = app.reviewOCRJob(ctx, "running", true, "Receipt ACME Inc.")
+	require.NoError(t, err)
+	assert.Equal(t, "Receipt ACME Inc.", (*updates)[1]["content"])
+
+	// Rejecting only removes the tag, also for failed jobs
+	require.NoError(t, jobStore.addJob(&Job{ID: "failed", DocumentID: 5, Status: "pending"}))
+	jobStore.updateJobStatus("failed", "failed", "vision model not found")
+	_, err = app.reviewOCRJob(ctx, "failed", true, "")
+	assert.ErrorIs(t, err, errJobState)
+	_, err = app.reviewOCRJob(ctx, "failed", false, "")
+	require.NoError(t, err)
+	require.Len(t, *updates, 3)
+	assert.NotContains(t, (*updates)[2], "content")
+	assert.Equal(t, []interface{}{float64(2)}, (*updates)[2]["tags"])
+}
+
+func TestManualOCRHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app, _, updates := setupManualOCRTest(t)
+
+	router := gin.New()
+	router.GET("/api/ocr/documents", app.ocrDocumentsHandler)
+	router.POST("/api/jobs/ocr/:job_id/accept", app.acceptOCRJobHandler)
+	router.POST("/api/jobs/ocr/:job_id/reject", app.rejectOCRJobHandler)
+
+	require.NoError(t, jobStore.addJob(&Job{ID: "old", DocumentID: 5, Status: "pending", CreatedAt: time.Now().Add(-time.Hour)}))
+	require.NoError(t, jobStore.addJob(&Job{ID: "new", DocumentID: 5, Status: "pending"}))
+	jobStore.updateJobStatus("new", "completed", "Receipt ACME")
+
+	// Documents are listed with their latest job
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/ocr/documents", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var documents []struct {
+		Document Document `json:"document"`
+		Job      *struct {
+			JobID  string `json:"job_id"`
+			Status string `json:"status"`
+		} `json:"job"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &documents))
+	require.Len(t, documents, 2)
+	assert.Equal(t, "R3ce1pt", documents[0].Document.Content)
+	require.NotNil(t, documents[0].Job)
+	assert.Equal(t, "new", documents[0].Job.JobID)
+	assert.Equal(t, "completed", documents[0].Job.Status)
+	assert.Nil(t, documents[1].Job)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/jobs/ocr/new/accept", strings.NewReader(`{"content": "Receipt ACME Inc."}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Receipt ACME Inc.", (*updates)[0]["content"])
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/jobs/ocr/old/accept", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/jobs/ocr/unknown/reject", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestReviewOCRJob_SearchablePDF(t *testing.T) {
+	app, env, _ := setupManualOCRTest(t)
+	ctx := context.Background()
+	env.client.CacheFolder = t.TempDir()
+
+	originalSearchablePDF, originalCache, originalTemplate := ocrSearchablePDF, ocrCacheEnabled, ocrTemplate
+	t.Cleanup(func() {
+		ocrSearchablePDF, ocrCacheEnabled, ocrTemplate = originalSearchablePDF, originalCache, originalTemplate
+	})
+	ocrSearchablePDF, ocrCacheEnabled = true, false
+	var err error
+	ocrTemplate, err = template.New("ocr").Parse(defaultOcrPrompt)
+	require.NoError(t, err)
+
+	pdfContent, err := os.ReadFile("tests/pdf/sample.pdf")
+	require.NoError(t, err)
+	env.setMockResponse("/api/documents/5/download/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(pdfContent)
+	})
+	uploads := 0
+	env.setMockResponse("/api/documents/post_document/", func(w http.ResponseWriter, r *http.Request) {
+		uploads++
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`"4b8f1d2e-task"`))
+	})
+	var notes []string
+	env.setMockResponse("/api/documents/5/notes/", func(w http.ResponseWriter, r *http.Request) {
+		var note map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&note))
+		notes = append(notes, note["note"])
+		w.WriteHeader(http.StatusOK)
+	})
+
+	app.VisionLLM = &mockLLM{response: "Receipt ACME"}
+	app.OCREngine = createOCREngine(app)
+
+	// The job itself doesn't upload a searchable PDF, and neither does rejecting its result
+	require.NoError(t, jobStore.addJob(&Job{ID: "pdf", DocumentID: 5, Status: "pending"}))
+	job, _ := jobStore.getJob("pdf")
+	processJob(ctx, app, job)
+	job, _ = jobStore.getJob("pdf")
+	require.Equal(t, "completed", job.Status)
+	assert.Equal(t, "Receipt ACME", job.Result)
+	_, err = app.reviewOCRJob(ctx, "pdf", false, "")
+	require.NoError(t, err)
+	assert.Zero(t, uploads)
+	assert.Empty(t, notes)
+
+	// Accepting the result uploads it
+	_, err = app.reviewOCRJob(ctx, "pdf", true, "Receipt ACME Inc.")
+	require.NoError(t, err)
+	assert.Equal(t, 1, uploads)
+	require.Len(t, notes, 1)
+	assert.Contains(t, notes[0], "4b8f1d2e-task")
+}
+
+func TestReviewOCRJob_LineItems(t *testing.T) {
+	app, env, updates := setupManualOCRTest(t)
+	ctx := context.Background()
+	env.client.CacheFolder = t.TempDir()
+
+	originalTables, originalLineItems, originalCache, originalTemplate := ocrTables, ocrLineItems, ocrCacheEnabled, ocrTemplate
+	t.Cleanup(func() {
+		ocrTables, ocrLineItems, ocrCacheEnabled, ocrTemplate = originalTables, originalLineItems, originalCache, originalTemplate
+	})
+	ocrTables, ocrLineItems, ocrCacheEnabled = ocrTablesMarkdown, lineItemsNote, false
+	var err error
+	ocrTemplate, err = template.New("ocr").Parse(defaultOcrPrompt)
+	require.NoError(t, err)
+
+	pdfContent, err := os.ReadFile("tests/pdf/sample.pdf")
+	require.NoError(t, err)
+	env.setMockResponse("/api/documents/5/download/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(pdfContent)
+	})
+	var notes []string
+	env.setMockResponse("/api/documents/5/notes/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			var note map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&note))
+			notes = append(notes, note["note"])
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`[]`))
+	})
+
+	app.VisionLLM = &mockLLM{response: invoicePage}
+	app.OCREngine = createOCREngine(app)
+
+	// The job only stores the tables, and rejecting its result doesn't write the line items either
+	require.NoError(t, jobStore.addJob(&Job{ID: "items", DocumentID: 5, Status: "pending"}))
+	job, _ := jobStore.getJob("items")
+	processJob(ctx, app, job)
+	job, _ = jobStore.getJob("items")
+	require.Equal(t, "completed", job.Status)
+	tables, err := getOCRTables(app.Database, 5)
+	require.NoError(t, err)
+	assert.Len(t, tables, 1)
+	_, err = app.reviewOCRJob(ctx, "items", false, "")
+	require.NoError(t, err)
+	assert.Empty(t, notes)
+	for _, update := range *updates {
+		assert.NotContains(t, update, "custom_fields")
+	}
+
+	// Accepting the result writes them
+	_, err = app.reviewOCRJob(ctx, "items", true, "")
+	require.NoError(t, err)
+	require.Len(t, notes, 1)
+	assert.Equal(t, "Line items found by paperless-gpt OCR:\n- 2 × Widget | blue: 19.98\n- 1 × Service: 50.00", notes[0])
+}
@@ -4,19 +4,56 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
-// ProcessDocumentOCR processes a document through OCR and returns the combined text
-func (app *App) ProcessDocumentOCR(ctx context.Context, documentID int) (string, error) {
+// visionRequests caps the number of vision LLM requests in flight across all OCR jobs, nil for no limit
+var visionRequests *semaphore.Weighted
+
+// OCRProgress describes how far ProcessDocumentOCR got with a document
+type OCRProgress struct {
+	PagesDone  int
+	TotalPages int
+	PageTexts  []string // Text of the leading pages that are done, in page order
+}
+
+// ocrWrites selects the changes processDocumentOCR makes to the document in paperless-ngx besides reading it.
+// The zero value writes nothing, which OCR jobs use until their result is accepted, see reviewOCRJob.
+type ocrWrites struct {
+	SearchablePDF bool // Upload a searchable PDF, see createSearchablePDF
+	LineItems     bool // Write the line items of the stored tables, see applyStoredLineItems
+}
+
+// documentOCRWrites returns the writes of an OCR run whose result is used without a review
+func documentOCRWrites() ocrWrites {
+	return ocrWrites{SearchablePDF: ocrSearchablePDF, LineItems: ocrLineItems != ""}
+}
+
+// ProcessDocumentOCR processes the selected pages of a document through OCR and returns the combined text.
+// Up to ocrPageConcurrency pages are processed at the same time, the text is joined in page order.
+// If onProgress is not nil, it is called once the page count is known and after each page.
+// With OCR_SEARCHABLE_PDF, a PDF with the text as invisible layer is uploaded to paperless-ngx as well.
+// With OCR_TABLES, the tables of the pages are validated and stored, see storeOCRTables, and with
+// OCR_LINE_ITEMS their line items are written to the document.
+func (app *App) ProcessDocumentOCR(ctx context.Context, documentID int, pages pageSelection, onProgress func(OCRProgress)) (string, error) {
+	return app.processDocumentOCR(ctx, documentID, pages, onProgress, documentOCRWrites())
+}
+
+// processDocumentOCR is ProcessDocumentOCR, but only makes the given writes to paperless-ngx
+func (app *App) processDocumentOCR(ctx context.Context, documentID int, pages pageSelection, onProgress func(OCRProgress), writes ocrWrites) (string, error) {
 	docLogger := documentLogger(documentID)
-	docLogger.Info("Starting OCR processing")
+	docLogger.WithField("pages", pages.String()).Info("Starting OCR processing")
 
-	imagePaths, err := app.Client.DownloadDocumentAsImages(ctx, documentID, limitOcrPages)
+	images, err := app.Client.DownloadDocumentAsImages(ctx, documentID, pages)
 	defer func() {
-		for _, imagePath := range imagePaths {
-			if err := os.Remove(imagePath); err != nil {
-				docLogger.WithError(err).WithField("image_path", imagePath).Warn("Failed to remove temporary image file")
+		for _, pageImage := range images {
+			if err := os.Remove(pageImage.Path); err != nil {
+				docLogger.WithError(err).WithField("image_path", pageImage.Path).Warn("Failed to remove temporary image file")
 			}
 		}
 	}()
@@ -24,27 +61,147 @@ func (app *App) ProcessDocumentOCR(ctx context.Context, documentID int) (string,
 		return "", fmt.Errorf("error downloading document images for document %d: %w", documentID, err)
 	}
 
-	docLogger.WithField("page_count", len(imagePaths)).Debug("Downloaded document images")
+	docLogger.WithField("page_count", len(images)).Debug("Downloaded document images")
 
-	var ocrTexts []string
-	for i, imagePath := range imagePaths {
-		pageLogger := docLogger.WithField("page", i+1)
-		pageLogger.Debug("Processing page")
+	ocrTexts := make([]string, len(images))
+	pageTables := make([][]OCRTable, len(images))
+	done := make([]bool, len(images))
+	pagesDone := 0
+	var mu sync.Mutex
 
-		imageContent, err := os.ReadFile(imagePath)
-		if err != nil {
-			return "", fmt.Errorf("error reading image file for document %d, page %d: %w", documentID, i+1, err)
+	// reportProgress must be called with mu held, so that the reports are in order
+	reportProgress := func() {
+		if onProgress == nil {
+			return
+		}
+		// Only report the texts of the leading pages that are done, to keep them in page order
+		leading := 0
+		for leading < len(done) && done[leading] {
+			leading++
+		}
+		var pageTexts []string
+		if leading > 0 {
+			pageTexts = slices.Clone(ocrTexts[:leading])
 		}
+		onProgress(OCRProgress{PagesDone: pagesDone, TotalPages: len(images), PageTexts: pageTexts})
+	}
+
+	mu.Lock()
+	reportProgress()
+	mu.Unlock()
 
-		ocrText, err := app.doOCRViaLLM(ctx, imageContent, pageLogger)
-		if err != nil {
-			return "", fmt.Errorf("error performing OCR for document %d, page %d: %w", documentID, i+1, err)
+	engine := app.ocrEngine()
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(ocrPageConcurrency, 1))
+	for i, pageImage := range images {
+		// Stop starting pages once a page failed or the job was cancelled
+		if gctx.Err() != nil {
+			break
 		}
-		pageLogger.Debug("OCR completed for page")
 
-		ocrTexts = append(ocrTexts, ocrText)
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return fmt.Errorf("OCR for document %d stopped before page %d: %w", documentID, pageImage.Page, err)
+			}
+
+			pageLogger := docLogger.WithField("page", pageImage.Page)
+			pageLogger.Debug("Processing page")
+
+			imageContent, err := os.ReadFile(pageImage.Path)
+			if err != nil {
+				return fmt.Errorf("error reading image file for document %d, page %d: %w", documentID, pageImage.Page, err)
+			}
+			imageContent, err = preprocessPageImage(imageContent, ocrPreprocess)
+			if err != nil {
+				return fmt.Errorf("error preprocessing image for document %d, page %d: %w", documentID, pageImage.Page, err)
+			}
+
+			result, err := engine.RecognizePage(gctx, imageContent, pageLogger)
+			if err != nil {
+				return fmt.Errorf("error performing OCR for document %d, page %d: %w", documentID, pageImage.Page, err)
+			}
+			ocrText := result.Text
+			pageLogger.WithField("engine", result.Engine).Debug("OCR completed for page")
+
+			var tables []OCRTable
+			if ocrTables != "" {
+				var problems []string
+				ocrText, tables, problems = extractPageTables(ocrTables, ocrText)
+				for _, problem := range problems {
+					pageLogger.Warnf("Invalid table in the OCR result: %s", problem)
+				}
+				for t := range tables {
+					tables[t].DocumentID = documentID
+					tables[t].Page = pageImage.Page
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			ocrTexts[i] = ocrText
+			pageTables[i] = tables
+			done[i] = true
+			pagesDone++
+			reportProgress()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return "", err
+	}
+	// The loop stops early without an error of a page if ctx was cancelled in between
+	if pagesDone < len(images) {
+		return "", fmt.Errorf("OCR for document %d stopped after %d of %d pages: %w", documentID, pagesDone, len(images), context.Cause(ctx))
+	}
+
+	if writes.SearchablePDF {
+		// The page images are still needed for the PDF, so this must happen before they are removed
+		if err := app.createSearchablePDF(ctx, documentID, images, ocrTexts); err != nil {
+			docLogger.Errorf("Error creating searchable PDF: %v", err)
+		}
+	}
+
+	if ocrTables != "" {
+		app.storeOCRTables(documentID, images, slices.Concat(pageTables...))
+		if writes.LineItems {
+			if err := app.applyStoredLineItems(ctx, documentID); err != nil {
+				docLogger.Errorf("Error writing line items: %v", err)
+			}
+		}
 	}
 
 	docLogger.Info("OCR processing completed successfully")
 	return strings.Join(ocrTexts, "\n\n"), nil
 }
+
+// storeOCRTables replaces the stored tables of the read pages. Errors are only logged,
+// the OCR text is usable without the tables.
+func (app *App) storeOCRTables(documentID int, images []PageImage, tables []OCRTable) {
+	if app.Database == nil {
+		return
+	}
+	docLogger := documentLogger(documentID)
+
+	pages := make([]int, len(images))
+	for i, pageImage := range images {
+		pages[i] = pageImage.Page
+	}
+	if err := saveOCRTables(app.Database, documentID, pages, tables); err != nil {
+		docLogger.Errorf("Error storing OCR tables: %v", err)
+		return
+	}
+	docLogger.WithField("table_count", len(tables)).Debug("Stored OCR tables")
+}
+
+// applyStoredLineItems writes the line items of the stored tables of a document with OCR_LINE_ITEMS.
+// They are taken from all stored tables, including pages read by earlier runs.
+func (app *App) applyStoredLineItems(ctx context.Context, documentID int) error {
+	if ocrLineItems == "" || app.Database == nil {
+		return nil
+	}
+	tables, err := getOCRTables(app.Database, documentID)
+	if err != nil {
+		return fmt.Errorf("error fetching OCR tables: %w", err)
+	}
+	return app.applyLineItems(ctx, documentID, tables)
+}
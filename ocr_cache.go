@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OCRCacheEntry is the OCR text of a page image. Entries are addressed by the content of the image
+// and the model and prompt that read it, so they are shared by all documents with the same page.
+type OCRCacheEntry struct {
+	ImageHash  string    `gorm:"primaryKey;size:64"`  // SHA-256 of the JPEG sent to the OCR engine
+	Model      string    `gorm:"primaryKey;size:255"` // Provider and model, e.g. "openai/gpt-4o"
+	PromptHash string    `gorm:"primaryKey;size:64"`  // SHA-256 of the OCR prompt
+	Text       string    // Recognized text of the page
+	CreatedAt  time.Time `gorm:"index"`
+}
+
+// hashBytes returns the hex encoded SHA-256 of data
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheableOCREngine is an OCR engine whose results only depend on the image, a model and a prompt
+type cacheableOCREngine interface {
+	OCREngine
+	// cacheKey returns the model and the hash of the prompt the engine uses for the next page
+	cacheKey() (model string, promptHash string, err error)
+}
+
+// cachedOCREngine stores the results of an engine in the database and reuses them for pages
+// with the same image, model and prompt
+type cachedOCREngine struct {
+	engine cacheableOCREngine
+	db     *gorm.DB
+}
+
+func (e *cachedOCREngine) Name() string {
+	return e.engine.Name()
+}
+
+func (e *cachedOCREngine) RecognizePage(ctx context.Context, jpegBytes []byte, logger *logrus.Entry) (OCRPageResult, error) {
+	model, promptHash, err := e.engine.cacheKey()
+	if err != nil {
+		return OCRPageResult{}, err
+	}
+	key := OCRCacheEntry{ImageHash: hashBytes(jpegBytes), Model: model, PromptHash: promptHash}
+
+	var entries []OCRCacheEntry
+	if err := e.db.WithContext(ctx).Where(&key).Limit(1).Find(&entries).Error; err != nil {
+		// The page can still be read without the cache
+		logger.Warnf("Error reading the OCR cache: %v", err)
+	} else if len(entries) > 0 {
+		logger.WithField("image_hash", key.ImageHash).Debug("OCR result taken from the cache")
+		return OCRPageResult{Text: entries[0].Text, Confidence: -1, Engine: e.engine.Name()}, nil
+	}
+
+	ctx, servedBy := withLLMServedBy(ctx)
+	result, err := e.engine.RecognizePage(ctx, jpegBytes, logger)
+	if err != nil {
+		return OCRPageResult{}, err
+	}
+
+	// The key names the primary model, so the text of a fallback model must not be stored under it
+	if backend, fallback := servedBy.get(); fallback {
+		logger.Debugf("Not caching the OCR result of fallback backend %s", backend)
+		return result, nil
+	}
+
+	key.Text = result.Text
+	if err := e.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&key).Error; err != nil {
+		logger.Warnf("Error writing the OCR cache: %v", err)
+	}
+	return result, nil
+}
+
+// purgeOCRCache removes the cache entries created before the given time, all entries if it is zero.
+// It returns the number of removed entries.
+func purgeOCRCache(db *gorm.DB, before time.Time) (int64, error) {
+	query := db.Session(&gorm.Session{AllowGlobalUpdate: true})
+	if !before.IsZero() {
+		query = query.Where("created_at < ?", before)
+	}
+	result := query.Delete(&OCRCacheEntry{})
+	return result.RowsAffected, result.Error
+}
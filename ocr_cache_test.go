@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeCacheableEngine is a fake OCR engine with a configurable model and prompt
+type fakeCacheableEngine struct {
+	fakeOCREngine
+	model  string
+	prompt string
+}
+
+func (e *fakeCacheableEngine) cacheKey() (string, string, error) {
+	return e.model, hashBytes([]byte(e.prompt)), nil
+}
+
+// setupOCRCacheTest returns the shared test database with an empty OCR cache
+func setupOCRCacheTest(t *testing.T) *gorm.DB {
+	db, err := InitializeTestDB()
+	require.NoError(t, err)
+	_, err = purgeOCRCache(db, time.Time{})
+	require.NoError(t, err)
+	return db
+}
+
+func TestCachedOCREngine(t *testing.T) {
+	db := setupOCRCacheTest(t)
+	logger := logrus.NewEntry(logrus.New())
+	ctx := context.Background()
+
+	inner := &fakeCacheableEngine{
+		fakeOCREngine: fakeOCREngine{name: "vision_llm", result: OCRPageResult{Text: "Invoice ACME", Confidence: -1}},
+		model:         "openai/gpt-4o",
+		prompt:        "Just transcribe the text in this image",
+	}
+	engine := &cachedOCREngine{engine: inner, db: db}
+
+	result, err := engine.RecognizePage(ctx, []byte("page 1"), logger)
+	require.NoError(t, err)
+	assert.Equal(t, "Invoice ACME", result.Text)
+	assert.Equal(t, 1, inner.calls)
+
+	// The same page is read from the cache, also by another document or job
+	inner.result.Text = "changed"
+	result, err = engine.RecognizePage(ctx, []byte("page 1"), logger)
+	require.NoError(t, err)
+	assert.Equal(t, "Invoice ACME", result.Text)
+	assert.Equal(t, "vision_llm", result.Engine)
+	assert.Equal(t, 1, inner.calls)
+
+	// Another image, model or prompt is read again
+	_, err = engine.RecognizePage(ctx, []byte("page 2"), logger)
+	require.NoError(t, err)
+	assert.Equal(t, 2, inner.calls)
+	inner.model = "anthropic/claude-3-5-sonnet"
+	_, err = engine.RecognizePage(ctx, []byte("page 1"), logger)
+	require.NoError(t, err)
+	assert.Equal(t, 3, inner.calls)
+	inner.prompt = "Transcribe the text as markdown"
+	result, err = engine.RecognizePage(ctx, []byte("page 1"), logger)
+	require.NoError(t, err)
+	assert.Equal(t, "changed", result.Text)
+	assert.Equal(t, 4, inner.calls)
+
+	// Failures are not cached
+	inner.err = errors.New("rate limited")
+	_, err = engine.RecognizePage(ctx, []byte("page 3"), logger)
+	assert.Error(t, err)
+	inner.err = nil
+	_, err = engine.RecognizePage(ctx, []byte("page 3"), logger)
+	require.NoError(t, err)
+	assert.Equal(t, 6, inner.calls)
+
+	var count int64
+	require.NoError(t, db.Model(&OCRCacheEntry{}).Count(&count).Error)
+	assert.Equal(t, int64(5), count)
+}
+
+func TestProcessDocumentOCR_Cache(t *testing.T) {
+	db := setupOCRCacheTest(t)
+	env := newTestEnv(t)
+	defer env.teardown()
+	env.client.CacheFolder = t.TempDir()
+
+	pdfContent, err := os.ReadFile("tests/pdf/sample.pdf")
+	require.NoError(t, err)
+	env.setMockResponse("/api/documents/126/download/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(pdfContent)
+	})
+
+	originalCache, originalTemplate := ocrCacheEnabled, ocrTemplate
+	defer func() { ocrCacheEnabled, ocrTemplate = originalCache, originalTemplate }()
+	ocrCacheEnabled = true
+	ocrTemplate, err = template.New("ocr").Parse(defaultOcrPrompt)
+	require.NoError(t, err)
+
+	vision := &mockLLM{response: "Invoice ACME"}
+	app := &App{Client: env.client, Database: db, VisionLLM: vision}
+	app.OCREngine = createOCREngine(app)
+
+	// The page images are removed after each run, the second run renders them again
+	// and finds the text of the identical images in the cache
+	for run := 0; run < 2; run++ {
+		text, err := app.ProcessDocumentOCR(context.Background(), 126, allPages, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "Invoice ACME", text)
+	}
+	assert.Equal(t, 1, vision.calls)
+}
+
+func TestCachedOCREngine_Fallback(t *testing.T) {
+	db := setupOCRCacheTest(t)
+	logger := logrus.NewEntry(logrus.New())
+	ctx := context.Background()
+
+	originalTemplate := ocrTemplate
+	defer func() { ocrTemplate = originalTemplate }()
+	var err error
+	ocrTemplate, err = template.New("ocr").Parse(defaultOcrPrompt)
+	require.NoError(t, err)
+
+	primary := &mockLLM{err: errors.New("connection refused")}
+	secondary := &mockLLM{response: "Invoice ACME"}
+	fallback := NewFallbackLLM([]*llmBackend{
+		{Name: "ollama:minicpm-v", Model: primary},
+		{Name: "openai:gpt-4o-mini", Model: secondary},
+	}, time.Minute, 0)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	fallback.now = func() time.Time { return now }
+	engine := &cachedOCREngine{engine: &visionLLMEngine{app: &App{VisionLLM: fallback}}, db: db}
+
+	page := testJPEG(t, image.NewGray(image.Rect(0, 0, 600, 900)))
+	result, err := engine.RecognizePage(ctx, page, logger)
+	require.NoError(t, err)
+	assert.Equal(t, "Invoice ACME", result.Text)
+
+	// The text of the fallback model is not cached under the key of the primary model
+	var count int64
+	require.NoError(t, db.Model(&OCRCacheEntry{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	// Once the primary model answers again, its text is cached
+	now = now.Add(2 * time.Minute)
+	primary.err, primary.response = nil, "Invoice ACME GmbH"
+	result, err = engine.RecognizePage(ctx, page, logger)
+	require.NoError(t, err)
+	assert.Equal(t, "Invoice ACME GmbH", result.Text)
+	_, err = engine.RecognizePage(ctx, page, logger)
+	require.NoError(t, err)
+	assert.Equal(t, 2, primary.calls)
+	require.NoError(t, db.Model(&OCRCacheEntry{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestVisionLLMEngineCacheKey(t *testing.T) {
+	originalTemplate, originalProvider, originalModel := ocrTemplate, visionLlmProvider, visionLlmModel
+	defer func() {
+		ocrTemplate, visionLlmProvider, visionLlmModel = originalTemplate, originalProvider, originalModel
+	}()
+	visionLlmProvider, visionLlmModel = "ollama", "minicpm-v"
+
+	var err error
+	ocrTemplate, err = template.New("ocr").Parse(defaultOcrPrompt)
+	require.NoError(t, err)
+	engine := &visionLLMEngine{app: &App{}}
+	model, promptHash, err := engine.cacheKey()
+	require.NoError(t, err)
+	assert.Equal(t, "ollama/minicpm-v", model)
+
+	ocrTemplate, err = template.New("ocr").Parse("Transcribe the text as markdown")
+	require.NoError(t, err)
+	_, changedHash, err := engine.cacheKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, promptHash, changedHash)
+}
+
+func TestPurgeOCRCacheHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupOCRCacheTest(t)
+	require.NoError(t, db.Create(&OCRCacheEntry{ImageHash: "old", Model: "m", PromptHash: "p", CreatedAt: time.Now().Add(-48 * time.Hour)}).Error)
+	require.NoError(t, db.Create(&OCRCacheEntry{ImageHash: "new", Model: "m", PromptHash: "p"}).Error)
+
+	app := &App{Database: db}
+	router := gin.New()
+	router.DELETE("/api/ocr/cache", app.purgeOCRCacheHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/ocr/cache?older_than=1d", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deleted": 1}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/ocr/cache?older_than=soon", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/ocr/cache", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deleted": 1}`, w.Body.String())
+}
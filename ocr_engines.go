@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Values of OCR_PROVIDER
+const (
+	ocrProviderLLM       = "llm"       // Every page is read by the vision LLM
+	ocrProviderTesseract = "tesseract" // Every page is read by Tesseract
+	ocrProviderHybrid    = "hybrid"    // Tesseract first, the vision LLM for pages with a low confidence
+)
+
+// OCREngine converts the image of a page to text
+type OCREngine interface {
+	Name() string
+	RecognizePage(ctx context.Context, jpegBytes []byte, logger *logrus.Entry) (OCRPageResult, error)
+}
+
+// OCRPageResult is the text an OCR engine recognized on a page
+type OCRPageResult struct {
+	Text       string
+	Confidence float64 // Mean confidence of the words from 0 to 100, -1 if the engine doesn't report one
+	Engine     string  // Name of the engine that produced the text
+}
+
+// createOCREngine creates the OCR engine selected with OCR_PROVIDER.
+// With OCR_CACHE, the results of the vision LLM are cached in the database.
+func createOCREngine(app *App) OCREngine {
+	var vision OCREngine = &visionLLMEngine{app: app}
+	if ocrCacheEnabled && app.Database != nil {
+		vision = &cachedOCREngine{engine: &visionLLMEngine{app: app}, db: app.Database}
+	}
+
+	switch ocrProvider {
+	case ocrProviderTesseract:
+		return &tesseractEngine{binary: tesseractPath, languages: tesseractLanguages}
+	case ocrProviderHybrid:
+		return &hybridOCREngine{
+			primary:       &tesseractEngine{binary: tesseractPath, languages: tesseractLanguages},
+			fallback:      vision,
+			minConfidence: ocrHybridMinConfidence,
+		}
+	default:
+		return vision
+	}
+}
+
+// ocrEngine returns the OCR engine of the app, the vision LLM if none was set
+func (app *App) ocrEngine() OCREngine {
+	if app.OCREngine != nil {
+		return app.OCREngine
+	}
+	return &visionLLMEngine{app: app}
+}
+
+// visionLLMEngine reads pages with the vision LLM
+type visionLLMEngine struct {
+	app *App
+}
+
+func (e *visionLLMEngine) Name() string {
+	return "vision_llm"
+}
+
+func (e *visionLLMEngine) RecognizePage(ctx context.Context, jpegBytes []byte, logger *logrus.Entry) (OCRPageResult, error) {
+	text, err := e.app.doOCRViaLLM(ctx, jpegBytes, logger)
+	if err != nil {
+		return OCRPageResult{}, err
+	}
+	return OCRPageResult{Text: text, Confidence: -1, Engine: e.Name()}, nil
+}
+
+func (e *visionLLMEngine) cacheKey() (string, string, error) {
+	prompt, err := renderOCRPrompt()
+	if err != nil {
+		return "", "", err
+	}
+	return visionLlmProvider + "/" + visionLlmModel, hashBytes([]byte(prompt)), nil
+}
+
+// tesseractEngine reads pages with a local Tesseract binary
+type tesseractEngine struct {
+	binary    string
+	languages string // Tesseract language codes joined with "+", e.g. "eng+deu"
+}
+
+func (e *tesseractEngine) Name() string {
+	return "tesseract"
+}
+
+func (e *tesseractEngine) RecognizePage(ctx context.Context, jpegBytes []byte, logger *logrus.Entry) (OCRPageResult, error) {
+	// The TSV output contains the confidence of every word besides the text
+	cmd := exec.CommandContext(ctx, e.binary, "stdin", "stdout", "-l", e.languages, "tsv")
+	cmd.Stdin = bytes.NewReader(jpegBytes)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return OCRPageResult{}, ctx.Err()
+		}
+		return OCRPageResult{}, fmt.Errorf("error running tesseract: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	text, confidence, err := parseTesseractTSV(stdout.Bytes())
+	if err != nil {
+		return OCRPageResult{}, err
+	}
+	logger.Debugf("Tesseract recognized %d characters with a confidence of %.1f", len(text), confidence)
+	return OCRPageResult{Text: text, Confidence: confidence, Engine: e.Name()}, nil
+}
+
+// parseTesseractTSV builds the text of a page from the TSV output of Tesseract and returns it with
+// the mean confidence of the words. Lines are separated by a newline, paragraphs by an empty line.
+func parseTesseractTSV(tsv []byte) (string, float64, error) {
+	const wordLevel = "5"
+
+	var text strings.Builder
+	var lastParagraph, lastLine string
+	confidenceSum, words := 0.0, 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(tsv))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNumber := 0; scanner.Scan(); lineNumber++ {
+		// level page_num block_num par_num line_num word_num left top width height conf text
+		fields := strings.SplitN(scanner.Text(), "\t", 12)
+		if lineNumber == 0 || len(fields) < 12 || fields[0] != wordLevel {
+			continue
+		}
+		word := strings.TrimSpace(fields[11])
+		if word == "" {
+			continue
+		}
+		confidence, err := strconv.ParseFloat(fields[10], 64)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid confidence '%s' in tesseract output", fields[10])
+		}
+
+		paragraph := strings.Join(fields[1:4], ".")
+		line := paragraph + "." + fields[4]
+		switch {
+		case text.Len() == 0:
+		case paragraph != lastParagraph:
+			text.WriteString("\n\n")
+		case line != lastLine:
+			text.WriteString("\n")
+		default:
+			text.WriteString(" ")
+		}
+		text.WriteString(word)
+		lastParagraph, lastLine = paragraph, line
+
+		if confidence >= 0 {
+			confidenceSum += confidence
+			words++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", 0, fmt.Errorf("error reading tesseract output: %w", err)
+	}
+
+	if words == 0 {
+		return text.String(), 0, nil
+	}
+	return text.String(), confidenceSum / float64(words), nil
+}
+
+// hybridOCREngine reads pages with the primary engine and only uses the fallback engine
+// for pages the primary engine failed on or recognized with a confidence below minConfidence
+type hybridOCREngine struct {
+	primary       OCREngine
+	fallback      OCREngine
+	minConfidence float64
+}
+
+func (e *hybridOCREngine) Name() string {
+	return "hybrid"
+}
+
+func (e *hybridOCREngine) RecognizePage(ctx context.Context, jpegBytes []byte, logger *logrus.Entry) (OCRPageResult, error) {
+	result, err := e.primary.RecognizePage(ctx, jpegBytes, logger)
+	switch {
+	case err != nil:
+		if ctx.Err() != nil {
+			return OCRPageResult{}, err
+		}
+		logger.Warnf("OCR with %s failed, using %s: %v", e.primary.Name(), e.fallback.Name(), err)
+	case strings.TrimSpace(result.Text) == "":
+		logger.Debugf("%s found no text, using %s", e.primary.Name(), e.fallback.Name())
+	case result.Confidence < e.minConfidence:
+		logger.Debugf("Confidence of %s is %.1f, below %.1f, using %s", e.primary.Name(), result.Confidence, e.minConfidence, e.fallback.Name())
+	default:
+		return result, nil
+	}
+	return e.fallback.RecognizePage(ctx, jpegBytes, logger)
+}
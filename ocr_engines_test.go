@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOCREngine is an OCR engine that returns a fixed result
+type fakeOCREngine struct {
+	name   string
+	result OCRPageResult
+	err    error
+	calls  int
+}
+
+func (e *fakeOCREngine) Name() string {
+	return e.name
+}
+
+func (e *fakeOCREngine) RecognizePage(ctx context.Context, jpegBytes []byte, logger *logrus.Entry) (OCRPageResult, error) {
+	e.calls++
+	if e.err != nil {
+		return OCRPageResult{}, e.err
+	}
+	result := e.result
+	result.Engine = e.name
+	return result, nil
+}
+
+const testTesseractTSV = "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n" +
+	"1\t1\t0\t0\t0\t0\t0\t0\t2480\t3508\t-1\t\n" +
+	"2\t1\t1\t0\t0\t0\t100\t100\t800\t200\t-1\t\n" +
+	"5\t1\t1\t1\t1\t1\t100\t100\t300\t50\t96.5\tInvoice\n" +
+	"5\t1\t1\t1\t1\t2\t420\t100\t300\t50\t91.5\tACME\n" +
+	"5\t1\t1\t1\t2\t1\t100\t160\t300\t50\t90\tNo.\n" +
+	"5\t1\t1\t1\t2\t2\t420\t160\t300\t50\t88\t42\n" +
+	"5\t1\t2\t1\t1\t1\t100\t400\t300\t50\t-1\t \n" +
+	"5\t1\t2\t1\t1\t2\t100\t400\t300\t50\t84\tTotal\n"
+
+func TestParseTesseractTSV(t *testing.T) {
+	text, confidence, err := parseTesseractTSV([]byte(testTesseractTSV))
+	require.NoError(t, err)
+	assert.Equal(t, "Invoice ACME\nNo. 42\n\nTotal", text)
+	assert.InDelta(t, 90, confidence, 0.001)
+
+	// A page without words
+	text, confidence, err = parseTesseractTSV([]byte("level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n"))
+	require.NoError(t, err)
+	assert.Empty(t, text)
+	assert.Zero(t, confidence)
+
+	_, _, err = parseTesseractTSV([]byte("header\n5\t1\t1\t1\t1\t1\t0\t0\t0\t0\tbad\tword\n"))
+	assert.Error(t, err)
+}
+
+func TestTesseractEngine(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake tesseract binary is a shell script")
+	}
+
+	// A fake tesseract that records its arguments and input and prints the TSV output
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "output.tsv"), []byte(testTesseractTSV), 0644))
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\ncat > " + filepath.Join(dir, "input") + "\ncat " + filepath.Join(dir, "output.tsv") + "\n"
+	binary := filepath.Join(dir, "tesseract")
+	require.NoError(t, os.WriteFile(binary, []byte(script), 0755))
+
+	engine := &tesseractEngine{binary: binary, languages: "eng+deu"}
+	result, err := engine.RecognizePage(context.Background(), []byte("jpeg"), logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+	assert.Equal(t, "Invoice ACME\nNo. 42\n\nTotal", result.Text)
+	assert.InDelta(t, 90, result.Confidence, 0.001)
+	assert.Equal(t, "tesseract", result.Engine)
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	require.NoError(t, err)
+	assert.Equal(t, "stdin stdout -l eng+deu tsv", strings.TrimSpace(string(args)))
+	input, err := os.ReadFile(filepath.Join(dir, "input"))
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", string(input))
+
+	// Errors of the binary are reported with its output
+	require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\necho 'Failed loading language xyz' >&2\nexit 1\n"), 0755))
+	_, err = engine.RecognizePage(context.Background(), []byte("jpeg"), logrus.NewEntry(logrus.New()))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Failed loading language xyz")
+}
+
+func TestHybridOCREngine(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+
+	for _, tc := range []struct {
+		name         string
+		primary      *fakeOCREngine
+		expectedText string
+	}{
+		{
+			name:         "confident primary result",
+			primary:      &fakeOCREngine{name: "tesseract", result: OCRPageResult{Text: "clean scan", Confidence: 93}},
+			expectedText: "clean scan",
+		},
+		{
+			name:         "low confidence",
+			primary:      &fakeOCREngine{name: "tesseract", result: OCRPageResult{Text: "f4int r3ce1pt", Confidence: 41}},
+			expectedText: "from vision",
+		},
+		{
+			name:         "no text",
+			primary:      &fakeOCREngine{name: "tesseract", result: OCRPageResult{Text: " \n", Confidence: 95}},
+			expectedText: "from vision",
+		},
+		{
+			name:         "primary failed",
+			primary:      &fakeOCREngine{name: "tesseract", err: errors.New("tesseract not found")},
+			expectedText: "from vision",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fallback := &fakeOCREngine{name: "vision_llm", result: OCRPageResult{Text: "from vision", Confidence: -1}}
+			engine := &hybridOCREngine{primary: tc.primary, fallback: fallback, minConfidence: 80}
+
+			result, err := engine.RecognizePage(context.Background(), []byte("jpeg"), logger)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedText, result.Text)
+			assert.Equal(t, 1, tc.primary.calls)
+			if tc.expectedText == "from vision" {
+				assert.Equal(t, 1, fallback.calls)
+				assert.Equal(t, "vision_llm", result.Engine)
+			} else {
+				assert.Zero(t, fallback.calls)
+			}
+		})
+	}
+
+	// A cancelled page is not sent to the fallback
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fallback := &fakeOCREngine{name: "vision_llm"}
+	engine := &hybridOCREngine{primary: &fakeOCREngine{name: "tesseract", err: context.Canceled}, fallback: fallback, minConfidence: 80}
+	_, err := engine.RecognizePage(ctx, []byte("jpeg"), logger)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, fallback.calls)
+}
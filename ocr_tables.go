@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Values of OCR_TABLES
+const (
+	ocrTablesMarkdown = "markdown" // Tables are transcribed as markdown tables in the page text
+	ocrTablesJSON     = "json"     // Tables are additionally returned as a JSON code block, which is removed from the page text
+)
+
+// Values of OCR_LINE_ITEMS
+const (
+	lineItemsNote        = "note"         // Line items are added to the document as a note
+	lineItemsCustomField = "custom_field" // Line items are written to the custom field OCR_LINE_ITEMS_FIELD
+)
+
+// Instructions appended to the OCR prompt for the table modes
+const (
+	ocrTablesMarkdownInstructions = `Transcribe every table as a GitHub flavored markdown table: a header row, a separator row like | --- | --- |, and one line per table row. Every row must have the same number of cells as the header, use an empty cell for missing values. Don't split a table into several tables and don't put tables into a code block.`
+	ocrTablesJSONInstructions     = `Transcribe every table as a markdown table. After the text of the page, repeat all tables of the page as JSON in a single code block marked as json, in this form: {"tables": [{"title": "Title of the table, if any", "columns": ["Column 1", "Column 2"], "rows": [["Cell 1", "Cell 2"]]}]}. Every row must have exactly as many cells as there are columns, use "" for missing values. If the page has no tables, return {"tables": []}.`
+)
+
+// ocrTableInstructions returns the instructions for the table mode that are appended to the OCR prompt
+func ocrTableInstructions(mode string) string {
+	switch mode {
+	case ocrTablesMarkdown:
+		return ocrTablesMarkdownInstructions
+	case ocrTablesJSON:
+		return ocrTablesJSONInstructions
+	default:
+		return ""
+	}
+}
+
+// OCRTable is a table that OCR found on a page of a document
+type OCRTable struct {
+	ID         uint       `gorm:"primaryKey" json:"-"`
+	DocumentID int        `gorm:"not null;index" json:"document_id"`
+	Page       int        `gorm:"not null" json:"page"`  // Page number, counted from 1
+	Index      int        `gorm:"not null" json:"index"` // Position of the table on the page, counted from 0
+	Title      string     `json:"title,omitempty"`
+	Columns    []string   `gorm:"serializer:json" json:"columns"`
+	Rows       [][]string `gorm:"serializer:json" json:"rows"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// extractPageTables returns the tables in the OCR text of a page, together with the text to use as
+// content and the problems found while validating the tables. Invalid tables are left out.
+func extractPageTables(mode, text string) (string, []OCRTable, []string) {
+	if mode != ocrTablesJSON {
+		tables, problems := parseMarkdownTables(text)
+		return text, tables, problems
+	}
+
+	text, tables, err := parseJSONTables(text)
+	if err != nil {
+		// The markdown tables in the text are still usable
+		tables, problems := parseMarkdownTables(text)
+		return text, tables, append([]string{err.Error()}, problems...)
+	}
+	return text, tables, nil
+}
+
+// jsonCodeBlockPattern matches a code block marked as json
+var jsonCodeBlockPattern = regexp.MustCompile("(?s)```json[ \t]*\n(.*?)```")
+
+// parseJSONTables parses the JSON code block with the tables of a page and removes it from the text
+func parseJSONTables(text string) (string, []OCRTable, error) {
+	matches := jsonCodeBlockPattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text, nil, fmt.Errorf("the OCR result has no JSON code block with the tables")
+	}
+	// The tables are expected after the text of the page
+	match := matches[len(matches)-1]
+	remaining := strings.TrimSpace(text[:match[0]] + text[match[1]:])
+
+	var response struct {
+		Tables []struct {
+			Title   string          `json:"title"`
+			Columns []string        `json:"columns"`
+			Rows    [][]interface{} `json:"rows"`
+		} `json:"tables"`
+	}
+	if err := json.Unmarshal([]byte(text[match[2]:match[3]]), &response); err != nil {
+		return remaining, nil, fmt.Errorf("invalid JSON tables: %w", err)
+	}
+
+	tables := make([]OCRTable, 0, len(response.Tables))
+	for i, table := range response.Tables {
+		if len(table.Columns) == 0 {
+			return remaining, nil, fmt.Errorf("table %d has no columns", i+1)
+		}
+		rows := make([][]string, len(table.Rows))
+		for r, row := range table.Rows {
+			if len(row) != len(table.Columns) {
+				return remaining, nil, fmt.Errorf("row %d of table %d has %d cells, expected %d", r+1, i+1, len(row), len(table.Columns))
+			}
+			rows[r] = make([]string, len(row))
+			for c, cell := range row {
+				rows[r][c] = jsonCellString(cell)
+			}
+		}
+		tables = append(tables, OCRTable{Index: i, Title: strings.TrimSpace(table.Title), Columns: table.Columns, Rows: rows})
+	}
+	return remaining, tables, nil
+}
+
+// jsonCellString formats a table cell, models sometimes return numbers instead of strings
+func jsonCellString(cell interface{}) string {
+	switch value := cell.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+// markdownSeparatorPattern matches the separator row below the header of a markdown table
+var markdownSeparatorPattern = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+
+// parseMarkdownTables finds the markdown tables in a text. Tables whose rows don't have as many cells
+// as the header are reported as problems and left out.
+func parseMarkdownTables(text string) ([]OCRTable, []string) {
+	var tables []OCRTable
+	var problems []string
+	lines := strings.Split(text, "\n")
+	found := 0
+	for i := 0; i+1 < len(lines); i++ {
+		header, separator := strings.TrimSpace(lines[i]), strings.TrimSpace(lines[i+1])
+		if !strings.Contains(header, "|") || !strings.Contains(separator, "|") || !markdownSeparatorPattern.MatchString(separator) {
+			continue
+		}
+		found++
+
+		columns := splitMarkdownRow(header)
+		var rows [][]string
+		valid := len(splitMarkdownRow(separator)) == len(columns)
+		if !valid {
+			problems = append(problems, fmt.Sprintf("the separator of table %d doesn't match its %d columns", found, len(columns)))
+		}
+		end := i + 2
+		for ; end < len(lines) && strings.Contains(lines[end], "|"); end++ {
+			cells := splitMarkdownRow(strings.TrimSpace(lines[end]))
+			if valid && len(cells) != len(columns) {
+				problems = append(problems, fmt.Sprintf("row %d of table %d has %d cells, expected %d", len(rows)+1, found, len(cells), len(columns)))
+				valid = false
+			}
+			rows = append(rows, cells)
+		}
+
+		if valid {
+			tables = append(tables, OCRTable{Index: len(tables), Title: markdownTableTitle(lines[:i]), Columns: columns, Rows: rows})
+		}
+		i = end - 1
+	}
+	return tables, problems
+}
+
+// splitMarkdownRow splits a row of a markdown table into its trimmed cells
+func splitMarkdownRow(row string) []string {
+	row = strings.TrimPrefix(row, "|")
+	if strings.HasSuffix(row, "|") && !strings.HasSuffix(row, `\|`) {
+		row = strings.TrimSuffix(row, "|")
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(row); i++ {
+		switch {
+		case row[i] == '\\' && i+1 < len(row) && row[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case row[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(row[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// markdownTableTitle returns the heading right above a table, if there is one
+func markdownTableTitle(linesBefore []string) string {
+	for i := len(linesBefore) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(linesBefore[i])
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			return strings.TrimSpace(strings.TrimLeft(line, "#"))
+		}
+		return ""
+	}
+	return ""
+}
+
+// saveOCRTables replaces the stored tables of the given pages of a document
+func saveOCRTables(db *gorm.DB, documentID int, pages []int, tables []OCRTable) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ? AND page IN ?", documentID, pages).Delete(&OCRTable{}).Error; err != nil {
+			return err
+		}
+		if len(tables) == 0 {
+			return nil
+		}
+		return tx.Create(&tables).Error
+	})
+}
+
+// getOCRTables returns the stored tables of a document, in page order
+func getOCRTables(db *gorm.DB, documentID int) ([]OCRTable, error) {
+	tables := []OCRTable{}
+	err := db.Where("document_id = ?", documentID).Order("page, `index`").Find(&tables).Error
+	return tables, err
+}
+
+// LineItem is a position of an invoice or a transaction of a bank statement
+type LineItem struct {
+	Description string `json:"description"`
+	Quantity    string `json:"quantity,omitempty"`
+	Amount      string `json:"amount,omitempty"`
+}
+
+// Words in the column headers that identify the columns of line items, in English and German
+var (
+	lineItemDescriptionWords = []string{"description", "item", "article", "product", "service", "details", "text", "bezeichnung", "beschreibung", "artikel", "leistung", "verwendungszweck", "buchungstext"}
+	lineItemQuantityWords    = []string{"qty", "quantity", "units", "menge", "anzahl"}
+	lineItemAmountWords      = []string{"amount", "total", "sum", "price", "betrag", "summe", "gesamt", "preis", "umsatz"}
+	lineItemTotalRowWords    = []string{"total", "subtotal", "sum", "summe", "gesamt", "zwischensumme"}
+)
+
+// findColumn returns the index of the first column whose header contains one of the words, or -1.
+// With last, the last matching column is returned, e.g. the total instead of the unit price.
+func findColumn(columns []string, words []string, last bool) int {
+	index := -1
+	for i, column := range columns {
+		column = strings.ToLower(column)
+		for _, word := range words {
+			if strings.Contains(column, word) {
+				index = i
+				break
+			}
+		}
+		if index >= 0 && !last {
+			return index
+		}
+	}
+	return index
+}
+
+// extractLineItems returns the line items of the tables with a description and an amount column.
+// Rows without a description and total rows are left out.
+func extractLineItems(tables []OCRTable) []LineItem {
+	var items []LineItem
+	for _, table := range tables {
+		description := findColumn(table.Columns, lineItemDescriptionWords, false)
+		amount := findColumn(table.Columns, lineItemAmountWords, true)
+		if description < 0 || amount < 0 || description == amount {
+			continue
+		}
+		quantity := findColumn(table.Columns, lineItemQuantityWords, false)
+
+		for _, row := range table.Rows {
+			item := LineItem{Description: row[description], Amount: row[amount]}
+			if quantity >= 0 {
+				item.Quantity = row[quantity]
+			}
+			if item.Description == "" || isTotalRow(item.Description) {
+				continue
+			}
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// isTotalRow reports whether the description of a row marks it as a sum of the other rows
+func isTotalRow(description string) bool {
+	description = strings.ToLower(strings.TrimSpace(strings.Trim(description, "*:")))
+	for _, word := range lineItemTotalRowWords {
+		if description == word || strings.HasPrefix(description, word+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// formatLineItems formats line items as a list, one item per line
+func formatLineItems(items []LineItem) string {
+	lines := make([]string, len(items))
+	for i, item := range items {
+		line := "- "
+		if item.Quantity != "" {
+			line += item.Quantity + " × "
+		}
+		line += item.Description
+		if item.Amount != "" {
+			line += ": " + item.Amount
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// applyLineItems writes the line items of the tables to the document, as a note or to a custom field
+// depending on OCR_LINE_ITEMS
+func (app *App) applyLineItems(ctx context.Context, documentID int, tables []OCRTable) error {
+	items := extractLineItems(tables)
+	if len(items) == 0 {
+		return nil
+	}
+	text := formatLineItems(items)
+
+	switch ocrLineItems {
+	case lineItemsNote:
+		return app.replaceLineItemsNote(ctx, documentID, lineItemsNotePrefix+text)
+
+	case lineItemsCustomField:
+		customFields, err := app.Client.GetAllCustomFields(ctx)
+		if err != nil {
+			return err
+		}
+		field, exists := customFields[ocrLineItemsField]
+		if !exists {
+			return fmt.Errorf("custom field '%s' does not exist in paperless-ngx", ocrLineItemsField)
+		}
+		// String fields are limited to 128 characters, which few lists of line items fit into
+		if field.DataType != "longtext" {
+			return fmt.Errorf("custom field '%s' has the type %s, line items need a longtext field", field.Name, field.DataType)
+		}
+
+		document, err := app.Client.GetDocument(ctx, documentID)
+		if err != nil {
+			return err
+		}
+		if customFieldValueString(document.CustomFields, field.ID) == text {
+			return nil
+		}
+		suggestion := CustomFieldSuggestion{ID: field.ID, Name: field.Name, DataType: field.DataType, Value: text}
+		if err := app.Client.SetDocumentCustomFields(ctx, documentID, mergeCustomFields(document.CustomFields, []CustomFieldSuggestion{suggestion})); err != nil {
+			return err
+		}
+		if app.Database == nil {
+			return nil
+		}
+		// Record the change, so that it can be undone like the custom fields suggested by the LLM
+		return InsertModification(app.Database, &ModificationHistory{
+			DocumentID:    uint(documentID),
+			ModField:      customFieldModPrefix + field.Name,
+			PreviousValue: customFieldValueString(document.CustomFields, field.ID),
+			NewValue:      text,
+		})
+	}
+	return nil
+}
+
+// lineItemsNotePrefix starts the notes written by OCR_LINE_ITEMS=note
+const lineItemsNotePrefix = "Line items found by paperless-gpt OCR:\n"
+
+// replaceLineItemsNote adds the note with the line items to a document and removes the line items notes
+// of earlier OCR runs. If the document already has the same note, it is left unchanged.
+func (app *App) replaceLineItemsNote(ctx context.Context, documentID int, note string) error {
+	notes, err := app.Client.GetDocumentNotes(ctx, documentID)
+	if err != nil {
+		return err
+	}
+	var previous []DocumentNote
+	for _, existing := range notes {
+		if existing.Note == note {
+			return nil
+		}
+		if strings.HasPrefix(existing.Note, lineItemsNotePrefix) {
+			previous = append(previous, existing)
+		}
+	}
+
+	if err := app.Client.AddDocumentNote(ctx, documentID, note); err != nil {
+		return err
+	}
+	for _, existing := range previous {
+		if err := app.Client.DeleteDocumentNote(ctx, documentID, existing.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const invoicePage = `# Invoice 2024-017
+
+ACME GmbH
+
+## Positions
+
+| Description | Qty | Unit price | Amount |
+| :--- | ---: | ---: | ---: |
+| Widget \| blue | 2 | 9.99 | 19.98 |
+| Service | 1 | 50.00 | 50.00 |
+| **Total** | | | 69.98 |
+
+Thank you for your order.`
+
+func TestParseMarkdownTables(t *testing.T) {
+	tables, problems := parseMarkdownTables(invoicePage)
+	assert.Empty(t, problems)
+	require.Len(t, tables, 1)
+	assert.Equal(t, "Positions", tables[0].Title)
+	assert.Equal(t, []string{"Description", "Qty", "Unit price", "Amount"}, tables[0].Columns)
+	require.Len(t, tables[0].Rows, 3)
+	assert.Equal(t, []string{"Widget | blue", "2", "9.99", "19.98"}, tables[0].Rows[0])
+	assert.Equal(t, []string{"**Total**", "", "", "69.98"}, tables[0].Rows[2])
+
+	// Tables with rows of another length are reported and left out, valid tables are kept
+	text := "Date | Text\n--|--\n01.02. | Rent | 900\n\nNo | Name\n---|---\n1 | A\n"
+	tables, problems = parseMarkdownTables(text)
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0], "row 1 of table 1 has 3 cells, expected 2")
+	require.Len(t, tables, 1)
+	assert.Equal(t, []string{"No", "Name"}, tables[0].Columns)
+	assert.Equal(t, 0, tables[0].Index)
+	assert.Empty(t, tables[0].Title)
+
+	tables, problems = parseMarkdownTables("Just text | with a pipe\nand no table")
+	assert.Empty(t, tables)
+	assert.Empty(t, problems)
+}
+
+func TestExtractPageTables_JSON(t *testing.T) {
+	text := "Statement March\n\n| Date | Amount |\n| --- | --- |\n| 03.03. | -12.5 |\n\n```json\n" +
+		`{"tables": [{"title": "Transactions", "columns": ["Date", "Amount"], "rows": [["03.03.", -12.5], ["04.03.", null]]}]}` +
+		"\n```"
+	cleanText, tables, problems := extractPageTables(ocrTablesJSON, text)
+	assert.Empty(t, problems)
+	assert.NotContains(t, cleanText, "```")
+	assert.Contains(t, cleanText, "| 03.03. | -12.5 |")
+	require.Len(t, tables, 1)
+	assert.Equal(t, "Transactions", tables[0].Title)
+	assert.Equal(t, [][]string{{"03.03.", "-12.5"}, {"04.03.", ""}}, tables[0].Rows)
+
+	// Invalid JSON falls back to the markdown tables in the text
+	invalid := "| Date | Amount |\n| --- | --- |\n| 03.03. | -12.5 |\n\n```json\n" +
+		`{"tables": [{"columns": ["Date", "Amount"], "rows": [["03.03."]]}]}` + "\n```"
+	cleanText, tables, problems = extractPageTables(ocrTablesJSON, invalid)
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0], "row 1 of table 1 has 1 cells, expected 2")
+	assert.NotContains(t, cleanText, "```")
+	require.Len(t, tables, 1)
+	assert.Equal(t, []string{"03.03.", "-12.5"}, tables[0].Rows[0])
+
+	_, tables, problems = extractPageTables(ocrTablesJSON, "No tables here")
+	assert.Empty(t, tables)
+	assert.Len(t, problems, 1)
+}
+
+func TestExtractLineItems(t *testing.T) {
+	tables, _ := parseMarkdownTables(invoicePage)
+	tables = append(tables,
+		// German bank statement without quantities
+		OCRTable{Columns: []string{"Buchungstag", "Verwendungszweck", "Betrag"}, Rows: [][]string{{"01.03.", "Miete", "-900,00"}, {"", "Summe", "-900,00"}}},
+		// Tables without a description or amount column have no line items
+		OCRTable{Columns: []string{"Date", "Balance"}, Rows: [][]string{{"01.03.", "100"}}},
+	)
+
+	items := extractLineItems(tables)
+	assert.Equal(t, []LineItem{
+		{Description: "Widget | blue", Quantity: "2", Amount: "19.98"},
+		{Description: "Service", Quantity: "1", Amount: "50.00"},
+		{Description: "Miete", Amount: "-900,00"},
+	}, items)
+	assert.Equal(t, "- 2 × Widget | blue: 19.98\n- 1 × Service: 50.00\n- Miete: -900,00", formatLineItems(items))
+}
+
+func TestProcessDocumentOCR_Tables(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := InitializeTestDB()
+	require.NoError(t, err)
+	env := newTestEnv(t)
+	defer env.teardown()
+	env.client.CacheFolder = t.TempDir()
+
+	pdfContent, err := os.ReadFile("tests/pdf/sample.pdf")
+	require.NoError(t, err)
+	env.setMockResponse("/api/documents/127/download/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(pdfContent)
+	})
+	for _, path := range []string{"/api/tags/", "/api/correspondents/", "/api/document_types/"} {
+		env.setMockResponse(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"results": []}`))
+		})
+	}
+	env.setMockResponse("/api/custom_fields/", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []CustomField{{ID: 4, Name: "Line items", DataType: "longtext"}},
+		})
+	})
+	var patched map[string]interface{}
+	env.setMockResponse("/api/documents/127/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PATCH" {
+			body, _ := io.ReadAll(r.Body)
+			require.NoError(t, json.Unmarshal(body, &patched))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":            127,
+			"custom_fields": []CustomFieldValue{{Field: 1, Value: "EUR69.98"}},
+		})
+	})
+
+	originalTables, originalLineItems, originalField, originalTemplate, originalCache := ocrTables, ocrLineItems, ocrLineItemsField, ocrTemplate, ocrCacheEnabled
+	defer func() {
+		ocrTables, ocrLineItems, ocrLineItemsField, ocrTemplate, ocrCacheEnabled = originalTables, originalLineItems, originalField, originalTemplate, originalCache
+	}()
+	ocrTables, ocrLineItems, ocrLineItemsField, ocrCacheEnabled = ocrTablesMarkdown, lineItemsCustomField, "Line items", false
+	ocrTemplate, err = template.New("ocr").Parse(defaultOcrPrompt)
+	require.NoError(t, err)
+
+	vision := &mockLLM{response: invoicePage}
+	app := &App{Client: env.client, Database: db, VisionLLM: vision}
+	app.OCREngine = createOCREngine(app)
+
+	text, err := app.ProcessDocumentOCR(context.Background(), 127, allPages, nil)
+	require.NoError(t, err)
+	assert.Equal(t, invoicePage, text)
+
+	// The line items are added to the other custom fields of the document
+	require.NotNil(t, patched)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"field": float64(1), "value": "EUR69.98"},
+		map[string]interface{}{"field": float64(4), "value": "- 2 × Widget | blue: 19.98\n- 1 × Service: 50.00"},
+	}, patched["custom_fields"])
+
+	router := gin.New()
+	router.GET("/api/documents/:id/tables", app.getDocumentTablesHandler)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/documents/127/tables", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Tables    []OCRTable `json:"tables"`
+		LineItems []LineItem `json:"line_items"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Tables, 1)
+	assert.Equal(t, 1, response.Tables[0].Page)
+	assert.Equal(t, "Positions", response.Tables[0].Title)
+	assert.Len(t, response.LineItems, 2)
+
+	// Reading the document again replaces the tables of its pages
+	vision.response = "No tables on this page"
+	_, err = app.ProcessDocumentOCR(context.Background(), 127, allPages, nil)
+	require.NoError(t, err)
+	tables, err := getOCRTables(db, 127)
+	require.NoError(t, err)
+	assert.Empty(t, tables)
+}
+
+func TestApplyLineItems_Note(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.teardown()
+	app := &App{Client: env.client}
+
+	originalLineItems := ocrLineItems
+	defer func() { ocrLineItems = originalLineItems }()
+	ocrLineItems = lineItemsNote
+
+	notes := []DocumentNote{{ID: 1, Note: "Paid on 03.03."}}
+	nextID := 2
+	env.setMockResponse("/api/documents/127/notes/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			var note map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&note))
+			notes = append(notes, DocumentNote{ID: nextID, Note: note["note"]})
+			nextID++
+		case "DELETE":
+			for i, note := range notes {
+				if r.URL.Query().Get("id") == fmt.Sprint(note.ID) {
+					notes = append(notes[:i], notes[i+1:]...)
+					break
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(notes)
+	})
+
+	ctx := context.Background()
+	tables, _ := parseMarkdownTables(invoicePage)
+	require.NoError(t, app.applyLineItems(ctx, 127, tables))
+	require.Len(t, notes, 2)
+	assert.Equal(t, "Line items found by paperless-gpt OCR:\n- 2 × Widget | blue: 19.98\n- 1 × Service: 50.00", notes[1].Note)
+
+	// Unchanged line items don't add another note
+	require.NoError(t, app.applyLineItems(ctx, 127, tables))
+	assert.Len(t, notes, 2)
+
+	// Changed line items replace the note of the earlier run, other notes are kept
+	tables[0].Rows = tables[0].Rows[1:]
+	require.NoError(t, app.applyLineItems(ctx, 127, tables))
+	require.Len(t, notes, 2)
+	assert.Equal(t, "Paid on 03.03.", notes[0].Note)
+	assert.Equal(t, "Line items found by paperless-gpt OCR:\n- 1 × Service: 50.00", notes[1].Note)
+}
+
+func TestApplyLineItems_CustomField(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.teardown()
+	app := &App{Client: env.client}
+
+	originalLineItems, originalField := ocrLineItems, ocrLineItemsField
+	defer func() { ocrLineItems, ocrLineItemsField = originalLineItems, originalField }()
+	ocrLineItems, ocrLineItemsField = lineItemsCustomField, "Line items"
+
+	dataType := "string"
+	env.setMockResponse("/api/custom_fields/", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []CustomField{{ID: 4, Name: "Line items", DataType: dataType}},
+		})
+	})
+	env.setMockResponse("/api/tags/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": []}`))
+	})
+	patches := 0
+	env.setMockResponse("/api/documents/127/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PATCH" {
+			patches++
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":            127,
+			"custom_fields": []CustomFieldValue{{Field: 4, Value: "- 2 × Widget | blue: 19.98\n- 1 × Service: 50.00"}},
+		})
+	})
+
+	ctx := context.Background()
+	tables, _ := parseMarkdownTables(invoicePage)
+
+	// String fields would cut the line items off
+	err := app.applyLineItems(ctx, 127, tables)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line items need a longtext field")
+
+	// Unchanged line items are not written again
+	dataType = "longtext"
+	require.NoError(t, app.applyLineItems(ctx, 127, tables))
+	assert.Zero(t, patches)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessDocumentOCR_Progress(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.teardown()
+
+	pdfContent, err := os.ReadFile("tests/pdf/sample.pdf")
+	require.NoError(t, err)
+	env.setMockResponse("/api/documents/124/download/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(pdfContent)
+	})
+
+	ocrTemplate, err = template.New("ocr").Parse(defaultOcrPrompt)
+	require.NoError(t, err)
+	app := &App{Client: env.client, VisionLLM: &mockLLM{response: "Invoice ACME"}}
+
+	var reports []OCRProgress
+	text, err := app.ProcessDocumentOCR(context.Background(), 124, allPages, func(progress OCRProgress) {
+		reports = append(reports, progress)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Invoice ACME", text)
+
+	// The page count is reported before the first page and the text after each page
+	require.Len(t, reports, 2)
+	assert.Equal(t, OCRProgress{PagesDone: 0, TotalPages: 1}, reports[0])
+	assert.Equal(t, OCRProgress{PagesDone: 1, TotalPages: 1, PageTexts: []string{"Invoice ACME"}}, reports[1])
+
+	// A cancelled context stops the OCR
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = app.ProcessDocumentOCR(ctx, 124, allPages, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// pageResponse returns a respond function for mockLLM that answers with the page number encoded in the
+// image width, and a function that returns the maximum number of requests that were in flight.
+// Earlier pages take longer, so that the pages finish out of order.
+func pageResponse() (func(context.Context, int, []llms.ContentPart) (string, error), func() int) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+
+	respond := func(_ context.Context, _ int, parts []llms.ContentPart) (string, error) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+
+		img, err := jpeg.Decode(bytes.NewReader(parts[0].(llms.BinaryContent).Data))
+		if err != nil {
+			return "", err
+		}
+		page := img.Bounds().Dx()
+		time.Sleep(time.Duration(10-page) * 5 * time.Millisecond)
+		return fmt.Sprintf("page %d", page), nil
+	}
+	return respond, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return maxInFlight
+	}
+}
+
+func TestProcessDocumentOCR_Concurrency(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.teardown()
+
+	// Pre-populate the image cache, so that no download is needed. OCR removes the images afterwards.
+	env.client.CacheFolder = t.TempDir()
+	docDir := filepath.Join(env.client.CacheFolder, "document-125")
+	require.NoError(t, os.MkdirAll(docDir, 0755))
+	writePages := func() {
+		for i := 0; i < 6; i++ {
+			var buf bytes.Buffer
+			require.NoError(t, jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, i+1, 1)), nil))
+			require.NoError(t, os.WriteFile(filepath.Join(docDir, fmt.Sprintf("page%03d.jpg", i)), buf.Bytes(), 0644))
+		}
+		require.NoError(t, writeCachedPageCount(docDir, 6))
+	}
+
+	originalConcurrency, originalRequests := ocrPageConcurrency, visionRequests
+	defer func() { ocrPageConcurrency, visionRequests = originalConcurrency, originalRequests }()
+	var err error
+	ocrTemplate, err = template.New("ocr").Parse(defaultOcrPrompt)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name             string
+		pageConcurrency  int
+		visionRequests   *semaphore.Weighted
+		maxExpectedCalls int
+	}{
+		{name: "sequential", pageConcurrency: 1, maxExpectedCalls: 1},
+		{name: "parallel pages", pageConcurrency: 4, maxExpectedCalls: 4},
+		{name: "limited vision requests", pageConcurrency: 4, visionRequests: semaphore.NewWeighted(2), maxExpectedCalls: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			writePages()
+			ocrPageConcurrency, visionRequests = tc.pageConcurrency, tc.visionRequests
+			respond, maxInFlight := pageResponse()
+			app := &App{Client: env.client, VisionLLM: &mockLLM{respond: respond}}
+
+			var reports []OCRProgress
+			text, err := app.ProcessDocumentOCR(context.Background(), 125, allPages, func(progress OCRProgress) {
+				reports = append(reports, progress)
+			})
+			require.NoError(t, err)
+
+			// The text is joined in page order even if the pages finished out of order
+			assert.Equal(t, "page 1\n\npage 2\n\npage 3\n\npage 4\n\npage 5\n\npage 6", text)
+			assert.LessOrEqual(t, maxInFlight(), tc.maxExpectedCalls)
+			if tc.pageConcurrency > 1 {
+				assert.Greater(t, maxInFlight(), 1)
+			}
+
+			// Progress is reported for every page and only contains leading pages
+			require.Len(t, reports, 7)
+			for i, report := range reports {
+				assert.Equal(t, i, report.PagesDone)
+				for j, pageText := range report.PageTexts {
+					assert.Equal(t, fmt.Sprintf("page %d", j+1), pageText)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pageSelection selects the pages of a document that OCR reads, parsed from an expression like
+// "1-3,last", "odd" or "all". The zero value selects all pages.
+type pageSelection struct {
+	expr   string
+	ranges []pageRange
+}
+
+// pageRange is a range of page numbers counted from 1, where lastPage stands for the last page
+type pageRange struct {
+	from, to int
+	step     int
+}
+
+// lastPage is the page number of the last page in a pageRange
+const lastPage = -1
+
+// allPages selects every page
+var allPages = pageSelection{}
+
+// firstPages selects the first n pages, all pages if n <= 0
+func firstPages(n int) pageSelection {
+	if n <= 0 {
+		return allPages
+	}
+	return pageSelection{expr: fmt.Sprintf("1-%d", n), ranges: []pageRange{{from: 1, to: n, step: 1}}}
+}
+
+// parsePageSelection parses a comma-separated list of pages and ranges. Items are a page number ("4"),
+// a range ("2-5", "3-last"), "last", "odd", "even" or "all".
+func parsePageSelection(expr string) (pageSelection, error) {
+	var selection pageSelection
+	var items []string
+	for _, item := range strings.Split(strings.ToLower(expr), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		items = append(items, item)
+
+		switch item {
+		case "all":
+			selection.ranges = append(selection.ranges, pageRange{from: 1, to: lastPage, step: 1})
+			continue
+		case "odd":
+			selection.ranges = append(selection.ranges, pageRange{from: 1, to: lastPage, step: 2})
+			continue
+		case "even":
+			selection.ranges = append(selection.ranges, pageRange{from: 2, to: lastPage, step: 2})
+			continue
+		}
+
+		rawFrom, rawTo, isRange := strings.Cut(item, "-")
+		if !isRange {
+			rawTo = rawFrom
+		}
+		from, err := parsePageNumber(rawFrom)
+		if err != nil {
+			return pageSelection{}, fmt.Errorf("invalid page selection '%s': %w", item, err)
+		}
+		to, err := parsePageNumber(rawTo)
+		if err != nil {
+			return pageSelection{}, fmt.Errorf("invalid page selection '%s': %w", item, err)
+		}
+		if (from == lastPage && to != lastPage) || (to != lastPage && from > to) {
+			return pageSelection{}, fmt.Errorf("invalid page selection '%s': the range ends before it starts", item)
+		}
+		selection.ranges = append(selection.ranges, pageRange{from: from, to: to, step: 1})
+	}
+
+	if len(items) == 0 {
+		return pageSelection{}, fmt.Errorf("empty page selection")
+	}
+	selection.expr = strings.Join(items, ",")
+	return selection, nil
+}
+
+// parsePageNumber parses a page number counted from 1 or "last"
+func parsePageNumber(raw string) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "last" {
+		return lastPage, nil
+	}
+	page, err := strconv.Atoi(raw)
+	if err != nil || page < 1 {
+		return 0, fmt.Errorf("'%s' is no page number", raw)
+	}
+	return page, nil
+}
+
+// String returns the normalized expression of the selection
+func (s pageSelection) String() string {
+	if len(s.ranges) == 0 {
+		return "all"
+	}
+	return s.expr
+}
+
+// isAll reports whether the selection contains every page of any document
+func (s pageSelection) isAll() bool {
+	if len(s.ranges) == 0 {
+		return true
+	}
+	for _, r := range s.ranges {
+		if r.from == 1 && r.to == lastPage && r.step == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// pages returns the selected page numbers of a document with totalPages pages, counted from 1
+// and in ascending order. Pages beyond the end of the document are left out.
+func (s pageSelection) pages(totalPages int) []int {
+	if len(s.ranges) == 0 {
+		s = pageSelection{ranges: []pageRange{{from: 1, to: lastPage, step: 1}}}
+	}
+
+	selected := make([]bool, totalPages+1)
+	for _, r := range s.ranges {
+		from, to := r.from, r.to
+		if from == lastPage {
+			from = totalPages
+		}
+		if to == lastPage || to > totalPages {
+			to = totalPages
+		}
+		for page := from; page <= to; page += r.step {
+			selected[page] = true
+		}
+	}
+
+	var pages []int
+	for page := 1; page <= totalPages; page++ {
+		if selected[page] {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePageSelection(t *testing.T) {
+	for _, tc := range []struct {
+		expr     string
+		expected []int // Pages of a document with 10 pages
+		str      string
+	}{
+		{expr: "all", expected: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, str: "all"},
+		{expr: "1-3,last", expected: []int{1, 2, 3, 10}, str: "1-3,last"},
+		{expr: " Odd ", expected: []int{1, 3, 5, 7, 9}, str: "odd"},
+		{expr: "even", expected: []int{2, 4, 6, 8, 10}, str: "even"},
+		{expr: "8-last,2", expected: []int{2, 8, 9, 10}, str: "8-last,2"},
+		{expr: "last,last", expected: []int{10}, str: "last,last"},
+		{expr: "9-20,15", expected: []int{9, 10}, str: "9-20,15"},
+		{expr: "last-last", expected: []int{10}, str: "last-last"},
+	} {
+		selection, err := parsePageSelection(tc.expr)
+		require.NoError(t, err, tc.expr)
+		assert.Equal(t, tc.expected, selection.pages(10), tc.expr)
+		assert.Equal(t, tc.str, selection.String(), tc.expr)
+	}
+
+	for _, expr := range []string{"", " , ", "0", "3-1", "last-2", "first", "1-", "-3", "1-2-3"} {
+		_, err := parsePageSelection(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestPageSelectionShortDocuments(t *testing.T) {
+	selection, err := parsePageSelection("1-3,last")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, selection.pages(2))
+	assert.Equal(t, []int{1}, selection.pages(1))
+
+	assert.Equal(t, []int{1, 2, 3}, allPages.pages(3))
+	assert.Equal(t, []int{1, 2}, firstPages(5).pages(2))
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, firstPages(5).pages(52))
+	assert.Equal(t, "1-5", firstPages(5).String())
+	assert.True(t, firstPages(0).isAll())
+	assert.False(t, firstPages(5).isAll())
+
+	even, err := parsePageSelection("even")
+	require.NoError(t, err)
+	assert.Empty(t, even.pages(1))
+}
+
+func TestDownloadDocumentAsImages_PageSelection(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.teardown()
+	env.client.CacheFolder = t.TempDir()
+
+	// A TIFF with 5 pages
+	var tiffPages []*image.Gray
+	for page := 1; page <= 5; page++ {
+		tiffPages = append(tiffPages, image.NewGray(image.Rect(0, 0, 10*page, 10)))
+	}
+	tiff := testTIFF(tiffPages...)
+	downloads := 0
+	env.setMockResponse("/api/documents/9/download/", func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.WriteHeader(http.StatusOK)
+		w.Write(tiff)
+	})
+
+	firstAndLast, err := parsePageSelection("1,last")
+	require.NoError(t, err)
+	images, err := env.client.DownloadDocumentAsImages(context.Background(), 9, firstAndLast)
+	require.NoError(t, err)
+	require.Len(t, images, 2)
+	assert.Equal(t, 1, images[0].Page)
+	assert.Equal(t, 5, images[1].Page)
+	assert.FileExists(t, images[1].Path)
+	assert.Equal(t, 1, downloads)
+
+	// Pages that are cached are not downloaded again, even if they are not at the start
+	images, err = env.client.DownloadDocumentAsImages(context.Background(), 9, firstAndLast)
+	require.NoError(t, err)
+	assert.Len(t, images, 2)
+	assert.Equal(t, 1, downloads)
+
+	// Missing pages are rendered, cached pages are kept
+	require.NoError(t, os.Remove(images[0].Path))
+	odd, err := parsePageSelection("odd")
+	require.NoError(t, err)
+	images, err = env.client.DownloadDocumentAsImages(context.Background(), 9, odd)
+	require.NoError(t, err)
+	require.Len(t, images, 3)
+	assert.Equal(t, []int{1, 3, 5}, []int{images[0].Page, images[1].Page, images[2].Page})
+	assert.Equal(t, 2, downloads)
+
+	// A selection that matches no page is an error
+	beyond, err := parsePageSelection("7-9")
+	require.NoError(t, err)
+	_, err = env.client.DownloadDocumentAsImages(context.Background(), 9, beyond)
+	assert.ErrorContains(t, err, "matches none of the 5 pages")
+}
+
+func TestSubmitOCRJobHandler_Pages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalStore := jobStore
+	defer func() { jobStore = originalStore }()
+	jobStore = newTestJobStore(t)
+
+	app := &App{}
+	router := gin.New()
+	router.POST("/api/documents/:id/ocr", app.submitOCRJobHandler)
+	router.GET("/api/jobs/ocr/:job_id", app.getJobStatusHandler)
+
+	submit := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/api/documents/5/ocr", strings.NewReader(body)))
+		return w
+	}
+
+	w := submit(`{"pages": "1-3, LAST"}`)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var response struct {
+		JobID string `json:"job_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	job, ok := jobStore.getJob(response.JobID)
+	require.True(t, ok)
+	assert.Equal(t, "1-3,last", job.Pages)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/jobs/ocr/"+response.JobID, nil))
+	assert.Contains(t, w.Body.String(), `"page_selection":"1-3,last"`)
+
+	// Without a selection, the job reads the configured pages
+	w = submit("")
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	job, ok = jobStore.getJob(response.JobID)
+	require.True(t, ok)
+	assert.Empty(t, job.Pages)
+
+	w = submit(`{"pages": "3-1"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "3-1")
+}
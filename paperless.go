@@ -4,16 +4,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
 	"image/jpeg"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gen2brain/go-fitz"
 	"golang.org/x/sync/errgroup"
@@ -168,6 +173,29 @@ func (client *PaperlessClient) GetDocumentsByTags(ctx context.Context, tags []st
 		return nil, err
 	}
 
+	// Document types and storage paths are only fetched if a document has one, to keep polling cheap
+	hasDocumentType, hasStoragePath := false, false
+	for _, result := range documentsResponse.Results {
+		hasDocumentType = hasDocumentType || result.DocumentType != 0
+		hasStoragePath = hasStoragePath || result.StoragePath != 0
+	}
+
+	var allDocumentTypes map[string]int
+	if hasDocumentType {
+		allDocumentTypes, err = client.GetAllDocumentTypes(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var allStoragePaths map[string]StoragePath
+	if hasStoragePath {
+		allStoragePaths, err = client.GetAllStoragePaths(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	documents := make([]Document, 0, len(documentsResponse.Results))
 	for _, result := range documentsResponse.Results {
 		tagNames := make([]string, len(result.Tags))
@@ -190,12 +218,36 @@ func (client *PaperlessClient) GetDocumentsByTags(ctx context.Context, tags []st
 			}
 		}
 
+		documentTypeName := ""
+		if result.DocumentType != 0 {
+			for name, id := range allDocumentTypes {
+				if result.DocumentType == id {
+					documentTypeName = name
+					break
+				}
+			}
+		}
+
+		storagePathName := ""
+		if result.StoragePath != 0 {
+			for name, storagePath := range allStoragePaths {
+				if result.StoragePath == storagePath.ID {
+					storagePathName = name
+					break
+				}
+			}
+		}
+
 		documents = append(documents, Document{
 			ID:            result.ID,
 			Title:         result.Title,
 			Content:       result.Content,
 			Correspondent: correspondentName,
+			DocumentType:  documentTypeName,
+			StoragePath:   storagePathName,
 			Tags:          tagNames,
+			CustomFields:  result.CustomFields,
+			CreatedDate:   result.CreatedDate,
 		})
 	}
 
@@ -219,6 +271,10 @@ func (client *PaperlessClient) DownloadPDF(ctx context.Context, document Documen
 	return io.ReadAll(resp.Body)
 }
 
+// errDocumentNotFound is returned by GetDocument if the document does not exist
+var errDocumentNotFound = errors.New("document not found")
+
+// GetDocument retrieves a single document by its ID
 func (client *PaperlessClient) GetDocument(ctx context.Context, documentID int) (Document, error) {
 	path := fmt.Sprintf("api/documents/%d/", documentID)
 	resp, err := client.Do(ctx, "GET", path, nil)
@@ -227,6 +283,9 @@ func (client *PaperlessClient) GetDocument(ctx context.Context, documentID int)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return Document{}, fmt.Errorf("error fetching document %d: %w", documentID, errDocumentNotFound)
+	}
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		return Document{}, fmt.Errorf("error fetching document %d: %d, %s", documentID, resp.StatusCode, string(bodyBytes))
@@ -248,6 +307,22 @@ func (client *PaperlessClient) GetDocument(ctx context.Context, documentID int)
 		return Document{}, err
 	}
 
+	var allDocumentTypes map[string]int
+	if documentResponse.DocumentType != 0 {
+		allDocumentTypes, err = client.GetAllDocumentTypes(ctx)
+		if err != nil {
+			return Document{}, err
+		}
+	}
+
+	var allStoragePaths map[string]StoragePath
+	if documentResponse.StoragePath != 0 {
+		allStoragePaths, err = client.GetAllStoragePaths(ctx)
+		if err != nil {
+			return Document{}, err
+		}
+	}
+
 	// Match tag IDs to tag names
 	tagNames := make([]string, len(documentResponse.Tags))
 	for i, resultTagID := range documentResponse.Tags {
@@ -268,12 +343,38 @@ func (client *PaperlessClient) GetDocument(ctx context.Context, documentID int)
 		}
 	}
 
+	// Match document type ID to document type name
+	documentTypeName := ""
+	if documentResponse.DocumentType != 0 {
+		for name, id := range allDocumentTypes {
+			if documentResponse.DocumentType == id {
+				documentTypeName = name
+				break
+			}
+		}
+	}
+
+	// Match storage path ID to storage path name
+	storagePathName := ""
+	if documentResponse.StoragePath != 0 {
+		for name, storagePath := range allStoragePaths {
+			if documentResponse.StoragePath == storagePath.ID {
+				storagePathName = name
+				break
+			}
+		}
+	}
+
 	return Document{
 		ID:            documentResponse.ID,
 		Title:         documentResponse.Title,
 		Content:       documentResponse.Content,
 		Correspondent: correspondentName,
+		DocumentType:  documentTypeName,
+		StoragePath:   storagePathName,
 		Tags:          tagNames,
+		CustomFields:  documentResponse.CustomFields,
+		CreatedDate:   documentResponse.CreatedDate,
 	}, nil
 }
 
@@ -304,12 +405,48 @@ func (client *PaperlessClient) UpdateDocuments(ctx context.Context, documents []
 		}
 	}
 
+	documentsContainSuggestedDocumentType := false
+	for _, document := range documents {
+		if document.SuggestedDocumentType != "" {
+			documentsContainSuggestedDocumentType = true
+			break
+		}
+	}
+
+	availableDocumentTypes := make(map[string]int)
+	if documentsContainSuggestedDocumentType {
+		availableDocumentTypes, err = client.GetAllDocumentTypes(ctx)
+		if err != nil {
+			log.Errorf("Error fetching available document types: %v", err)
+			return err
+		}
+	}
+
+	documentsContainSuggestedStoragePath := false
+	for _, document := range documents {
+		if document.SuggestedStoragePath != "" {
+			documentsContainSuggestedStoragePath = true
+			break
+		}
+	}
+
+	availableStoragePaths := make(map[string]StoragePath)
+	if documentsContainSuggestedStoragePath {
+		availableStoragePaths, err = client.GetAllStoragePaths(ctx)
+		if err != nil {
+			log.Errorf("Error fetching available storage paths: %v", err)
+			return err
+		}
+	}
+
 	for _, document := range documents {
 		documentID := document.ID
 
 		//  Original fields will store any updated fields to store records for
 		originalFields := make(map[string]interface{})
 		updatedFields := make(map[string]interface{})
+		// Names of resolved ID fields (document type, storage path), so history can be undone by name
+		updatedNames := make(map[string]string)
 		newTags := []int{}
 
 		tags := document.SuggestedTags
@@ -375,6 +512,33 @@ func (client *PaperlessClient) UpdateDocuments(ctx context.Context, documents []
 			}
 		}
 
+		// Map suggested document type names to IDs. Unlike correspondents, document types are never created on the fly.
+		if document.SuggestedDocumentType != "" {
+			if documentTypeID, exists := availableDocumentTypes[document.SuggestedDocumentType]; exists {
+				originalFields["document_type"] = document.OriginalDocument.DocumentType
+				updatedFields["document_type"] = documentTypeID
+				updatedNames["document_type"] = document.SuggestedDocumentType
+			} else {
+				log.Errorf("Suggested document type '%s' does not exist in paperless-ngx, skipping.", document.SuggestedDocumentType)
+			}
+		}
+
+		// Map suggested storage path names to IDs
+		if document.SuggestedStoragePath != "" {
+			if storagePath, exists := availableStoragePaths[document.SuggestedStoragePath]; exists {
+				originalFields["storage_path"] = document.OriginalDocument.StoragePath
+				updatedFields["storage_path"] = storagePath.ID
+				updatedNames["storage_path"] = document.SuggestedStoragePath
+			} else {
+				log.Errorf("Suggested storage path '%s' does not exist in paperless-ngx, skipping.", document.SuggestedStoragePath)
+			}
+		}
+
+		// Custom fields are sent as a complete list, so merge the suggestions into the current values
+		if len(document.SuggestedCustomFields) > 0 {
+			updatedFields["custom_fields"] = mergeCustomFields(document.OriginalDocument.CustomFields, document.SuggestedCustomFields)
+		}
+
 		suggestedTitle := document.SuggestedTitle
 		if len(suggestedTitle) > 128 {
 			suggestedTitle = suggestedTitle[:128]
@@ -386,6 +550,16 @@ func (client *PaperlessClient) UpdateDocuments(ctx context.Context, documents []
 			log.Warnf("No valid title found for document %d, skipping.", documentID)
 		}
 
+		// Suggested created date, validated again since it may have been edited in the web UI
+		if document.SuggestedCreatedDate != "" {
+			if createdDate, err := parseSuggestedCreatedDate(document.SuggestedCreatedDate, time.Now()); err != nil {
+				log.Errorf("Suggested created date of document %d is invalid, skipping: %v", documentID, err)
+			} else if createdDate != "" {
+				originalFields["created_date"] = document.OriginalDocument.CreatedDate
+				updatedFields["created_date"] = createdDate
+			}
+		}
+
 		// Suggested Content
 		suggestedContent := document.SuggestedContent
 		if suggestedContent != "" {
@@ -431,6 +605,16 @@ func (client *PaperlessClient) UpdateDocuments(ctx context.Context, documents []
 							NewValue:      string(updatedTagsJSON),
 						}
 					}
+				} else if updatedName, resolved := updatedNames[field]; resolved {
+					// Store names rather than IDs so that the change can be undone by name
+					if originalFields[field] != updatedName {
+						modificationRecord = ModificationHistory{
+							DocumentID:    uint(documentID),
+							ModField:      field,
+							PreviousValue: fmt.Sprintf("%v", originalFields[field]),
+							NewValue:      updatedName,
+						}
+					}
 				} else {
 					// Only store mod if field actually changed
 					if originalFields[field] != updatedFields[field] {
@@ -452,6 +636,27 @@ func (client *PaperlessClient) UpdateDocuments(ctx context.Context, documents []
 					return err
 				}
 			}
+
+			// Record each changed custom field separately, so they can be undone one by one
+			for _, customField := range document.SuggestedCustomFields {
+				previousValue := customFieldValueString(document.OriginalDocument.CustomFields, customField.ID)
+				newValue := formatCustomFieldValue(customField.Value)
+				if previousValue == newValue {
+					continue
+				}
+
+				log.Printf("Document %d: Updated custom field %s from %v to %v", documentID, customField.Name, previousValue, newValue)
+				err = InsertModification(db, &ModificationHistory{
+					DocumentID:    uint(documentID),
+					ModField:      customFieldModPrefix + customField.Name,
+					PreviousValue: previousValue,
+					NewValue:      newValue,
+				})
+				if err != nil {
+					log.Errorf("Error inserting modification record for document %d: %v", documentID, err)
+					return err
+				}
+			}
 		}
 
 		log.Printf("Document %d updated successfully.", documentID)
@@ -460,38 +665,118 @@ func (client *PaperlessClient) UpdateDocuments(ctx context.Context, documents []
 	return nil
 }
 
-// DownloadDocumentAsImages downloads the PDF file of the specified document and converts it to images
-// If limitPages > 0, only the first N pages will be processed
-func (client *PaperlessClient) DownloadDocumentAsImages(ctx context.Context, documentId int, limitPages int) ([]string, error) {
-	// Create a directory named after the document ID
-	docDir := filepath.Join(client.GetCacheFolder(), fmt.Sprintf("document-%d", documentId))
-	if _, err := os.Stat(docDir); os.IsNotExist(err) {
-		err = os.MkdirAll(docDir, 0755)
-		if err != nil {
-			return nil, err
-		}
+// ClearDocumentField resets a nullable field of a document (e.g. document_type) to null
+func (client *PaperlessClient) ClearDocumentField(ctx context.Context, documentID int, field string) error {
+	jsonData, err := json.Marshal(map[string]interface{}{field: nil})
+	if err != nil {
+		return err
 	}
 
-	// Check if images already exist
-	var imagePaths []string
-	for n := 0; ; n++ {
-		if limitPages > 0 && n >= limitPages {
-			break
-		}
-		imagePath := filepath.Join(docDir, fmt.Sprintf("page%03d.jpg", n))
-		if _, err := os.Stat(imagePath); os.IsNotExist(err) {
-			break
-		}
-		imagePaths = append(imagePaths, imagePath)
+	path := fmt.Sprintf("api/documents/%d/", documentID)
+	resp, err := client.Do(ctx, "PATCH", path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
 
-	// If images exist, return them
-	if len(imagePaths) > 0 {
-		return imagePaths, nil
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("error clearing %s of document %d: %d, %s", field, documentID, resp.StatusCode, string(bodyBytes))
 	}
 
-	// Proceed with downloading and converting the document to images
-	path := fmt.Sprintf("api/documents/%d/download/", documentId)
+	return nil
+}
+
+// SetDocumentCustomFields replaces the custom fields of a document, leaving its other fields unchanged
+func (client *PaperlessClient) SetDocumentCustomFields(ctx context.Context, documentID int, customFields []CustomFieldValue) error {
+	jsonData, err := json.Marshal(map[string]interface{}{"custom_fields": customFields})
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("api/documents/%d/", documentID)
+	resp, err := client.Do(ctx, "PATCH", path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("error updating custom fields of document %d: %d, %s", documentID, resp.StatusCode, string(bodyBytes))
+	}
+
+	return nil
+}
+
+// CreateOrGetTag creates a new tag or returns the ID of the existing tag with the same name
+func (client *PaperlessClient) CreateOrGetTag(ctx context.Context, name string) (int, error) {
+	tags, err := client.GetAllTags(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching tags: %w", err)
+	}
+
+	if id, exists := tags[name]; exists {
+		return id, nil
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"name":               name,
+		"matching_algorithm": 0,
+		"is_insensitive":     true,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := client.Do(ctx, "POST", "api/tags/", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("error creating tag: %d, %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var createdTag struct {
+		ID int `json:"id"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&createdTag)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Infof("Created tag %s with ID %d", name, createdTag.ID)
+	return createdTag.ID, nil
+}
+
+// AddDocumentNote adds a note to the specified document
+func (client *PaperlessClient) AddDocumentNote(ctx context.Context, documentID int, note string) error {
+	jsonData, err := json.Marshal(map[string]string{"note": note})
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("api/documents/%d/notes/", documentID)
+	resp, err := client.Do(ctx, "POST", path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("error adding note to document %d: %d, %s", documentID, resp.StatusCode, string(bodyBytes))
+	}
+
+	return nil
+}
+
+// GetDocumentNotes returns the notes of the specified document
+func (client *PaperlessClient) GetDocumentNotes(ctx context.Context, documentID int) ([]DocumentNote, error) {
+	path := fmt.Sprintf("api/documents/%d/notes/", documentID)
 	resp, err := client.Do(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, err
@@ -500,92 +785,343 @@ func (client *PaperlessClient) DownloadDocumentAsImages(ctx context.Context, doc
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("error downloading document %d: %d, %s", documentId, resp.StatusCode, string(bodyBytes))
+		return nil, fmt.Errorf("error fetching notes of document %d: %d, %s", documentID, resp.StatusCode, string(bodyBytes))
 	}
 
-	pdfData, err := io.ReadAll(resp.Body)
-	if err != nil {
+	var notes []DocumentNote
+	if err := json.NewDecoder(resp.Body).Decode(&notes); err != nil {
 		return nil, err
 	}
+	return notes, nil
+}
 
-	tmpFile, err := os.CreateTemp("", "document-*.pdf")
+// DeleteDocumentNote removes a note from the specified document
+func (client *PaperlessClient) DeleteDocumentNote(ctx context.Context, documentID, noteID int) error {
+	path := fmt.Sprintf("api/documents/%d/notes/?id=%d", documentID, noteID)
+	resp, err := client.Do(ctx, "DELETE", path, nil)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("error deleting note %d of document %d: %d, %s", noteID, documentID, resp.StatusCode, string(bodyBytes))
 	}
-	defer os.Remove(tmpFile.Name())
 
-	_, err = tmpFile.Write(pdfData)
+	return nil
+}
+
+// UploadDocument uploads a file to paperless-ngx for consumption and returns the ID of the consumption task
+func (client *PaperlessClient) UploadDocument(ctx context.Context, filename string, content []byte, metadata DocumentUpload) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	part, err := writer.CreateFormFile("document", filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(content); err != nil {
+		return "", err
+	}
+
+	fields := map[string]string{"title": metadata.Title, "created": metadata.Created}
+	if metadata.Correspondent != "" {
+		correspondents, err := client.GetAllCorrespondents(ctx)
+		if err != nil {
+			return "", fmt.Errorf("error fetching correspondents: %w", err)
+		}
+		id, ok := correspondents[metadata.Correspondent]
+		if !ok {
+			return "", fmt.Errorf("correspondent %q not found", metadata.Correspondent)
+		}
+		fields["correspondent"] = strconv.Itoa(id)
+	}
+	if metadata.DocumentType != "" {
+		documentTypes, err := client.GetAllDocumentTypes(ctx)
+		if err != nil {
+			return "", fmt.Errorf("error fetching document types: %w", err)
+		}
+		id, ok := documentTypes[metadata.DocumentType]
+		if !ok {
+			return "", fmt.Errorf("document type %q not found", metadata.DocumentType)
+		}
+		fields["document_type"] = strconv.Itoa(id)
+	}
+	if metadata.StoragePath != "" {
+		storagePaths, err := client.GetAllStoragePaths(ctx)
+		if err != nil {
+			return "", fmt.Errorf("error fetching storage paths: %w", err)
+		}
+		storagePath, ok := storagePaths[metadata.StoragePath]
+		if !ok {
+			return "", fmt.Errorf("storage path %q not found", metadata.StoragePath)
+		}
+		fields["storage_path"] = strconv.Itoa(storagePath.ID)
+	}
+	for _, name := range []string{"title", "created", "correspondent", "document_type", "storage_path"} {
+		if fields[name] == "" {
+			continue
+		}
+		if err := writer.WriteField(name, fields[name]); err != nil {
+			return "", err
+		}
+	}
+
+	if len(metadata.Tags) > 0 {
+		tags, err := client.GetAllTags(ctx)
+		if err != nil {
+			return "", fmt.Errorf("error fetching tags: %w", err)
+		}
+		for _, tag := range metadata.Tags {
+			id, ok := tags[tag]
+			if !ok {
+				return "", fmt.Errorf("tag %q not found", tag)
+			}
+			if err := writer.WriteField("tags", strconv.Itoa(id)); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	// Do always sends JSON, so the multipart request is built here
+	url := fmt.Sprintf("%s/api/documents/post_document/", client.BaseURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", client.APIToken))
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("error uploading document: %d, %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	// paperless-ngx answers with the ID of the consumption task as a JSON string
+	var taskID string
+	if err := json.NewDecoder(resp.Body).Decode(&taskID); err != nil {
+		return "", fmt.Errorf("error decoding upload response: %w", err)
+	}
+	return taskID, nil
+}
+
+// DownloadDocumentAsImages downloads the specified document and converts the selected pages to images.
+// PDFs and multipage TIFFs are rendered page by page, JPEG, PNG and WebP originals are a single page.
+// The images are cached per page, only pages that are missing from the cache are rendered.
+func (client *PaperlessClient) DownloadDocumentAsImages(ctx context.Context, documentId int, pages pageSelection) ([]PageImage, error) {
+	// Create a directory named after the document ID
+	docDir := filepath.Join(client.GetCacheFolder(), fmt.Sprintf("document-%d", documentId))
+	if _, err := os.Stat(docDir); os.IsNotExist(err) {
+		err = os.MkdirAll(docDir, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The page count is cached as well, so that the selection can be resolved without a download
+	if totalPages, ok := readCachedPageCount(docDir); ok {
+		selected, err := selectPages(documentId, pages, totalPages)
+		if err != nil {
+			return nil, err
+		}
+		images := pageImages(docDir, selected)
+		if allPagesCached(images) {
+			return images, nil
+		}
+	}
+
+	// Proceed with downloading and converting the document to images
+	data, contentType, err := client.downloadDocumentForOCR(ctx, documentId)
 	if err != nil {
 		return nil, err
 	}
-	tmpFile.Close()
 
-	doc, err := fitz.New(tmpFile.Name())
+	if isSinglePageImage(contentType) {
+		selected, err := selectPages(documentId, pages, 1)
+		if err != nil {
+			return nil, err
+		}
+		img, err := decodePageImage(data)
+		if err != nil {
+			return nil, fmt.Errorf("error reading document %d: %w", documentId, err)
+		}
+		images := pageImages(docDir, selected)
+		if err := writePageJPEG(images[0].Path, img); err != nil {
+			return nil, err
+		}
+		return images, writeCachedPageCount(docDir, 1)
+	}
+
+	// MuPDF renders the pages of PDFs and TIFFs
+	doc, err := fitz.NewFromMemory(data)
 	if err != nil {
 		return nil, err
 	}
 	defer doc.Close()
 
 	totalPages := doc.NumPage()
-	if limitPages > 0 && limitPages < totalPages {
-		totalPages = limitPages
+	selected, err := selectPages(documentId, pages, totalPages)
+	if err != nil {
+		return nil, err
 	}
+	images := pageImages(docDir, selected)
 
 	var mu sync.Mutex
 	var g errgroup.Group
 
-	for n := 0; n < totalPages; n++ {
-		n := n // capture loop variable
+	for _, pageImage := range images {
+		if _, err := os.Stat(pageImage.Path); err == nil {
+			continue
+		}
 		g.Go(func() error {
+			// Stop rendering when the OCR job was cancelled
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
 			mu.Lock()
 			// I assume the libmupdf library is not thread-safe
-			img, err := doc.Image(n)
+			img, err := doc.ImageDPI(pageImage.Page-1, renderDPI())
 			mu.Unlock()
 			if err != nil {
 				return err
 			}
 
-			imagePath := filepath.Join(docDir, fmt.Sprintf("page%03d.jpg", n))
-			f, err := os.Create(imagePath)
-			if err != nil {
-				return err
-			}
+			return writePageJPEG(pageImage.Path, img)
+		})
+	}
 
-			err = jpeg.Encode(f, img, &jpeg.Options{Quality: jpeg.DefaultQuality})
-			if err != nil {
-				f.Close()
-				return err
-			}
-			f.Close()
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
 
-			// Verify the JPEG file
-			file, err := os.Open(imagePath)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
+	return images, writeCachedPageCount(docDir, totalPages)
+}
 
-			_, err = jpeg.Decode(file)
-			if err != nil {
-				return fmt.Errorf("invalid JPEG file: %s", imagePath)
-			}
+// selectPages resolves the page selection for a document, it fails if no page is selected
+func selectPages(documentId int, pages pageSelection, totalPages int) ([]int, error) {
+	selected := pages.pages(totalPages)
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("the page selection '%s' matches none of the %d pages of document %d", pages, totalPages, documentId)
+	}
+	return selected, nil
+}
 
-			mu.Lock()
-			imagePaths = append(imagePaths, imagePath)
-			mu.Unlock()
+// pageImages returns the cache paths of the images of the pages
+func pageImages(docDir string, pages []int) []PageImage {
+	images := make([]PageImage, len(pages))
+	for i, page := range pages {
+		images[i] = PageImage{Page: page, Path: filepath.Join(docDir, fmt.Sprintf("page%03d.jpg", page-1))}
+	}
+	return images
+}
 
-			return nil
-		})
+// allPagesCached reports whether the images of all pages exist
+func allPagesCached(images []PageImage) bool {
+	for _, pageImage := range images {
+		if _, err := os.Stat(pageImage.Path); err != nil {
+			return false
+		}
 	}
+	return true
+}
 
-	if err := g.Wait(); err != nil {
+// readCachedPageCount returns the page count stored with the cached images of a document
+func readCachedPageCount(docDir string) (int, bool) {
+	raw, err := os.ReadFile(filepath.Join(docDir, "page-count"))
+	if err != nil {
+		return 0, false
+	}
+	totalPages, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil || totalPages < 1 {
+		return 0, false
+	}
+	return totalPages, true
+}
+
+// writeCachedPageCount stores the page count with the cached images of a document
+func writeCachedPageCount(docDir string, totalPages int) error {
+	return os.WriteFile(filepath.Join(docDir, "page-count"), []byte(strconv.Itoa(totalPages)), 0644)
+}
+
+// downloadDocumentForOCR downloads the original file of a document, or its archive version if the
+// original is neither a PDF nor an image, e.g. an Office document. It returns the file with its content type.
+func (client *PaperlessClient) downloadDocumentForOCR(ctx context.Context, documentId int) ([]byte, string, error) {
+	data, err := client.downloadDocumentFile(ctx, documentId, "")
+	if err != nil {
+		return nil, "", err
+	}
+	contentType := detectContentType(data)
+	if isOCRContentType(contentType) {
+		return data, contentType, nil
+	}
+
+	log.Infof("Document %d is a %s file, using its archive version for OCR", documentId, contentType)
+	data, err = client.downloadDocumentFile(ctx, documentId, "?original=false")
+	if err != nil {
+		return nil, "", err
+	}
+	archiveContentType := detectContentType(data)
+	if !isOCRContentType(archiveContentType) {
+		return nil, "", fmt.Errorf("document %d is a %s file and has no PDF archive version", documentId, contentType)
+	}
+	return data, archiveContentType, nil
+}
+
+// downloadDocumentFile downloads the file of a document, query selects the version
+func (client *PaperlessClient) downloadDocumentFile(ctx context.Context, documentId int, query string) ([]byte, error) {
+	path := fmt.Sprintf("api/documents/%d/download/%s", documentId, query)
+	resp, err := client.Do(ctx, "GET", path, nil)
+	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("error downloading document %d: %d, %s", documentId, resp.StatusCode, string(bodyBytes))
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// writePageJPEG saves the image of a page as JPEG and verifies the written file
+func writePageJPEG(imagePath string, img image.Image) error {
+	f, err := os.Create(imagePath)
+	if err != nil {
+		return err
+	}
+
+	err = jpeg.Encode(f, img, &jpeg.Options{Quality: jpegQuality()})
+	if err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
 
-	// sort the image paths to ensure they are in order
-	slices.Sort(imagePaths)
+	// Verify the JPEG file
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
-	return imagePaths, nil
+	_, err = jpeg.Decode(file)
+	if err != nil {
+		return fmt.Errorf("invalid JPEG file: %s", imagePath)
+	}
+	return nil
 }
 
 // GetCacheFolder returns the cache folder for the PaperlessClient
@@ -692,3 +1228,105 @@ func (client *PaperlessClient) GetAllCorrespondents(ctx context.Context) (map[st
 
 	return correspondentIDMapping, nil
 }
+
+// DocumentTypeResponse represents the response structure for document types
+type DocumentTypeResponse struct {
+	Results []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"results"`
+}
+
+// GetAllDocumentTypes retrieves all document types from the Paperless-NGX API
+func (client *PaperlessClient) GetAllDocumentTypes(ctx context.Context) (map[string]int, error) {
+	documentTypeIDMapping := make(map[string]int)
+	path := "api/document_types/?page_size=9999"
+
+	resp, err := client.Do(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("error fetching document types: %d, %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var documentTypesResponse DocumentTypeResponse
+
+	err = json.NewDecoder(resp.Body).Decode(&documentTypesResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, documentType := range documentTypesResponse.Results {
+		documentTypeIDMapping[documentType.Name] = documentType.ID
+	}
+
+	return documentTypeIDMapping, nil
+}
+
+// GetAllStoragePaths retrieves all storage paths from the Paperless-NGX API, keyed by name
+func (client *PaperlessClient) GetAllStoragePaths(ctx context.Context) (map[string]StoragePath, error) {
+	storagePathMapping := make(map[string]StoragePath)
+	path := "api/storage_paths/?page_size=9999"
+
+	resp, err := client.Do(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("error fetching storage paths: %d, %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var storagePathsResponse struct {
+		Results []StoragePath `json:"results"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&storagePathsResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, storagePath := range storagePathsResponse.Results {
+		storagePathMapping[storagePath.Name] = storagePath
+	}
+
+	return storagePathMapping, nil
+}
+
+// GetAllCustomFields retrieves all custom field definitions from the Paperless-NGX API, keyed by name
+func (client *PaperlessClient) GetAllCustomFields(ctx context.Context) (map[string]CustomField, error) {
+	customFieldMapping := make(map[string]CustomField)
+	path := "api/custom_fields/?page_size=9999"
+
+	resp, err := client.Do(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("error fetching custom fields: %d, %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var customFieldsResponse struct {
+		Results []CustomField `json:"results"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&customFieldsResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, customField := range customFieldsResponse.Results {
+		customFieldMapping[customField.Name] = customField
+	}
+
+	return customFieldMapping, nil
+}
@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -60,6 +61,18 @@ func newTestEnv(t *testing.T) *testEnv {
 		w.Write([]byte(`{"results": [{"id": 1, "name": "Alpha"}, {"id": 2, "name": "Beta"}]}`))
 	})
 
+	// Add mock response for /api/document_types/
+	env.setMockResponse("/api/document_types/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"results": [{"id": 1, "name": "Invoice"}, {"id": 2, "name": "Contract"}]}`))
+	})
+
+	// Add mock response for /api/storage_paths/
+	env.setMockResponse("/api/storage_paths/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"results": [{"id": 1, "name": "Taxes", "path": "taxes/{{ created_year }}/{{ title }}"}, {"id": 2, "name": "Home", "path": "home/{{ title }}"}]}`))
+	})
+
 	return env
 }
 
@@ -71,7 +84,7 @@ func InitializeTestDB() (*gorm.DB, error) {
 	}
 
 	// Migrate schema
-	err = db.AutoMigrate(&ModificationHistory{})
+	err = db.AutoMigrate(&ModificationHistory{}, &DocumentFailure{}, &Job{}, &OCRCacheEntry{}, &OCRTable{})
 	if err != nil {
 		return nil, err
 	}
@@ -186,6 +199,7 @@ func TestGetDocumentsByTags(t *testing.T) {
 				Content:       "Content 1",
 				Tags:          []int{1, 2},
 				Correspondent: 1,
+				DocumentType:  2,
 			},
 			{
 				ID:            2,
@@ -193,6 +207,7 @@ func TestGetDocumentsByTags(t *testing.T) {
 				Content:       "Content 2",
 				Tags:          []int{2, 3},
 				Correspondent: 2,
+				StoragePath:   1,
 			},
 		},
 	}
@@ -233,6 +248,7 @@ func TestGetDocumentsByTags(t *testing.T) {
 			Content:       "Content 1",
 			Tags:          []string{"tag1", "tag2"},
 			Correspondent: "Alpha",
+			DocumentType:  "Contract",
 		},
 		{
 			ID:            2,
@@ -240,12 +256,48 @@ func TestGetDocumentsByTags(t *testing.T) {
 			Content:       "Content 2",
 			Tags:          []string{"tag2", "tag3"},
 			Correspondent: "Beta",
+			StoragePath:   "Taxes",
 		},
 	}
 
 	assert.Equal(t, expectedDocuments, documents)
 }
 
+func TestGetDocumentsByTags_SkipsUnusedLookups(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.teardown()
+
+	// Documents without a document type or storage path don't need these lookups
+	lookups := 0
+	for _, path := range []string{"/api/document_types/", "/api/storage_paths/"} {
+		env.setMockResponse(path, func(w http.ResponseWriter, r *http.Request) {
+			lookups++
+			w.Write([]byte(`{"results": []}`))
+		})
+	}
+	env.setMockResponse("/api/documents/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [{"id": 1, "title": "Document 1", "tags": [1], "correspondent": 1}]}`))
+	})
+	env.setMockResponse("/api/documents/1/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 1, "title": "Document 1", "tags": [1]}`))
+	})
+	env.setMockResponse("/api/tags/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [{"id": 1, "name": "tag1"}]}`))
+	})
+
+	documents, err := env.client.GetDocumentsByTags(context.Background(), []string{"tag1"}, 25)
+	require.NoError(t, err)
+	require.Len(t, documents, 1)
+	assert.Equal(t, "Alpha", documents[0].Correspondent)
+
+	document, err := env.client.GetDocument(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Empty(t, document.DocumentType)
+	assert.Empty(t, document.StoragePath)
+
+	assert.Equal(t, 0, lookups)
+}
+
 // TestDownloadPDF tests the DownloadPDF method
 func TestDownloadPDF(t *testing.T) {
 	env := newTestEnv(t)
@@ -347,6 +399,196 @@ func TestUpdateDocuments(t *testing.T) {
 	require.NoError(t, err)
 }
 
+// TestUpdateDocuments_DocumentType tests that suggested document types are resolved and recorded for undo
+func TestUpdateDocuments_DocumentType(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.teardown()
+
+	documents := []DocumentSuggestion{
+		{
+			ID: 7,
+			OriginalDocument: Document{
+				ID:           7,
+				Title:        "Title",
+				Tags:         []string{"tag1"},
+				DocumentType: "Contract",
+			},
+			SuggestedDocumentType: "Invoice",
+		},
+	}
+
+	env.setMockResponse("/api/tags/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"results": [{"id": 1, "name": "tag1"}], "next": null}`))
+	})
+
+	env.setMockResponse("/api/documents/7/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PATCH", r.Method)
+
+		var updatedFields map[string]interface{}
+		err := json.NewDecoder(r.Body).Decode(&updatedFields)
+		require.NoError(t, err)
+
+		assert.Equal(t, float64(1), updatedFields["document_type"])
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ctx := context.Background()
+	err := env.client.UpdateDocuments(ctx, documents, env.db, false)
+	require.NoError(t, err)
+
+	var record ModificationHistory
+	err = env.db.Where("document_id = ? AND mod_field = ?", 7, "document_type").First(&record).Error
+	require.NoError(t, err)
+	assert.Equal(t, "Contract", record.PreviousValue)
+	assert.Equal(t, "Invoice", record.NewValue)
+}
+
+// TestUpdateDocuments_StoragePath tests that suggested storage paths are resolved and recorded for undo
+func TestUpdateDocuments_StoragePath(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.teardown()
+
+	documents := []DocumentSuggestion{
+		{
+			ID: 8,
+			OriginalDocument: Document{
+				ID:    8,
+				Title: "Title",
+				Tags:  []string{"tag1"},
+			},
+			SuggestedStoragePath: "Home",
+		},
+	}
+
+	env.setMockResponse("/api/tags/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"results": [{"id": 1, "name": "tag1"}], "next": null}`))
+	})
+
+	env.setMockResponse("/api/documents/8/", func(w http.ResponseWriter, r *http.Request) {
+		var updatedFields map[string]interface{}
+		err := json.NewDecoder(r.Body).Decode(&updatedFields)
+		require.NoError(t, err)
+
+		assert.Equal(t, float64(2), updatedFields["storage_path"])
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ctx := context.Background()
+	err := env.client.UpdateDocuments(ctx, documents, env.db, false)
+	require.NoError(t, err)
+
+	var record ModificationHistory
+	err = env.db.Where("document_id = ? AND mod_field = ?", 8, "storage_path").First(&record).Error
+	require.NoError(t, err)
+	assert.Equal(t, "", record.PreviousValue)
+	assert.Equal(t, "Home", record.NewValue)
+}
+
+// TestUpdateDocuments_CreatedDate tests that created dates edited in the web UI are validated before they are sent
+func TestUpdateDocuments_CreatedDate(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.teardown()
+
+	env.setMockResponse("/api/tags/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"results": [{"id": 1, "name": "tag1"}], "next": null}`))
+	})
+	updates := make(map[string]map[string]interface{})
+	for _, path := range []string{"/api/documents/31/", "/api/documents/32/", "/api/documents/33/"} {
+		env.setMockResponse(path, func(w http.ResponseWriter, r *http.Request) {
+			var updatedFields map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&updatedFields))
+			updates[r.URL.Path] = updatedFields
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+
+	document := func(id int, createdDate string) DocumentSuggestion {
+		return DocumentSuggestion{
+			ID:                   id,
+			OriginalDocument:     Document{ID: id, Title: "Title", Tags: []string{"tag1"}, CreatedDate: "2020-01-01"},
+			SuggestedCreatedDate: createdDate,
+		}
+	}
+	documents := []DocumentSuggestion{
+		document(31, " 2024-03-01 "),
+		document(32, "01.03.2024"),
+		document(33, time.Now().AddDate(1, 0, 0).Format("2006-01-02")),
+	}
+	require.NoError(t, env.client.UpdateDocuments(context.Background(), documents, env.db, false))
+
+	assert.Equal(t, "2024-03-01", updates["/api/documents/31/"]["created_date"])
+	assert.NotContains(t, updates["/api/documents/32/"], "created_date")
+	assert.NotContains(t, updates["/api/documents/33/"], "created_date")
+
+	var count int64
+	require.NoError(t, env.db.Model(&ModificationHistory{}).Where("document_id IN ? AND mod_field = ?", []int{32, 33}, "created_date").Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+// TestUpdateDocuments_CustomFields tests that custom field suggestions are merged and each change is recorded
+func TestUpdateDocuments_CustomFields(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.teardown()
+
+	documents := []DocumentSuggestion{
+		{
+			ID: 9,
+			OriginalDocument: Document{
+				ID:    9,
+				Title: "Title",
+				Tags:  []string{"tag1"},
+				CustomFields: []CustomFieldValue{
+					{Field: 1, Value: "EUR10.00"},
+					{Field: 3, Value: "INV-1"},
+				},
+			},
+			SuggestedCustomFields: []CustomFieldSuggestion{
+				{ID: 1, Name: "Invoice Total", DataType: "monetary", Value: "EUR12.00"},
+				{ID: 2, Name: "Due Date", DataType: "date", Value: "2024-03-01"},
+				{ID: 3, Name: "Invoice Number", DataType: "string", Value: "INV-1"},
+			},
+		},
+	}
+
+	env.setMockResponse("/api/tags/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"results": [{"id": 1, "name": "tag1"}], "next": null}`))
+	})
+
+	env.setMockResponse("/api/documents/9/", func(w http.ResponseWriter, r *http.Request) {
+		var updatedFields map[string]interface{}
+		err := json.NewDecoder(r.Body).Decode(&updatedFields)
+		require.NoError(t, err)
+
+		expectedCustomFields := []interface{}{
+			map[string]interface{}{"field": float64(1), "value": "EUR12.00"},
+			map[string]interface{}{"field": float64(3), "value": "INV-1"},
+			map[string]interface{}{"field": float64(2), "value": "2024-03-01"},
+		}
+		assert.Equal(t, expectedCustomFields, updatedFields["custom_fields"])
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ctx := context.Background()
+	err := env.client.UpdateDocuments(ctx, documents, env.db, false)
+	require.NoError(t, err)
+
+	// Unchanged fields are not recorded
+	var records []ModificationHistory
+	err = env.db.Where("document_id = ? AND mod_field LIKE ?", 9, customFieldModPrefix+"%").Order("id").Find(&records).Error
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "custom_field:Invoice Total", records[0].ModField)
+	assert.Equal(t, "EUR10.00", records[0].PreviousValue)
+	assert.Equal(t, "EUR12.00", records[0].NewValue)
+	assert.Equal(t, "custom_field:Due Date", records[1].ModField)
+	assert.Equal(t, "", records[1].PreviousValue)
+	assert.Equal(t, "2024-03-01", records[1].NewValue)
+}
+
 // TestUrlEncode tests the urlEncode function
 func TestUrlEncode(t *testing.T) {
 	input := "tag:tag1 tag:tag2"
@@ -377,15 +619,16 @@ func TestDownloadDocumentAsImages(t *testing.T) {
 	})
 
 	ctx := context.Background()
-	imagePaths, err := env.client.DownloadDocumentAsImages(ctx, document.ID, 0)
+	imagePaths, err := env.client.DownloadDocumentAsImages(ctx, document.ID, allPages)
 	require.NoError(t, err)
 
 	// Verify that exatly one page was extracted
 	assert.Len(t, imagePaths, 1)
 	// The path shall end with paperless-gpt/document-123/page000.jpg
-	assert.Contains(t, imagePaths[0], "paperless-gpt/document-123/page000.jpg")
+	assert.Contains(t, imagePaths[0].Path, "paperless-gpt/document-123/page000.jpg")
+	assert.Equal(t, 1, imagePaths[0].Page)
 	for _, imagePath := range imagePaths {
-		_, err := os.Stat(imagePath)
+		_, err := os.Stat(imagePath.Path)
 		assert.NoError(t, err)
 	}
 }
@@ -414,15 +657,15 @@ func TestDownloadDocumentAsImages_ManyPages(t *testing.T) {
 	env.client.CacheFolder = "tests/tmp"
 	// Clean the cache folder
 	os.RemoveAll(env.client.CacheFolder)
-	imagePaths, err := env.client.DownloadDocumentAsImages(ctx, document.ID, 50)
+	imagePaths, err := env.client.DownloadDocumentAsImages(ctx, document.ID, firstPages(50))
 	require.NoError(t, err)
 
 	// Verify that exatly 50 pages were extracted - the original doc contains 52 pages
 	assert.Len(t, imagePaths, 50)
 	// The path shall end with tests/tmp/document-321/page000.jpg
 	for _, imagePath := range imagePaths {
-		_, err := os.Stat(imagePath)
+		_, err := os.Stat(imagePath.Path)
 		assert.NoError(t, err)
-		assert.Contains(t, imagePath, "tests/tmp/document-321/page")
+		assert.Contains(t, imagePath.Path, "tests/tmp/document-321/page")
 	}
 }
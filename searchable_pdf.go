@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"slices"
+	"strings"
+)
+
+// searchablePDFPage is a page image with the OCR text of the page
+type searchablePDFPage struct {
+	JPEG []byte
+	Text string
+}
+
+// buildSearchablePDF creates a PDF with one page per image. The OCR text of each page is laid
+// over the image as invisible text, so that it can be searched and selected in a PDF viewer.
+//
+// The OCR text has no coordinates, so the lines are spread evenly over the height of the page
+// and stretched to its width. This is good enough for search and copy, not for exact selection.
+func buildSearchablePDF(pages []searchablePDFPage, dpi float64) ([]byte, error) {
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no pages to write")
+	}
+
+	w := &pdfWriter{}
+	w.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 to 3 are the catalog, the page tree and the font, followed by three objects per page
+	const catalogID, pagesID, fontID = 1, 2, 3
+	pageIDs := make([]int, len(pages))
+	for i := range pages {
+		pageIDs[i] = 4 + 3*i
+	}
+
+	w.object(catalogID, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesID))
+
+	kids := make([]string, len(pageIDs))
+	for i, id := range pageIDs {
+		kids[i] = fmt.Sprintf("%d 0 R", id)
+	}
+	w.object(pagesID, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+
+	// Invisible text only needs a font for the glyph widths, one of the standard fonts is enough
+	w.object(fontID, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		config, err := jpeg.DecodeConfig(bytes.NewReader(page.JPEG))
+		if err != nil {
+			return nil, fmt.Errorf("error decoding image of page %d: %w", i+1, err)
+		}
+		colorSpace, err := pdfColorSpace(config)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", i+1, err)
+		}
+
+		width := float64(config.Width) * 72 / dpi
+		height := float64(config.Height) * 72 / dpi
+		pageID, imageID, contentID := pageIDs[i], pageIDs[i]+1, pageIDs[i]+2
+
+		w.object(pageID, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 %d 0 R >> /XObject << /Im1 %d 0 R >> >> /Contents %d 0 R >>",
+			pagesID, width, height, fontID, imageID, contentID))
+		w.stream(imageID, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode",
+			config.Width, config.Height, colorSpace), page.JPEG)
+
+		content, err := pdfPageContent(page.Text, width, height)
+		if err != nil {
+			return nil, fmt.Errorf("error writing text of page %d: %w", i+1, err)
+		}
+		w.stream(contentID, "/Filter /FlateDecode", content)
+	}
+
+	w.finish(catalogID)
+	return w.buf.Bytes(), nil
+}
+
+// pdfColorSpace returns the PDF color space of a JPEG image
+func pdfColorSpace(config image.Config) (string, error) {
+	switch config.ColorModel {
+	case color.GrayModel:
+		return "/DeviceGray", nil
+	case color.YCbCrModel, color.RGBAModel:
+		return "/DeviceRGB", nil
+	default:
+		return "", fmt.Errorf("unsupported JPEG color model %T", config.ColorModel)
+	}
+}
+
+// pdfPageContent returns the compressed content stream that draws the page image and the invisible text
+func pdfPageContent(text string, width, height float64) ([]byte, error) {
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "q %.2f 0 0 %.2f 0 0 cm /Im1 Do Q\n", width, height)
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) > 0 {
+		lineHeight := height / float64(len(lines))
+		fontSize := min(lineHeight*0.8, 12)
+		margin := width * 0.05
+
+		// Render mode 3 draws neither the fill nor the stroke of the glyphs
+		content.WriteString("BT 3 Tr\n")
+		fmt.Fprintf(&content, "/F1 %.2f Tf\n", fontSize)
+		for i, line := range lines {
+			encoded := encodeWinAnsi(line)
+			// Helvetica glyphs are about half as wide as the font size on average
+			scaling := 100 * (width - 2*margin) / (float64(len(encoded)) * fontSize * 0.5)
+			scaling = min(max(scaling, 10), 200)
+			y := height - float64(i+1)*lineHeight + (lineHeight-fontSize)/2
+			fmt.Fprintf(&content, "%.2f Tz 1 0 0 1 %.2f %.2f Tm (%s) Tj\n", scaling, margin, y, escapePDFString(encoded))
+		}
+		content.WriteString("ET\n")
+	}
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(content.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// winAnsiSpecial maps the characters of WinAnsiEncoding between 0x80 and 0x9f
+var winAnsiSpecial = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b,
+	'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// encodeWinAnsi converts text to WinAnsiEncoding, the encoding of the standard PDF fonts.
+// Characters that can't be encoded are replaced with a question mark.
+func encodeWinAnsi(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '\t':
+			encoded = append(encoded, ' ')
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			encoded = append(encoded, byte(r))
+		case winAnsiSpecial[r] != 0:
+			encoded = append(encoded, winAnsiSpecial[r])
+		case r < 0x20:
+			// Drop control characters
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+// escapePDFString escapes the characters with a special meaning in PDF literal strings
+func escapePDFString(s []byte) []byte {
+	escaped := make([]byte, 0, len(s))
+	for _, b := range s {
+		if b == '\\' || b == '(' || b == ')' {
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, b)
+	}
+	return escaped
+}
+
+// pdfWriter writes the objects of a PDF file and keeps track of their offsets for the cross-reference table
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets map[int]int
+}
+
+func (w *pdfWriter) object(id int, dictionary string) {
+	w.begin(id)
+	fmt.Fprintf(&w.buf, "%s\nendobj\n", dictionary)
+}
+
+func (w *pdfWriter) stream(id int, dictionary string, data []byte) {
+	w.begin(id)
+	fmt.Fprintf(&w.buf, "<< %s /Length %d >>\nstream\n", dictionary, len(data))
+	w.buf.Write(data)
+	w.buf.WriteString("\nendstream\nendobj\n")
+}
+
+func (w *pdfWriter) begin(id int) {
+	if w.offsets == nil {
+		w.offsets = make(map[int]int)
+	}
+	w.offsets[id] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n", id)
+}
+
+// finish writes the cross-reference table and the trailer
+func (w *pdfWriter) finish(rootID int) {
+	ids := make([]int, 0, len(w.offsets))
+	for id := range w.offsets {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	size := ids[len(ids)-1] + 1
+
+	xrefOffset := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", size)
+	for id := 1; id < size; id++ {
+		if offset, ok := w.offsets[id]; ok {
+			fmt.Fprintf(&w.buf, "%010d 00000 n \n", offset)
+		} else {
+			w.buf.WriteString("0000000000 65535 f \n")
+		}
+	}
+	fmt.Fprintf(&w.buf, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, rootID, xrefOffset)
+}
+
+// createSearchablePDF builds a searchable PDF from the page images and OCR texts of a document and uploads it
+func (app *App) createSearchablePDF(ctx context.Context, documentID int, images []PageImage, pageTexts []string) error {
+	pages := make([]searchablePDFPage, len(images))
+	for i, pageImage := range images {
+		imageContent, err := os.ReadFile(pageImage.Path)
+		if err != nil {
+			return fmt.Errorf("error reading image file of page %d: %w", pageImage.Page, err)
+		}
+		pages[i] = searchablePDFPage{JPEG: imageContent, Text: pageTexts[i]}
+	}
+
+	// The images were rendered at renderDPI, which gives the pages the size of the original
+	pdf, err := buildSearchablePDF(pages, renderDPI())
+	if err != nil {
+		return err
+	}
+	return app.uploadSearchablePDF(ctx, documentID, pdf)
+}
+
+// createSearchablePDFForJob renders the pages of an accepted OCR job again and uploads a searchable PDF
+// with the accepted content. A corrected content can't be matched to the pages, its lines are spread
+// evenly over them instead.
+func (app *App) createSearchablePDFForJob(ctx context.Context, job *Job, content string) error {
+	pages, err := job.pageSelection()
+	if err != nil {
+		return err
+	}
+	images, err := app.Client.DownloadDocumentAsImages(ctx, job.DocumentID, pages)
+	defer func() {
+		for _, pageImage := range images {
+			os.Remove(pageImage.Path)
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("error downloading document images for document %d: %w", job.DocumentID, err)
+	}
+
+	pageTexts := job.PageTexts
+	if content != job.Result || len(pageTexts) != len(images) {
+		pageTexts = spreadLines(content, len(images))
+	}
+	return app.createSearchablePDF(ctx, job.DocumentID, images, pageTexts)
+}
+
+// spreadLines splits a text into n parts with about the same number of lines
+func spreadLines(text string, n int) []string {
+	lines := strings.Split(text, "\n")
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = strings.Join(lines[i*len(lines)/n:(i+1)*len(lines)/n], "\n")
+	}
+	return parts
+}
+
+// uploadSearchablePDF uploads a searchable PDF of a document to paperless-ngx as a new document
+// with the metadata of the original, and links it from the original with a note.
+// paperless-ngx has no API to replace the file of a document, so the original is left as it is.
+func (app *App) uploadSearchablePDF(ctx context.Context, documentID int, pdf []byte) error {
+	docLogger := documentLogger(documentID)
+
+	document, err := app.Client.GetDocument(ctx, documentID)
+	if err != nil {
+		return err
+	}
+
+	// Don't copy the tags of paperless-gpt, the new document must not be processed again
+	var tags []string
+	for _, tag := range document.Tags {
+		if !slices.Contains([]string{autoTag, autoOcrTag, manualTag, manualOcrTag, autoFailedTag}, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	taskID, err := app.Client.UploadDocument(ctx, fmt.Sprintf("document-%d-ocr.pdf", documentID), pdf, DocumentUpload{
+		Title:         document.Title,
+		Created:       document.CreatedDate,
+		Correspondent: document.Correspondent,
+		DocumentType:  document.DocumentType,
+		StoragePath:   document.StoragePath,
+		Tags:          tags,
+	})
+	if err != nil {
+		return fmt.Errorf("error uploading searchable PDF: %w", err)
+	}
+	docLogger.WithField("task_id", taskID).Info("Uploaded searchable PDF")
+
+	note := fmt.Sprintf("paperless-gpt uploaded a searchable PDF of this document with the OCR text as a new document titled %q (consumption task %s).", document.Title, taskID)
+	if err := app.Client.AddDocumentNote(ctx, documentID, note); err != nil {
+		docLogger.Errorf("Error adding note about the searchable PDF: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gen2brain/go-fitz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testJPEG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, nil))
+	return buf.Bytes()
+}
+
+func TestBuildSearchablePDF(t *testing.T) {
+	pages := []searchablePDFPage{
+		{JPEG: testJPEG(t, image.NewGray(image.Rect(0, 0, 600, 900))), Text: "# Invoice ACME\n\nTotal (net): 100 EUR"},
+		{JPEG: testJPEG(t, image.NewRGBA(image.Rect(0, 0, 900, 600))), Text: "Größe: 5 € – naïve\tcafé"},
+		{JPEG: testJPEG(t, image.NewGray(image.Rect(0, 0, 300, 300)))},
+	}
+
+	pdf, err := buildSearchablePDF(pages, 150)
+	require.NoError(t, err)
+
+	// Read the PDF back with MuPDF, which also extracts invisible text
+	pdfPath := filepath.Join(t.TempDir(), "searchable.pdf")
+	require.NoError(t, os.WriteFile(pdfPath, pdf, 0644))
+	doc, err := fitz.New(pdfPath)
+	require.NoError(t, err)
+	defer doc.Close()
+	require.Equal(t, 3, doc.NumPage())
+
+	// Pages have the size of the images at the given resolution
+	bounds, err := doc.Bound(0)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 288, 432), bounds)
+
+	text, err := doc.Text(0)
+	require.NoError(t, err)
+	assert.Contains(t, text, "# Invoice ACME")
+	assert.Contains(t, text, "Total (net): 100 EUR")
+
+	text, err = doc.Text(1)
+	require.NoError(t, err)
+	assert.Contains(t, text, "Größe: 5 € – naïve café")
+
+	_, err = buildSearchablePDF(nil, 150)
+	assert.Error(t, err)
+}
+
+func TestEncodeWinAnsi(t *testing.T) {
+	assert.Equal(t, []byte("Stra\xdfe \x80 5 \x93ok\x94 ?"), encodeWinAnsi("Straße € 5 “ok” 漢\x07"))
+	assert.Equal(t, []byte(`a\(b\)\\`), escapePDFString([]byte(`a(b)\`)))
+}
+
+func TestUploadSearchablePDF(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.teardown()
+
+	originalAutoOcrTag := autoOcrTag
+	defer func() { autoOcrTag = originalAutoOcrTag }()
+	autoOcrTag = "paperless-gpt-ocr-auto"
+
+	env.setMockResponse("/api/tags/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"results": [{"id": 1, "name": "paperless-gpt-ocr-auto"}, {"id": 2, "name": "finance"}, {"id": 3, "name": "2024"}]}`))
+	})
+	env.setMockResponse("/api/documents/7/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id": 7, "title": "ACME Invoice", "tags": [1, 2, 3], "correspondent": 2, "document_type": 1, "created_date": "2024-03-01"}`))
+	})
+
+	var upload *http.Request
+	var uploaded []byte
+	env.setMockResponse("/api/documents/post_document/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		file, header, err := r.FormFile("document")
+		require.NoError(t, err)
+		assert.Equal(t, "document-7-ocr.pdf", header.Filename)
+		uploaded = make([]byte, header.Size)
+		_, err = file.Read(uploaded)
+		require.NoError(t, err)
+		upload = r
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`"4b8f1d2e-task"`))
+	})
+	var notes []string
+	env.setMockResponse("/api/documents/7/notes/", func(w http.ResponseWriter, r *http.Request) {
+		var note map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&note))
+		notes = append(notes, note["note"])
+		w.WriteHeader(http.StatusOK)
+	})
+
+	app := &App{Client: env.client}
+	require.NoError(t, app.uploadSearchablePDF(context.Background(), 7, []byte("%PDF-1.4")))
+
+	require.NotNil(t, upload)
+	assert.Equal(t, []byte("%PDF-1.4"), uploaded)
+	assert.Equal(t, "ACME Invoice", upload.FormValue("title"))
+	assert.Equal(t, "2024-03-01", upload.FormValue("created"))
+	assert.Equal(t, "2", upload.FormValue("correspondent"))
+	assert.Equal(t, "1", upload.FormValue("document_type"))
+	assert.Empty(t, upload.FormValue("storage_path"))
+	// The tags of paperless-gpt are not copied
+	assert.ElementsMatch(t, []string{"2", "3"}, upload.MultipartForm.Value["tags"])
+
+	require.Len(t, notes, 1)
+	assert.Contains(t, notes[0], "4b8f1d2e-task")
+}
+
+func TestSpreadLines(t *testing.T) {
+	assert.Equal(t, []string{"a\nb", "c\nd\ne"}, spreadLines("a\nb\nc\nd\ne", 2))
+	assert.Equal(t, []string{"", "a"}, spreadLines("a", 2))
+	assert.Equal(t, []string{"a\nb"}, spreadLines("a\nb", 1))
+}
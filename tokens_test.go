@@ -2,12 +2,15 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 	"text/template"
 
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/tmc/langchaingo/textsplitter"
@@ -300,3 +303,80 @@ Content: {{.Content}}
 		})
 	}
 }
+
+func TestSplitContentByTokens(t *testing.T) {
+	originalLimit := tokenLimit
+	defer func() { tokenLimit = originalLimit }()
+	tokenLimit = 100
+
+	var words []string
+	for i := 0; i < 200; i++ {
+		words = append(words, fmt.Sprintf("word%d", i))
+	}
+	content := strings.Join(words, " ")
+
+	chunks, err := splitContentByTokens(content, 20)
+	require.NoError(t, err)
+	assert.Greater(t, len(chunks), 1, "Content should be split into several chunks")
+
+	for _, chunk := range chunks {
+		tokens, err := getTokenCount(chunk)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, tokens, 20, "Chunk should be within the chunk size")
+	}
+
+	// Chunks are cut at spaces, so no word is lost or split
+	assert.Equal(t, words, strings.Fields(strings.Join(chunks, " ")))
+
+	_, err = splitContentByTokens(content, 0)
+	assert.Error(t, err)
+}
+
+func TestCondenseContent(t *testing.T) {
+	originalLimit := tokenLimit
+	defer func() { tokenLimit = originalLimit }()
+
+	var err error
+	summaryTemplate, err = template.New("summary").Parse("Condense in {{.Language}}: {{.Content}}")
+	require.NoError(t, err)
+
+	testLogger := logrus.WithField("test", "test")
+	content := strings.Repeat("Invoice line with a long description and an amount of 12.50 EUR.\n", 40)
+
+	t.Run("disabled without token limit", func(t *testing.T) {
+		tokenLimit = 0
+		mockLLM := &mockLLM{response: "summary"}
+		app := &App{LLM: mockLLM}
+
+		result, err := app.condenseContent(context.Background(), content, 50, testLogger)
+		require.NoError(t, err)
+		assert.Equal(t, content, result)
+		assert.Equal(t, 0, mockLLM.calls)
+	})
+
+	t.Run("condenses every chunk", func(t *testing.T) {
+		tokenLimit = 100
+		mockLLM := &mockLLM{response: "<think>short</think>summary"}
+		app := &App{LLM: mockLLM}
+
+		result, err := app.condenseContent(context.Background(), content, 50, testLogger)
+		require.NoError(t, err)
+		assert.Greater(t, mockLLM.calls, 1, "Each chunk should be condensed separately")
+		assert.Equal(t, strings.Repeat("summary\n\n", mockLLM.calls-1)+"summary", result)
+
+		tokens, err := getTokenCount(result)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, tokens, 50)
+	})
+
+	t.Run("short content is kept", func(t *testing.T) {
+		tokenLimit = 100
+		mockLLM := &mockLLM{response: "summary"}
+		app := &App{LLM: mockLLM}
+
+		result, err := app.condenseContent(context.Background(), "short content", 50, testLogger)
+		require.NoError(t, err)
+		assert.Equal(t, "short content", result)
+		assert.Equal(t, 0, mockLLM.calls)
+	})
+}
@@ -13,15 +13,16 @@ type GetDocumentsApiResponse struct {
 // GetDocumentApiResponseResult is a part of the response payload for /documents endpoint.
 // But we are only interested in a subset of the fields.
 type GetDocumentApiResponseResult struct {
-	ID            int `json:"id"`
-	Correspondent int `json:"correspondent"`
-	// DocumentType        interface{}   `json:"document_type"`
-	// StoragePath         interface{}   `json:"storage_path"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
-	Tags    []int  `json:"tags"`
+	ID            int                `json:"id"`
+	Correspondent int                `json:"correspondent"`
+	DocumentType  int                `json:"document_type"`
+	StoragePath   int                `json:"storage_path"`
+	Title         string             `json:"title"`
+	Content       string             `json:"content"`
+	Tags          []int              `json:"tags"`
+	CustomFields  []CustomFieldValue `json:"custom_fields"`
+	CreatedDate   string             `json:"created_date"`
 	// Created             time.Time     `json:"created"`
-	// CreatedDate         string        `json:"created_date"`
 	// Modified            time.Time     `json:"modified"`
 	// Added               time.Time     `json:"added"`
 	// ArchiveSerialNumber interface{}   `json:"archive_serial_number"`
@@ -41,15 +42,16 @@ type GetDocumentApiResponseResult struct {
 // GetDocumentApiResponse is the response payload for /documents/{id} endpoint.
 // But we are only interested in a subset of the fields.
 type GetDocumentApiResponse struct {
-	ID            int `json:"id"`
-	Correspondent int `json:"correspondent"`
-	// DocumentType        interface{}   `json:"document_type"`
-	// StoragePath         interface{}   `json:"storage_path"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
-	Tags    []int  `json:"tags"`
+	ID            int                `json:"id"`
+	Correspondent int                `json:"correspondent"`
+	DocumentType  int                `json:"document_type"`
+	StoragePath   int                `json:"storage_path"`
+	Title         string             `json:"title"`
+	Content       string             `json:"content"`
+	Tags          []int              `json:"tags"`
+	CustomFields  []CustomFieldValue `json:"custom_fields"`
+	CreatedDate   string             `json:"created_date"`
 	// Created             time.Time     `json:"created"`
-	// CreatedDate         string        `json:"created_date"`
 	// Modified            time.Time     `json:"modified"`
 	// Added               time.Time     `json:"added"`
 	// ArchiveSerialNumber interface{}   `json:"archive_serial_number"`
@@ -63,11 +65,38 @@ type GetDocumentApiResponse struct {
 // Document is a stripped down version of the document object from paperless-ngx.
 // Response payload for /documents endpoint and part of request payload for /generate-suggestions endpoint
 type Document struct {
-	ID            int      `json:"id"`
-	Title         string   `json:"title"`
-	Content       string   `json:"content"`
-	Tags          []string `json:"tags"`
-	Correspondent string   `json:"correspondent"`
+	ID            int                `json:"id"`
+	Title         string             `json:"title"`
+	Content       string             `json:"content"`
+	Tags          []string           `json:"tags"`
+	Correspondent string             `json:"correspondent"`
+	DocumentType  string             `json:"document_type"`
+	StoragePath   string             `json:"storage_path"`
+	CustomFields  []CustomFieldValue `json:"custom_fields,omitempty"`
+	CreatedDate   string             `json:"created_date,omitempty"`
+}
+
+// DocumentUpload is the metadata of a document uploaded with UploadDocument.
+// Correspondent, document type, storage path and tags are given by name and must exist.
+type DocumentUpload struct {
+	Title         string
+	Created       string // Date in YYYY-MM-DD format, empty to let paperless-ngx detect it
+	Correspondent string
+	DocumentType  string
+	StoragePath   string
+	Tags          []string
+}
+
+// DocumentNote is a note on a document, returned by GetDocumentNotes
+type DocumentNote struct {
+	ID   int    `json:"id"`
+	Note string `json:"note"`
+}
+
+// PageImage is the rendered image of a page, returned by DownloadDocumentAsImages
+type PageImage struct {
+	Page int    // Page number, counted from 1
+	Path string // Path of the JPEG file in the cache folder
 }
 
 // GenerateSuggestionsRequest is the request payload for generating suggestions for /generate-suggestions endpoint
@@ -76,17 +105,53 @@ type GenerateSuggestionsRequest struct {
 	GenerateTitles         bool       `json:"generate_titles,omitempty"`
 	GenerateTags           bool       `json:"generate_tags,omitempty"`
 	GenerateCorrespondents bool       `json:"generate_correspondents,omitempty"`
+	GenerateDocumentTypes  bool       `json:"generate_document_types,omitempty"`
+	GenerateStoragePaths   bool       `json:"generate_storage_paths,omitempty"`
+	GenerateCustomFields   bool       `json:"generate_custom_fields,omitempty"`
+	GenerateCreatedDate    bool       `json:"generate_created_date,omitempty"`
 }
 
 // DocumentSuggestion is the response payload for /generate-suggestions endpoint and the request payload for /update-documents endpoint (as an array)
 type DocumentSuggestion struct {
-	ID                     int      `json:"id"`
-	OriginalDocument       Document `json:"original_document"`
-	SuggestedTitle         string   `json:"suggested_title,omitempty"`
-	SuggestedTags          []string `json:"suggested_tags,omitempty"`
-	SuggestedContent       string   `json:"suggested_content,omitempty"`
-	SuggestedCorrespondent string   `json:"suggested_correspondent,omitempty"`
-	RemoveTags             []string `json:"remove_tags,omitempty"`
+	ID                     int                     `json:"id"`
+	OriginalDocument       Document                `json:"original_document"`
+	SuggestedTitle         string                  `json:"suggested_title,omitempty"`
+	SuggestedTags          []string                `json:"suggested_tags,omitempty"`
+	SuggestedContent       string                  `json:"suggested_content,omitempty"`
+	SuggestedCorrespondent string                  `json:"suggested_correspondent,omitempty"`
+	SuggestedDocumentType  string                  `json:"suggested_document_type,omitempty"`
+	SuggestedStoragePath   string                  `json:"suggested_storage_path,omitempty"`
+	SuggestedCustomFields  []CustomFieldSuggestion `json:"suggested_custom_fields,omitempty"`
+	SuggestedCreatedDate   string                  `json:"suggested_created_date,omitempty"`
+	RemoveTags             []string                `json:"remove_tags,omitempty"`
+}
+
+// StoragePath is a stripped down version of the storage path object from paperless-ngx
+type StoragePath struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// CustomField is a custom field definition from paperless-ngx
+type CustomField struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	DataType string `json:"data_type"`
+}
+
+// CustomFieldValue is a custom field instance attached to a paperless-ngx document
+type CustomFieldValue struct {
+	Field int         `json:"field"`
+	Value interface{} `json:"value"`
+}
+
+// CustomFieldSuggestion is a validated custom field value extracted by the LLM
+type CustomFieldSuggestion struct {
+	ID       int         `json:"id"`
+	Name     string      `json:"name"`
+	DataType string      `json:"data_type"`
+	Value    interface{} `json:"value"`
 }
 
 type Correspondent struct {
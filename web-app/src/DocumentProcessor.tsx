@@ -12,6 +12,16 @@ export interface Document {
   content: string;
   tags: string[];
   correspondent: string;
+  document_type: string;
+  storage_path: string;
+  created_date?: string;
+}
+
+export interface CustomFieldSuggestion {
+  id: number;
+  name: string;
+  data_type: string;
+  value: string | number | boolean | null;
 }
 
 export interface GenerateSuggestionsRequest {
@@ -19,6 +29,10 @@ export interface GenerateSuggestionsRequest {
   generate_titles?: boolean;
   generate_tags?: boolean;
   generate_correspondents?: boolean;
+  generate_document_types?: boolean;
+  generate_storage_paths?: boolean;
+  generate_custom_fields?: boolean;
+  generate_created_date?: boolean;
 }
 
 export interface DocumentSuggestion {
@@ -28,6 +42,10 @@ export interface DocumentSuggestion {
   suggested_tags?: string[];
   suggested_content?: string;
   suggested_correspondent?: string;
+  suggested_document_type?: string;
+  suggested_storage_path?: string;
+  suggested_custom_fields?: CustomFieldSuggestion[];
+  suggested_created_date?: string;
 }
 
 export interface TagOption {
@@ -47,6 +65,10 @@ const DocumentProcessor: React.FC = () => {
   const [generateTitles, setGenerateTitles] = useState(true);
   const [generateTags, setGenerateTags] = useState(true);
   const [generateCorrespondents, setGenerateCorrespondents] = useState(true);
+  const [generateDocumentTypes, setGenerateDocumentTypes] = useState(true);
+  const [generateStoragePaths, setGenerateStoragePaths] = useState(false);
+  const [generateCustomFields, setGenerateCustomFields] = useState(false);
+  const [generateCreatedDate, setGenerateCreatedDate] = useState(false);
   const [error, setError] = useState<string | null>(null);
 
   // Custom hook to fetch initial data
@@ -86,6 +108,10 @@ const DocumentProcessor: React.FC = () => {
         generate_titles: generateTitles,
         generate_tags: generateTags,
         generate_correspondents: generateCorrespondents,
+        generate_document_types: generateDocumentTypes,
+        generate_storage_paths: generateStoragePaths,
+        generate_custom_fields: generateCustomFields,
+        generate_created_date: generateCreatedDate,
       };
 
       const { data } = await axios.post<DocumentSuggestion[]>(
@@ -159,6 +185,30 @@ const DocumentProcessor: React.FC = () => {
     );
   }
 
+  const handleDocumentTypeChange = (docId: number, documentType: string) => {
+    setSuggestions((prevSuggestions) =>
+      prevSuggestions.map((doc) =>
+        doc.id === docId ? { ...doc, suggested_document_type: documentType } : doc
+      )
+    );
+  };
+
+  const handleStoragePathChange = (docId: number, storagePath: string) => {
+    setSuggestions((prevSuggestions) =>
+      prevSuggestions.map((doc) =>
+        doc.id === docId ? { ...doc, suggested_storage_path: storagePath } : doc
+      )
+    );
+  };
+
+  const handleCreatedDateChange = (docId: number, createdDate: string) => {
+    setSuggestions((prevSuggestions) =>
+      prevSuggestions.map((doc) =>
+        doc.id === docId ? { ...doc, suggested_created_date: createdDate } : doc
+      )
+    );
+  };
+
   const resetSuggestions = () => {
     setSuggestions([]);
   };
@@ -230,6 +280,14 @@ const DocumentProcessor: React.FC = () => {
           setGenerateTags={setGenerateTags}
           generateCorrespondents={generateCorrespondents}
           setGenerateCorrespondents={setGenerateCorrespondents}
+          generateDocumentTypes={generateDocumentTypes}
+          setGenerateDocumentTypes={setGenerateDocumentTypes}
+          generateStoragePaths={generateStoragePaths}
+          setGenerateStoragePaths={setGenerateStoragePaths}
+          generateCustomFields={generateCustomFields}
+          setGenerateCustomFields={setGenerateCustomFields}
+          generateCreatedDate={generateCreatedDate}
+          setGenerateCreatedDate={setGenerateCreatedDate}
           onProcess={handleProcessDocuments}
           processing={processing}
           onReload={reloadDocuments}
@@ -242,6 +300,9 @@ const DocumentProcessor: React.FC = () => {
           onTagAddition={handleTagAddition}
           onTagDeletion={handleTagDeletion}
           onCorrespondentChange={handleCorrespondentChange}
+          onDocumentTypeChange={handleDocumentTypeChange}
+          onStoragePathChange={handleStoragePathChange}
+          onCreatedDateChange={handleCreatedDateChange}
           onBack={resetSuggestions}
           onUpdate={handleUpdateDocuments}
           updating={updating}
@@ -1,18 +1,69 @@
 import axios from 'axios';
 import React, { useCallback, useEffect, useState } from 'react';
 import { FaSpinner } from 'react-icons/fa';
-import { Document, DocumentSuggestion } from './DocumentProcessor';
+import { Document } from './DocumentProcessor';
+
+// A document with the manual OCR tag and its latest OCR job, as returned by /api/ocr/documents
+interface OCRDocument {
+  document: Document;
+  job: {
+    job_id: string;
+    status: string;
+    pages_done: number;
+    total_pages: number;
+  } | null;
+}
 
 const ExperimentalOCR: React.FC = () => {
-  const refreshInterval = 1000; // Refresh interval in milliseconds
+  const refreshInterval = 10000; // Fallback refresh interval in milliseconds, updates are pushed via /api/events
   const [documentId, setDocumentId] = useState(0);
+  const [pages, setPages] = useState(''); // Page selection like "1-3,last", empty for the configured pages
   const [jobId, setJobId] = useState('');
+  const [jobFinished, setJobFinished] = useState(false);
   const [ocrResult, setOcrResult] = useState('');
   const [status, setStatus] = useState('');
   const [error, setError] = useState<string | null>('');
   const [pagesDone, setPagesDone] = useState(0); // New state for pages done
+  const [totalPages, setTotalPages] = useState(0);
   const [saving, setSaving] = useState(false); // New state for saving
   const [documentDetails, setDocumentDetails] = useState<Document | null>(null); // New state for document details
+  const [ocrDocuments, setOcrDocuments] = useState<OCRDocument[]>([]);
+  const [ocrTag, setOcrTag] = useState('');
+
+  const fetchOcrDocuments = useCallback(async () => {
+    try {
+      const [documentsResponse, tagResponse] = await Promise.all([
+        axios.get<OCRDocument[]>('/api/ocr/documents'),
+        axios.get<{ ocr_tag: string }>('/api/filter-tag'),
+      ]);
+      setOcrDocuments(documentsResponse.data);
+      setOcrTag(tagResponse.data.ocr_tag);
+    } catch (err) {
+      console.error("Error fetching documents for OCR:", err);
+    }
+  }, []);
+
+  useEffect(() => {
+    fetchOcrDocuments();
+  }, [fetchOcrDocuments]);
+
+  // Select a document of the list, and show the result of its latest job if there is one
+  const selectDocument = (ocrDocument: OCRDocument) => {
+    setDocumentId(ocrDocument.document.id);
+    setDocumentDetails(ocrDocument.document);
+    setError('');
+    setOcrResult('');
+    setPagesDone(0);
+    setTotalPages(0);
+    setJobFinished(false);
+    if (ocrDocument.job) {
+      setJobId(ocrDocument.job.job_id);
+      setStatus('Loading OCR job...');
+    } else {
+      setJobId('');
+      setStatus('');
+    }
+  };
 
   const fetchDocumentDetails = useCallback(async () => {
     if (!documentId) return;
@@ -30,15 +81,17 @@ const ExperimentalOCR: React.FC = () => {
     setStatus('');
     setError('');
     setJobId('');
+    setJobFinished(false);
     setOcrResult('');
     setPagesDone(0); // Reset pages done
+    setTotalPages(0);
 
     try {
       setStatus('Fetching document details...');
       await fetchDocumentDetails(); // Fetch document details before submitting the job
 
       setStatus('Submitting OCR job...');
-      const response = await axios.post(`/api/documents/${documentId}/ocr`);
+      const response = await axios.post(`/api/documents/${documentId}/ocr`, pages.trim() ? { pages } : undefined);
       setJobId(response.data.job_id);
       setStatus('Job submitted. Processing...');
     } catch (err) {
@@ -54,16 +107,20 @@ const ExperimentalOCR: React.FC = () => {
       const response = await axios.get(`/api/jobs/ocr/${jobId}`);
       const jobStatus = response.data.status;
       setPagesDone(response.data.pages_done); // Update pages done
+      setTotalPages(response.data.total_pages);
       if (jobStatus === 'completed') {
         setOcrResult(response.data.result);
         setStatus('OCR completed successfully.');
+        setJobFinished(true);
       } else if (jobStatus === 'failed') {
         setError(response.data.error);
         setStatus('OCR failed.');
+        setJobFinished(true);
+      } else if (jobStatus === 'cancelled') {
+        setStatus('OCR job was cancelled.');
+        setJobFinished(true);
       } else {
         setStatus(`Job status: ${jobStatus}. This may take a few minutes.`);
-        // Automatically check again after a delay
-        setTimeout(checkJobStatus, refreshInterval);
       }
     } catch (err) {
       console.error(err);
@@ -71,37 +128,58 @@ const ExperimentalOCR: React.FC = () => {
     } 
   };
 
-  const handleSaveContent = async () => {
+  // Accept writes the (possibly edited) OCR result into the document, reject keeps the current content.
+  // Both remove the manual OCR tag.
+  const handleReview = async (accept: boolean) => {
     setSaving(true);
     setError(null);
     try {
-      if (!documentDetails) {
-        setError('Document details not fetched.');
-        throw new Error('Document details not fetched.');
+      if (accept) {
+        await axios.post(`/api/jobs/ocr/${jobId}/accept`, { content: ocrResult });
+        setStatus('OCR result accepted and saved.');
+      } else {
+        await axios.post(`/api/jobs/ocr/${jobId}/reject`);
+        setStatus('OCR result rejected, the content was not changed.');
       }
-      const requestPayload: DocumentSuggestion = {
-        id: documentId,
-        original_document: documentDetails, // Use fetched document details
-        suggested_content: ocrResult,
-      };
-
-      await axios.patch("/api/update-documents", [requestPayload]);
-      setStatus('Content saved successfully.');
+      setOcrResult('');
+      await fetchOcrDocuments();
     } catch (err) {
-      console.error("Error saving content:", err);
-      setError("Failed to save content.");
+      console.error("Error reviewing OCR result:", err);
+      setError(accept ? "Failed to save content." : "Failed to reject the OCR result.");
     } finally {
       setSaving(false);
     }
   };
 
-  // Start checking job status when jobId is set
+  // Update the statuses in the list once the job is done
   useEffect(() => {
-    if (jobId) {
-      checkJobStatus();
+    if (jobFinished) {
+      fetchOcrDocuments();
     }
+  }, [jobFinished, fetchOcrDocuments]);
+
+  // Check the job status when the server reports a change, and poll in case the event stream is unavailable
+  useEffect(() => {
+    if (!jobId || jobFinished) return;
+
+    checkJobStatus();
+    const events = new EventSource('/api/events?types=job,job_progress');
+    const onEvent = (e: MessageEvent) => {
+      const event = JSON.parse(e.data);
+      if (event.data.job_id === jobId) {
+        checkJobStatus();
+      }
+    };
+    events.addEventListener('job', onEvent);
+    events.addEventListener('job_progress', onEvent);
+    const interval = setInterval(checkJobStatus, refreshInterval);
+
+    return () => {
+      events.close();
+      clearInterval(interval);
+    };
     // eslint-disable-next-line react-hooks/exhaustive-deps
-  }, [jobId]);
+  }, [jobId, jobFinished]);
 
   return (
     <div className="max-w-3xl mx-auto p-6 bg-white dark:bg-gray-900 text-gray-800 dark:text-gray-200">
@@ -109,6 +187,28 @@ const ExperimentalOCR: React.FC = () => {
       <p className="mb-6 text-center text-yellow-600">
         This is an experimental feature. Results may vary, and processing may take some time.
       </p>
+      {ocrDocuments.length > 0 && (
+        <div className="bg-gray-100 dark:bg-gray-800 p-6 rounded-lg shadow-md mb-6">
+          <h2 className="text-xl font-bold mb-4">Documents tagged with {ocrTag}</h2>
+          <ul className="divide-y divide-gray-200 dark:divide-gray-700">
+            {ocrDocuments.map((ocrDocument) => (
+              <li key={ocrDocument.document.id}>
+                <button
+                  onClick={() => selectDocument(ocrDocument)}
+                  className={`w-full text-left py-2 px-2 rounded hover:bg-gray-200 dark:hover:bg-gray-700 ${
+                    ocrDocument.document.id === documentId ? 'font-semibold' : ''
+                  }`}
+                >
+                  #{ocrDocument.document.id} {ocrDocument.document.title}
+                  <span className="float-right text-sm text-gray-500 dark:text-gray-400">
+                    {ocrDocument.job ? `OCR ${ocrDocument.job.status}` : 'No OCR yet'}
+                  </span>
+                </button>
+              </li>
+            ))}
+          </ul>
+        </div>
+      )}
       <div className="bg-gray-100 dark:bg-gray-800 p-6 rounded-lg shadow-md">
         <div className="mb-4">
           <label htmlFor="documentId" className="block mb-2 font-semibold">
@@ -123,6 +223,19 @@ const ExperimentalOCR: React.FC = () => {
             placeholder="Enter the document ID"
           />
         </div>
+        <div className="mb-4">
+          <label htmlFor="pages" className="block mb-2 font-semibold">
+            Pages:
+          </label>
+          <input
+            type="text"
+            id="pages"
+            value={pages}
+            onChange={(e) => setPages(e.target.value)}
+            className="border border-gray-300 dark:border-gray-700 rounded w-full p-2 focus:outline-none focus:ring-2 focus:ring-blue-500"
+            placeholder="e.g. 1-3,last or odd, empty for the configured pages"
+          />
+        </div>
         <button
           onClick={submitOCRJob}
           className="w-full bg-blue-600 hover:bg-blue-700 text-white font-semibold py-2 px-4 rounded transition duration-200"
@@ -148,7 +261,7 @@ const ExperimentalOCR: React.FC = () => {
             {!status.includes('in_progress') && status}
             {pagesDone > 0 && (
               <div className="mt-2">
-                Pages processed: {pagesDone}
+                Pages processed: {pagesDone}{totalPages > 0 && ` of ${totalPages}`}
               </div>
             )}
           </div>
@@ -160,24 +273,46 @@ const ExperimentalOCR: React.FC = () => {
         )}
         {ocrResult && (
           <div className="mt-6">
-            <h2 className="text-2xl font-bold mb-4">OCR Result:</h2>
-            <div className="bg-gray-50 dark:bg-gray-900 p-4 rounded border border-gray-200 dark:border-gray-700 overflow-auto max-h-96">
-              <pre className="whitespace-pre-wrap">{ocrResult}</pre>
+            <h2 className="text-2xl font-bold mb-4">Review OCR Result:</h2>
+            <div className="grid grid-cols-1 md:grid-cols-2 gap-4">
+              <div>
+                <h3 className="font-semibold mb-2">Current content</h3>
+                <div className="bg-gray-50 dark:bg-gray-900 p-4 rounded border border-gray-200 dark:border-gray-700 overflow-auto h-96">
+                  <pre className="whitespace-pre-wrap">{documentDetails?.content || 'No content'}</pre>
+                </div>
+              </div>
+              <div>
+                <h3 className="font-semibold mb-2">OCR result</h3>
+                <textarea
+                  value={ocrResult}
+                  onChange={(e) => setOcrResult(e.target.value)}
+                  className="bg-gray-50 dark:bg-gray-900 p-4 rounded border border-gray-200 dark:border-gray-700 w-full h-96 font-mono text-sm"
+                />
+              </div>
+            </div>
+            <div className="flex gap-4 mt-4">
+              <button
+                onClick={() => handleReview(true)}
+                className="flex-1 bg-green-600 hover:bg-green-700 text-white font-semibold py-2 px-4 rounded transition duration-200"
+                disabled={saving}
+              >
+                {saving ? (
+                  <span className="flex items-center justify-center">
+                    <FaSpinner className="animate-spin mr-2" />
+                    Saving...
+                  </span>
+                ) : (
+                  'Accept'
+                )}
+              </button>
+              <button
+                onClick={() => handleReview(false)}
+                className="flex-1 bg-red-600 hover:bg-red-700 text-white font-semibold py-2 px-4 rounded transition duration-200"
+                disabled={saving}
+              >
+                Reject
+              </button>
             </div>
-            <button
-              onClick={handleSaveContent}
-              className="w-full bg-green-600 hover:bg-green-700 text-white font-semibold py-2 px-4 rounded transition duration-200 mt-4"
-              disabled={saving}
-            >
-              {saving ? (
-                <span className="flex items-center justify-center">
-                  <FaSpinner className="animate-spin mr-2" />
-                  Saving...
-                </span>
-              ) : (
-                'Save Content'
-              )}
-            </button>
           </div>
         )}
       </div>
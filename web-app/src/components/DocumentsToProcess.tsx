@@ -11,6 +11,14 @@ interface DocumentsToProcessProps {
   setGenerateTags: React.Dispatch<React.SetStateAction<boolean>>;
   generateCorrespondents: boolean;
   setGenerateCorrespondents: React.Dispatch<React.SetStateAction<boolean>>;
+  generateDocumentTypes: boolean;
+  setGenerateDocumentTypes: React.Dispatch<React.SetStateAction<boolean>>;
+  generateStoragePaths: boolean;
+  setGenerateStoragePaths: React.Dispatch<React.SetStateAction<boolean>>;
+  generateCustomFields: boolean;
+  setGenerateCustomFields: React.Dispatch<React.SetStateAction<boolean>>;
+  generateCreatedDate: boolean;
+  setGenerateCreatedDate: React.Dispatch<React.SetStateAction<boolean>>;
   onProcess: () => void;
   processing: boolean;
   onReload: () => void;
@@ -24,6 +32,14 @@ const DocumentsToProcess: React.FC<DocumentsToProcessProps> = ({
   setGenerateTags,
   generateCorrespondents,
   setGenerateCorrespondents,
+  generateDocumentTypes,
+  setGenerateDocumentTypes,
+  generateStoragePaths,
+  setGenerateStoragePaths,
+  generateCustomFields,
+  setGenerateCustomFields,
+  generateCreatedDate,
+  setGenerateCreatedDate,
   onProcess,
   processing,
   onReload,
@@ -77,6 +93,42 @@ const DocumentsToProcess: React.FC<DocumentsToProcessProps> = ({
         />
         <span className="text-gray-700 dark:text-gray-200">Generate Correspondents</span>
       </label>
+      <label className="flex items-center space-x-2">
+        <input
+          type="checkbox"
+          checked={generateDocumentTypes}
+          onChange={(e) => setGenerateDocumentTypes(e.target.checked)}
+          className="dark:bg-gray-700 dark:border-gray-600"
+        />
+        <span className="text-gray-700 dark:text-gray-200">Generate Document Types</span>
+      </label>
+      <label className="flex items-center space-x-2">
+        <input
+          type="checkbox"
+          checked={generateStoragePaths}
+          onChange={(e) => setGenerateStoragePaths(e.target.checked)}
+          className="dark:bg-gray-700 dark:border-gray-600"
+        />
+        <span className="text-gray-700 dark:text-gray-200">Generate Storage Paths</span>
+      </label>
+      <label className="flex items-center space-x-2">
+        <input
+          type="checkbox"
+          checked={generateCustomFields}
+          onChange={(e) => setGenerateCustomFields(e.target.checked)}
+          className="dark:bg-gray-700 dark:border-gray-600"
+        />
+        <span className="text-gray-700 dark:text-gray-200">Extract Custom Fields</span>
+      </label>
+      <label className="flex items-center space-x-2">
+        <input
+          type="checkbox"
+          checked={generateCreatedDate}
+          onChange={(e) => setGenerateCreatedDate(e.target.checked)}
+          className="dark:bg-gray-700 dark:border-gray-600"
+        />
+        <span className="text-gray-700 dark:text-gray-200">Suggest Created Date</span>
+      </label>
     </div>
 
     <div className="grid grid-cols-1 md:grid-cols-2 gap-4">
@@ -9,6 +9,9 @@ interface SuggestionCardProps {
   onTagAddition: (docId: number, tag: TagOption) => void;
   onTagDeletion: (docId: number, index: number) => void;
   onCorrespondentChange: (docId: number, correspondent: string) => void;
+  onDocumentTypeChange: (docId: number, documentType: string) => void;
+  onStoragePathChange: (docId: number, storagePath: string) => void;
+  onCreatedDateChange: (docId: number, createdDate: string) => void;
 }
 
 const SuggestionCard: React.FC<SuggestionCardProps> = ({
@@ -18,6 +21,9 @@ const SuggestionCard: React.FC<SuggestionCardProps> = ({
   onTagAddition,
   onTagDeletion,
   onCorrespondentChange,
+  onDocumentTypeChange,
+  onStoragePathChange,
+  onCreatedDateChange,
 }) => {
   const sortedAvailableTags = availableTags.sort((a, b) => a.name.localeCompare(b.name));
   const document = suggestion.original_document;
@@ -119,6 +125,55 @@ const SuggestionCard: React.FC<SuggestionCardProps> = ({
             placeholder="Correspondent"
           />
         </div>
+        <div className="mt-4">
+          <label className="block text-sm font-medium text-gray-700 dark:text-gray-300">
+            Suggested Document Type
+          </label>
+          <input
+            type="text"
+            value={suggestion.suggested_document_type || ""}
+            onChange={(e) => onDocumentTypeChange(suggestion.id, e.target.value)}
+            className="w-full border border-gray-300 dark:border-gray-600 rounded px-2 py-1 mt-2 focus:outline-none focus:ring-2 focus:ring-blue-500 dark:bg-gray-700 dark:text-gray-200"
+            placeholder="Document Type"
+          />
+        </div>
+        <div className="mt-4">
+          <label className="block text-sm font-medium text-gray-700 dark:text-gray-300">
+            Suggested Storage Path
+          </label>
+          <input
+            type="text"
+            value={suggestion.suggested_storage_path || ""}
+            onChange={(e) => onStoragePathChange(suggestion.id, e.target.value)}
+            className="w-full border border-gray-300 dark:border-gray-600 rounded px-2 py-1 mt-2 focus:outline-none focus:ring-2 focus:ring-blue-500 dark:bg-gray-700 dark:text-gray-200"
+            placeholder="Storage Path"
+          />
+        </div>
+        <div className="mt-4">
+          <label className="block text-sm font-medium text-gray-700 dark:text-gray-300">
+            Suggested Created Date
+          </label>
+          <input
+            type="date"
+            value={suggestion.suggested_created_date || ""}
+            onChange={(e) => onCreatedDateChange(suggestion.id, e.target.value)}
+            className="w-full border border-gray-300 dark:border-gray-600 rounded px-2 py-1 mt-2 focus:outline-none focus:ring-2 focus:ring-blue-500 dark:bg-gray-700 dark:text-gray-200"
+          />
+        </div>
+        {suggestion.suggested_custom_fields && suggestion.suggested_custom_fields.length > 0 && (
+          <div className="mt-4">
+            <label className="block text-sm font-medium text-gray-700 dark:text-gray-300">
+              Suggested Custom Fields
+            </label>
+            <ul className="mt-2 text-sm text-gray-700 dark:text-gray-200">
+              {suggestion.suggested_custom_fields.map((field) => (
+                <li key={field.id}>
+                  <span className="font-semibold">{field.name}:</span> {String(field.value)}
+                </li>
+              ))}
+            </ul>
+          </div>
+        )}
       </div>
     </div>
   );
@@ -9,6 +9,9 @@ interface SuggestionsReviewProps {
   onTagAddition: (docId: number, tag: TagOption) => void;
   onTagDeletion: (docId: number, index: number) => void;
   onCorrespondentChange: (docId: number, correspondent: string) => void;
+  onDocumentTypeChange: (docId: number, documentType: string) => void;
+  onStoragePathChange: (docId: number, storagePath: string) => void;
+  onCreatedDateChange: (docId: number, createdDate: string) => void;
   onBack: () => void;
   onUpdate: () => void;
   updating: boolean;
@@ -21,6 +24,9 @@ const SuggestionsReview: React.FC<SuggestionsReviewProps> = ({
   onTagAddition,
   onTagDeletion,
   onCorrespondentChange,
+  onDocumentTypeChange,
+  onStoragePathChange,
+  onCreatedDateChange,
   onBack,
   onUpdate,
   updating,
@@ -39,6 +45,9 @@ const SuggestionsReview: React.FC<SuggestionsReviewProps> = ({
           onTagAddition={onTagAddition}
           onTagDeletion={onTagDeletion}
           onCorrespondentChange={onCorrespondentChange}
+          onDocumentTypeChange={onDocumentTypeChange}
+          onStoragePathChange={onStoragePathChange}
+          onCreatedDateChange={onCreatedDateChange}
         />
       ))}
     </div>
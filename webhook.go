@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// documentQueue is a FIFO queue of document IDs that ignores documents which are already queued
+type documentQueue struct {
+	mu     sync.Mutex
+	ids    []int
+	queued map[int]bool
+	ready  chan struct{} // Signalled when a document is added
+}
+
+// autoQueue holds the documents sent by the webhook until the background loop processes them
+var autoQueue = newDocumentQueue()
+
+func newDocumentQueue() *documentQueue {
+	return &documentQueue{
+		queued: make(map[int]bool),
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+// Enqueue adds a document to the queue and reports whether it was not queued yet
+func (q *documentQueue) Enqueue(documentID int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.queued[documentID] {
+		return false
+	}
+	q.ids = append(q.ids, documentID)
+	q.queued[documentID] = true
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Dequeue removes the oldest document from the queue
+func (q *documentQueue) Dequeue() (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.ids) == 0 {
+		return 0, false
+	}
+	documentID := q.ids[0]
+	q.ids = q.ids[1:]
+	delete(q.queued, documentID)
+	return documentID, true
+}
+
+// paperlessWebhookHandler queues a document for automatic processing. It is meant to be called
+// by a webhook action of a paperless-ngx workflow, authenticated with WEBHOOK_SECRET.
+func (app *App) paperlessWebhookHandler(c *gin.Context) {
+	if webhookSecret == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhooks are disabled, set WEBHOOK_SECRET to enable them"})
+		return
+	}
+
+	if !hasWebhookSecret(c.Request) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook secret"})
+		return
+	}
+
+	documentID, err := parseWebhookDocumentID(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	added := autoQueue.Enqueue(documentID)
+	documentLogger(documentID).Infof("Document queued by webhook")
+
+	c.JSON(http.StatusAccepted, gin.H{"document_id": documentID, "already_queued": !added})
+}
+
+// hasWebhookSecret checks the secret sent as "Authorization: Bearer <secret>" or "X-Webhook-Secret: <secret>"
+func hasWebhookSecret(r *http.Request) bool {
+	secret := r.Header.Get("X-Webhook-Secret")
+	if bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		secret = bearer
+	}
+	return secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(webhookSecret)) == 1
+}
+
+// documentURLPattern finds the document ID in the {doc_url} placeholder of paperless-ngx
+var documentURLPattern = regexp.MustCompile(`/documents/(\d+)`)
+
+// parseWebhookDocumentID reads the document ID from a JSON or form body. It accepts the fields
+// document_id, doc_id and id, or a document URL in doc_url.
+func parseWebhookDocumentID(r *http.Request) (int, error) {
+	fields := make(map[string]string)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		// Numbers are kept as written, fmt.Sprint of a float64 would turn 1000000 into "1e+06"
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		var body map[string]interface{}
+		if err := decoder.Decode(&body); err != nil {
+			return 0, fmt.Errorf("invalid JSON body: %v", err)
+		}
+		for key, value := range body {
+			fields[key] = strings.TrimSpace(fmt.Sprint(value))
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return 0, fmt.Errorf("invalid form body: %v", err)
+		}
+		for key := range r.Form {
+			fields[key] = strings.TrimSpace(r.Form.Get(key))
+		}
+	}
+
+	for _, key := range []string{"document_id", "doc_id", "id"} {
+		if value, exists := fields[key]; exists && value != "" {
+			documentID, err := strconv.Atoi(value)
+			if err != nil || documentID <= 0 {
+				return 0, fmt.Errorf("invalid document ID '%s'", value)
+			}
+			return documentID, nil
+		}
+	}
+
+	if matches := documentURLPattern.FindStringSubmatch(fields["doc_url"]); matches != nil {
+		return strconv.Atoi(matches[1])
+	}
+
+	return 0, errors.New("missing document ID, send document_id or doc_url")
+}
+
+// processQueuedDocuments processes the documents queued by the webhook according to their tags.
+// Each document is tried once: a failure is counted against the document and logged, but neither
+// queues it again nor makes the background loop back off. Documents that are still tagged are
+// picked up again by the next poll or webhook.
+func (app *App) processQueuedDocuments() int {
+	ctx := context.Background()
+
+	processed := 0
+	for {
+		documentID, ok := autoQueue.Dequeue()
+		if !ok {
+			break
+		}
+		if app.processQueuedDocument(ctx, documentID) {
+			processed++
+		}
+	}
+	return processed
+}
+
+// processQueuedDocument runs OCR on a document tagged with autoOcrTag and auto-tagging on a
+// document tagged with autoTag. Documents with neither tag are skipped. It reports whether the
+// document was processed.
+func (app *App) processQueuedDocument(ctx context.Context, documentID int) bool {
+	docLogger := documentLogger(documentID)
+
+	document, err := app.Client.GetDocument(ctx, documentID)
+	if errors.Is(err, errDocumentNotFound) {
+		docLogger.Warn("Queued document does not exist anymore, skipping")
+		return false
+	}
+	if err != nil {
+		docLogger.Errorf("Error fetching queued document: %v", err)
+		return false
+	}
+
+	if isOcrEnabled() && slices.Contains(document.Tags, autoOcrTag) {
+		succeeded := app.processAutoDocument(ctx, autoFailureKindOCR, autoOcrTag, document, func(document Document, docLogger *logrus.Entry) error {
+			return app.autoOcrDocument(ctx, document, docLogger)
+		})
+		// Auto-tag the document with its new content
+		if succeeded && slices.Contains(document.Tags, autoTag) {
+			autoQueue.Enqueue(documentID)
+		}
+		return succeeded
+	}
+
+	if slices.Contains(document.Tags, autoTag) {
+		return app.processAutoDocument(ctx, autoFailureKindTag, autoTag, document, func(document Document, docLogger *logrus.Entry) error {
+			return app.autoTagDocument(ctx, document, docLogger)
+		})
+	}
+	return false
+}
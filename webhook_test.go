@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaperlessWebhookHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	originalSecret, originalQueue := webhookSecret, autoQueue
+	defer func() { webhookSecret, autoQueue = originalSecret, originalQueue }()
+
+	app := &App{}
+	router := gin.New()
+	router.POST("/api/webhooks/paperless", app.paperlessWebhookHandler)
+
+	send := func(contentType, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/webhooks/paperless", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	bearer := map[string]string{"Authorization": "Bearer s3cret"}
+
+	webhookSecret = ""
+	assert.Equal(t, http.StatusNotFound, send("application/json", `{"document_id": 1}`, bearer).Code)
+
+	webhookSecret = "s3cret"
+	autoQueue = newDocumentQueue()
+	assert.Equal(t, http.StatusUnauthorized, send("application/json", `{"document_id": 1}`, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, send("application/json", `{"document_id": 1}`, map[string]string{"Authorization": "Bearer wrong"}).Code)
+	assert.Equal(t, http.StatusBadRequest, send("application/json", `{"title": "Invoice"}`, bearer).Code)
+	assert.Equal(t, http.StatusBadRequest, send("application/json", `{"document_id": "abc"}`, bearer).Code)
+
+	w := send("application/json", `{"document_id": 42}`, bearer)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, float64(42), response["document_id"])
+	assert.Equal(t, false, response["already_queued"])
+
+	// The {doc_url} placeholder of paperless-ngx sent as form parameters
+	w = send("application/x-www-form-urlencoded", "doc_url=https%3A%2F%2Fpaperless.example.com%2Fdocuments%2F7%2F", map[string]string{"X-Webhook-Secret": "s3cret"})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	// Documents are only queued once
+	w = send("application/json", `{"doc_id": "42"}`, bearer)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, w.Body.String(), `"already_queued":true`)
+
+	// Large numeric IDs are not read in exponent notation
+	w = send("application/json", `{"document_id": 1000000}`, bearer)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	for _, expected := range []int{42, 7, 1000000} {
+		documentID, ok := autoQueue.Dequeue()
+		require.True(t, ok)
+		assert.Equal(t, expected, documentID)
+	}
+	_, ok := autoQueue.Dequeue()
+	assert.False(t, ok)
+}
+
+func TestProcessQueuedDocuments(t *testing.T) {
+	env, updatedTags, _ := setupAutoTagTest(t)
+
+	originalQueue := autoQueue
+	defer func() { autoQueue = originalQueue }()
+	autoQueue = newDocumentQueue()
+
+	env.setMockResponse("/api/documents/2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"id": 2, "title": "scan_002", "content": "Invoice from ACME", "tags": [1]}`))
+			return
+		}
+		var fields map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&fields))
+		updatedTags[2] = fields["tags"].([]interface{})
+		w.WriteHeader(http.StatusOK)
+	})
+	env.setMockResponse("/api/documents/3/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id": 3, "title": "Contract", "content": "Already processed", "tags": [2]}`))
+	})
+	env.setMockResponse("/api/documents/4/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"detail": "No Document matches the given query."}`))
+	})
+
+	t.Run("processes tagged documents and skips others", func(t *testing.T) {
+		app := &App{Client: env.client, Database: env.db, LLM: &mockLLM{response: "New Title"}}
+		for _, documentID := range []int{2, 3, 4} {
+			autoQueue.Enqueue(documentID)
+		}
+
+		count := app.processQueuedDocuments()
+		assert.Equal(t, 1, count)
+		assert.Equal(t, []interface{}{}, updatedTags[2])
+		assert.NotContains(t, updatedTags, 3)
+
+		_, ok := autoQueue.Dequeue()
+		assert.False(t, ok)
+	})
+
+	t.Run("failed documents are counted and dropped from the queue", func(t *testing.T) {
+		app := &App{Client: env.client, Database: env.db, LLM: &mockLLM{err: errors.New("connection refused")}}
+		autoQueue.Enqueue(2)
+
+		count := app.processQueuedDocuments()
+		assert.Zero(t, count)
+
+		_, ok := autoQueue.Dequeue()
+		assert.False(t, ok)
+
+		// Even a transient error counts, a single document can't tell an outage from a broken document
+		var failure DocumentFailure
+		require.NoError(t, env.db.Where("document_id = ? AND kind = ?", 2, autoFailureKindTag).First(&failure).Error)
+		assert.Equal(t, 1, failure.Attempts)
+		assert.Contains(t, failure.LastError, "connection refused")
+	})
+}